@@ -0,0 +1,461 @@
+package bots
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/gamerules"
+	"github.com/Pomog/bomberman/backend/gamestate"
+	"github.com/Pomog/bomberman/backend/mapgen"
+	"github.com/Pomog/bomberman/backend/webmodel"
+	"github.com/Pomog/bomberman/backend/websocket_hub"
+)
+
+// Constants describing the bots, matching the players' stats in the frontend.
+const (
+	BOT_NAME_PREFIX    = "Bot"                  // Bots are named "Bot-1", "Bot-2", ...
+	BOT_LIVES          = 3                      // Number of lives of a bot until the game starts with the lives of the game rules.
+	BOT_SPEED          = 6                      // Pixels per tick; the frontend moves players by 2 pixels every 17 ms.
+	SPEED_BONUS        = 1                      // Pixels per tick added by a speed power-up.
+	RESPAWN_TIME       = 300 * time.Millisecond // Time between a death and the respawn.
+	RESPAWN_PROTECTION = time.Second            // Time after the respawn when the bot can't be hit.
+	POWERUP_DISTANCE   = 6                      // The bot goes for power-ups not further than this number of tiles.
+)
+
+// Difficulty describes how well a bot plays.
+type Difficulty struct {
+	Name        string  // The name of the difficulty level.
+	ThinkEvery  int     // The bot makes a decision every ThinkEvery ticks; a higher value means a slower reaction.
+	BombChance  float64 // The probability to place a bomb when the bot is at a good spot.
+	DodgeChance float64 // The probability to notice the danger and run away from it.
+	HuntPlayers bool    // True if the bot goes after the other players, not only after the blocks.
+}
+
+// The difficulty levels of the bots.
+var (
+	EASY   = Difficulty{Name: gamerules.BOT_EASY, ThinkEvery: 6, BombChance: 0.3, DodgeChance: 0.6}
+	NORMAL = Difficulty{Name: gamerules.BOT_NORMAL, ThinkEvery: 3, BombChance: 0.6, DodgeChance: 0.9, HuntPlayers: true}
+	HARD   = Difficulty{Name: gamerules.BOT_HARD, ThinkEvery: 1, BombChance: 0.9, DodgeChance: 1, HuntPlayers: true}
+)
+
+// Difficulties maps the names of the difficulty levels, as in the game rules, to their settings.
+var Difficulties = map[string]Difficulty{
+	EASY.Name:   EASY,
+	NORMAL.Name: NORMAL,
+	HARD.Name:   HARD,
+}
+
+// startPositions are the spawn tiles of the players by their numbers, as in the frontend.
+var startPositions = []webmodel.MapCoords{
+	{Row: 1, Column: 1},
+	{Row: 1, Column: mapgen.MAP_COLUMNS - 2},
+	{Row: mapgen.MAP_ROWS - 2, Column: 1},
+	{Row: mapgen.MAP_ROWS - 2, Column: mapgen.MAP_COLUMNS - 2},
+}
+
+// Bot is a server-side player. It is registered in a room as a normal Client without a socket,
+// reads the room state and sends its actions to the room like a human player would.
+type Bot struct {
+	Client *websocket_hub.Client // The client of the bot in the room
+
+	hub        *websocket_hub.Hub
+	difficulty Difficulty
+	infoLog    *log.Logger
+	random     *rand.Rand
+
+	// Stats of the bot, changed by the power-ups
+	lives    int
+	maxBombs int
+	power    int
+	speed    float64
+
+	coords         [2]float64 // The position of the bot in pixels
+	tile           int        // The tile the bot stands on, or walks from
+	path           []int      // The tiles to walk through
+	direction      string     // The direction of the movement, for the sprite
+	frame          int        // The frame of the walking animation
+	ticks          int        // Number of ticks the bot has played
+	spawned        bool       // True once the bot appeared on the map
+	dead           bool       // True between a death and the respawn
+	respawnAt      time.Time  // When the dead bot respawns
+	protectedUntil time.Time  // The bot can't be hit before this time
+}
+
+// NewBot creates a bot, registers it in the room and announces it to the room members.
+// The bot does nothing until Run is called.
+func NewBot(hub *websocket_hub.Hub, room *websocket_hub.Room, difficulty Difficulty, infoLog *log.Logger) (*Bot, error) {
+	client, err := websocket_hub.NewClient(hub, botName(room), room, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("NewBot: %v", err)
+	}
+
+	bot := &Bot{
+		Client:     client,
+		hub:        hub,
+		difficulty: difficulty,
+		infoLog:    infoLog,
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		lives:      BOT_LIVES,
+		maxBombs:   1,
+		power:      1,
+		speed:      BOT_SPEED,
+		direction:  "moveDown",
+	}
+
+	bot.broadcast(webmodel.RegisterNewPlayer, client.User())
+	return bot, nil
+}
+
+// FillRoom adds bots of the given difficulty to the room until it has `size` players.
+// The bots start playing when the game in the room starts.
+func FillRoom(hub *websocket_hub.Hub, room *websocket_hub.Room, size int, difficulty Difficulty, infoLog *log.Logger) ([]*Bot, error) {
+	var bots []*Bot
+	for room.Size() < size {
+		bot, err := NewBot(hub, room, difficulty, infoLog)
+		if err != nil {
+			return bots, err
+		}
+		bots = append(bots, bot)
+		go bot.Run()
+		infoLog.Printf("Bot '%s' (%s) joined room '%s'", bot.Client.UserName, difficulty.Name, room)
+	}
+	return bots, nil
+}
+
+// botName returns the first bot name which is not used in the room.
+func botName(room *websocket_hub.Room) string {
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("%s-%d", BOT_NAME_PREFIX, i)
+		if !room.ContainsUser(name) {
+			return name
+		}
+	}
+}
+
+// Run plays the game every tick, until there are no human players left in the room.
+func (b *Bot) Run() {
+	ticker := time.NewTicker(gamestate.TICK_INTERVAL)
+	defer func() {
+		ticker.Stop()
+		b.leave()
+	}()
+
+	for range ticker.C {
+		if !b.drainMessages() || !b.Client.Room.HasHumans() {
+			return
+		}
+		// Wait for the game to start
+		if !b.Client.Room.State.Running() {
+			continue
+		}
+		if !b.spawned {
+			// The bot joins the game with the lives of the game rules of the room
+			b.lives = b.Client.Room.Rules().Lives
+			b.Client.Room.State.Join(b.Client.UserName, b.lives)
+			b.setPresence(webmodel.PRESENCE_IN_GAME)
+			b.spawn()
+		}
+		b.play()
+	}
+}
+
+// drainMessages empties the message queue of the bot; the bot reads the room state directly.
+// It returns false if the client of the bot was closed.
+func (b *Bot) drainMessages() bool {
+	_, closed := b.Client.TakeMessages()
+	return !closed
+}
+
+// leave removes the bot from the room and notifies the room members.
+func (b *Bot) leave() {
+	b.hub.UnRegisterClientFromHub(b.Client)
+	b.Client.Room.State.RemovePlayer(b.Client.UserName)
+	b.broadcast(webmodel.UserQuitChat, b.Client.User())
+	b.infoLog.Printf("Bot '%s' left room '%s'", b.Client.UserName, b.Client.Room)
+}
+
+// spawn puts the bot on its start position.
+func (b *Bot) spawn() {
+	start := startPositions[(max(b.Client.PlayerNumber, 1)-1)%len(startPositions)]
+	b.tile = gamestate.TileIndex(start.Row, start.Column)
+	b.coords = tileCoords(b.tile)
+	b.path = nil
+	b.spawned = true
+	b.dead = false
+	b.protectedUntil = time.Now().Add(RESPAWN_PROTECTION)
+
+	state := b.Client.Room.State
+	state.SetLives(b.Client.UserName, b.lives)
+	b.sendMove()
+}
+
+// play makes one step of the game: checks the hits, makes a decision and moves.
+func (b *Bot) play() {
+	if b.lives <= 0 {
+		return
+	}
+	if b.dead {
+		if time.Now().After(b.respawnAt) {
+			b.spawn()
+		}
+		return
+	}
+
+	state := b.Client.Room.State
+	w := newWorld(state.Tiles(), state.Bombs(), state.Tick())
+
+	if time.Now().After(b.protectedUntil) && w.burning[b.currentTile()] {
+		b.die()
+		return
+	}
+
+	b.ticks++
+	if b.atTileCenter() && (len(b.path) == 0 || b.ticks%b.difficulty.ThinkEvery == 0) {
+		b.think(w)
+	}
+	b.step(w)
+}
+
+// think chooses where to go and whether to place a bomb.
+func (b *Bot) think(w *world) {
+	b.path = nil
+
+	// Run away from the explosions
+	if w.danger[b.tile] {
+		if b.random.Float64() < b.difficulty.DodgeChance {
+			b.path = w.findPath(b.tile, func(index int) bool { return !w.danger[index] }, false)
+		}
+		return
+	}
+
+	// Collect the power-ups nearby
+	powerUpPath := w.findPath(b.tile, func(index int) bool { return gamestate.IsPowerUp(w.tiles[index]) }, true)
+	if powerUpPath != nil && len(powerUpPath) <= POWERUP_DISTANCE {
+		b.path = powerUpPath
+		return
+	}
+
+	// Place a bomb if the bot is at a good spot and can escape from it
+	enemies := b.enemyTiles()
+	if b.isGoodBombSpot(w, b.tile, enemies) && b.availableBombs() > 0 && b.random.Float64() < b.difficulty.BombChance {
+		bombCoords := b.bombCoords(b.tile)
+		withBomb := w.withBomb(bombCoords)
+		escape := withBomb.findPath(b.tile, func(index int) bool { return !withBomb.danger[index] }, false)
+		if len(escape) != 0 && b.placeBomb(bombCoords) {
+			b.path = escape
+			return
+		}
+	}
+
+	// Go to the nearest good spot for a bomb
+	if path := w.findPath(b.tile, func(index int) bool { return b.isGoodBombSpot(w, index, enemies) }, true); len(path) != 0 {
+		b.path = path
+		return
+	}
+
+	// Wander around
+	var safe []int
+	for _, next := range neighbours(b.tile) {
+		if w.walkable(next) && !w.bombTiles[next] && !w.danger[next] {
+			safe = append(safe, next)
+		}
+	}
+	if len(safe) != 0 {
+		b.path = []int{safe[b.random.Intn(len(safe))]}
+	}
+}
+
+// step moves the bot along its path.
+func (b *Bot) step(w *world) {
+	if len(b.path) == 0 {
+		return
+	}
+
+	next := b.path[0]
+	if !w.walkable(next) || w.burning[next] || w.bombTiles[next] {
+		// The way is blocked, the bot makes a new decision on the next tick
+		b.path = nil
+		return
+	}
+
+	target := tileCoords(next)
+	for axis := range b.coords {
+		delta := target[axis] - b.coords[axis]
+		if delta > b.speed {
+			delta = b.speed
+		} else if delta < -b.speed {
+			delta = -b.speed
+		}
+		b.coords[axis] += delta
+	}
+	b.direction = directionTo(b.tile, next)
+	if b.ticks%4 == 0 {
+		b.frame = (b.frame + 1) % 3
+	}
+
+	if b.coords == target {
+		b.tile = next
+		b.path = b.path[1:]
+		b.pickPowerUp()
+	}
+	b.sendMove()
+}
+
+// die takes a life of the bot and schedules the respawn.
+func (b *Bot) die() {
+	b.lives--
+	b.dead = true
+	b.path = nil
+	b.respawnAt = time.Now().Add(RESPAWN_TIME)
+
+	state := b.Client.Room.State
+	state.SetLives(b.Client.UserName, b.lives)
+	b.sendAction(webmodel.DieAction{ActionHeader: webmodel.ActionHeader{Type: webmodel.ACTION_DIE}, Lives: b.lives})
+	if b.lives <= 0 {
+		state.RemovePlayer(b.Client.UserName)
+		b.setPresence(webmodel.PRESENCE_SPECTATING)
+		b.infoLog.Printf("Bot '%s' is out of the game in room '%s'", b.Client.UserName, b.Client.Room)
+	}
+}
+
+// placeBomb places a bomb; it returns false if the room state rejected it.
+func (b *Bot) placeBomb(coords webmodel.BombCoords) bool {
+	state := b.Client.Room.State
+	if err := state.PlaceBomb(b.Client.UserName, coords, state.Tick(), 0); err != nil {
+		return false
+	}
+	b.sendAction(webmodel.PlaceBombAction{ActionHeader: webmodel.ActionHeader{Type: webmodel.ACTION_PLACE_BOMB}, Coords: coords})
+	return true
+}
+
+// pickPowerUp picks up the power-up on the current tile, if there is one.
+func (b *Bot) pickPowerUp() {
+	row, column := b.tile/mapgen.MAP_COLUMNS, b.tile%mapgen.MAP_COLUMNS
+	switch b.Client.Room.State.PickPowerUp(row, column) {
+	case gamestate.TILE_POWERUP_BOMB:
+		b.maxBombs++
+	case gamestate.TILE_POWERUP_FLAME:
+		b.power++
+	case gamestate.TILE_POWERUP_SPEED:
+		b.speed += SPEED_BONUS
+	default:
+		return
+	}
+	b.sendAction(webmodel.PowerPickedAction{
+		ActionHeader: webmodel.ActionHeader{Type: webmodel.ACTION_POWER_PICKED},
+		Coords:       webmodel.MapCoords{Row: row, Column: column},
+	})
+}
+
+// sendMove updates the position of the bot in the room state; the other players get it with the state updates.
+func (b *Bot) sendMove() {
+	b.Client.Room.State.MovePlayer(b.Client.UserName, b.coords, &webmodel.SpriteInfo{Direction: b.direction, Frame: b.frame})
+}
+
+// sendAction broadcasts the action of the bot to the room, as ReplyPlayerAction does for the human players.
+func (b *Bot) sendAction(action webmodel.Action) {
+	b.broadcast(webmodel.PlayerAction, webmodel.PlrAction{UserName: b.Client.UserName, Action: action})
+}
+
+// setPresence changes the presence of the bot and notifies the room with a `presence` message if it changed,
+// as the server does for the human players.
+func (b *Bot) setPresence(presence string) {
+	if b.Client.SetPresence(presence) {
+		b.broadcast(webmodel.Presence, b.Client.User())
+	}
+}
+
+// broadcast sends a message to all members of the bot's room.
+func (b *Bot) broadcast(messageType string, data any) {
+	wsMessage, err := webmodel.CreateJSONMessage(messageType, webmodel.SUCCESS_RESULT, data)
+	if err != nil {
+		b.infoLog.Printf("Bot '%s' cannot create message '%s': %v", b.Client.UserName, messageType, err)
+		return
+	}
+	b.hub.BroadcastMessageInRoom(wsMessage, b.Client.Room)
+}
+
+// availableBombs returns the number of bombs the bot can place now.
+func (b *Bot) availableBombs() int {
+	state := b.Client.Room.State
+	tick := state.Tick()
+	available := b.maxBombs
+	for _, bomb := range state.Bombs() {
+		if bomb.Owner == b.Client.UserName && tick < bomb.ExplodesAt {
+			available--
+		}
+	}
+	return available
+}
+
+// isGoodBombSpot reports whether a bomb on the tile would destroy a block or, if the bot hunts, hit an enemy.
+func (b *Bot) isGoodBombSpot(w *world, index int, enemies map[int]bool) bool {
+	for _, next := range neighbours(index) {
+		if gamestate.IsBlock(w.tiles[next]) {
+			return true
+		}
+	}
+	if b.difficulty.HuntPlayers && len(enemies) != 0 {
+		for _, blasted := range gamestate.BlastTiles(w.tiles, b.bombCoords(index)) {
+			if enemies[blasted] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// enemyTiles returns the tiles the other players stand on.
+func (b *Bot) enemyTiles() map[int]bool {
+	enemies := make(map[int]bool)
+	for _, player := range b.Client.Room.State.Players() {
+		if player.UserName != b.Client.UserName {
+			enemies[tileAt(player.Coords)] = true
+		}
+	}
+	return enemies
+}
+
+// bombCoords returns the coordinates of a bomb of the bot placed on the tile.
+func (b *Bot) bombCoords(index int) webmodel.BombCoords {
+	return webmodel.BombCoords{Row: index / mapgen.MAP_COLUMNS, Column: index % mapgen.MAP_COLUMNS, Power: b.power}
+}
+
+// currentTile returns the tile the bot is standing on, the same way the frontend rounds it.
+func (b *Bot) currentTile() int {
+	return tileAt(b.coords)
+}
+
+// atTileCenter reports whether the bot stands exactly on a tile.
+func (b *Bot) atTileCenter() bool {
+	return b.coords == tileCoords(b.tile)
+}
+
+// tileCoords returns the position in pixels of the tile.
+func tileCoords(index int) [2]float64 {
+	row, column := index/mapgen.MAP_COLUMNS, index%mapgen.MAP_COLUMNS
+	return [2]float64{float64(column * gamestate.TILE_SIZE), float64(row * gamestate.TILE_SIZE)}
+}
+
+// tileAt returns the tile a position in pixels belongs to.
+func tileAt(coords [2]float64) int {
+	column := int((coords[0] + gamestate.TILE_SIZE/2) / gamestate.TILE_SIZE)
+	row := int((coords[1] + gamestate.TILE_SIZE/2) / gamestate.TILE_SIZE)
+	return gamestate.TileIndex(row, column)
+}
+
+// directionTo returns the sprite direction of the movement between two neighbouring tiles.
+func directionTo(from, to int) string {
+	switch to - from {
+	case -1:
+		return "moveLeft"
+	case 1:
+		return "moveRight"
+	case -mapgen.MAP_COLUMNS:
+		return "moveUp"
+	default:
+		return "moveDown"
+	}
+}
@@ -0,0 +1,126 @@
+package bots
+
+import (
+	"github.com/Pomog/bomberman/backend/gamestate"
+	"github.com/Pomog/bomberman/backend/mapgen"
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// world is the view of the room state a bot makes its decisions on.
+type world struct {
+	tiles     []byte       // The game map.
+	bombTiles map[int]bool // Tiles with a bomb that has not exploded yet.
+	danger    map[int]bool // Tiles that are or will be reached by an explosion.
+	burning   map[int]bool // Tiles reached by an explosion right now.
+}
+
+// newWorld creates the view of the room state at the given tick.
+func newWorld(tiles []byte, bombs []gamestate.BombInfo, tick uint64) *world {
+	w := &world{
+		tiles:     tiles,
+		bombTiles: make(map[int]bool),
+		danger:    make(map[int]bool),
+		burning:   make(map[int]bool),
+	}
+
+	for _, bomb := range bombs {
+		blast := gamestate.BlastTiles(tiles, bomb.Coords)
+		if tick < bomb.ExplodesAt {
+			w.bombTiles[gamestate.TileIndex(bomb.Coords.Row, bomb.Coords.Column)] = true
+		}
+		for _, index := range blast {
+			w.danger[index] = true
+			if tick >= bomb.ExplodesAt && tick <= bomb.EndsAt {
+				w.burning[index] = true
+			}
+		}
+	}
+	return w
+}
+
+// withBomb returns a copy of the world with an additional bomb, used to check whether
+// the bot can escape from its own bomb before placing it.
+func (w *world) withBomb(coords webmodel.BombCoords) *world {
+	copied := &world{
+		tiles:     w.tiles,
+		bombTiles: make(map[int]bool, len(w.bombTiles)+1),
+		danger:    make(map[int]bool, len(w.danger)),
+		burning:   w.burning,
+	}
+	for index := range w.bombTiles {
+		copied.bombTiles[index] = true
+	}
+	for index := range w.danger {
+		copied.danger[index] = true
+	}
+
+	copied.bombTiles[gamestate.TileIndex(coords.Row, coords.Column)] = true
+	for _, index := range gamestate.BlastTiles(w.tiles, coords) {
+		copied.danger[index] = true
+	}
+	return copied
+}
+
+// walkable reports whether a player can stand on the tile.
+func (w *world) walkable(index int) bool {
+	if index < 0 || index >= len(w.tiles) {
+		return false
+	}
+	tile := w.tiles[index]
+	return tile == gamestate.TILE_GRASS || gamestate.IsPowerUp(tile)
+}
+
+// neighbours returns the indexes of the four tiles around the tile.
+func neighbours(index int) []int {
+	row, column := index/mapgen.MAP_COLUMNS, index%mapgen.MAP_COLUMNS
+	result := make([]int, 0, 4)
+	if column > 0 {
+		result = append(result, index-1)
+	}
+	if column < mapgen.MAP_COLUMNS-1 {
+		result = append(result, index+1)
+	}
+	if row > 0 {
+		result = append(result, index-mapgen.MAP_COLUMNS)
+	}
+	if row < mapgen.MAP_ROWS-1 {
+		result = append(result, index+mapgen.MAP_COLUMNS)
+	}
+	return result
+}
+
+// findPath searches the shortest path from the tile `start` to the nearest tile satisfying `goal`.
+// The path never goes through blocks, bombs or burning tiles; if `avoidDanger` is true,
+// it doesn't go through the tiles that will be reached by an explosion either.
+//
+// It returns the tiles to walk through, without `start`: an empty path if `start` satisfies `goal`,
+// and nil if no such tile is reachable.
+func (w *world) findPath(start int, goal func(index int) bool, avoidDanger bool) []int {
+	previous := map[int]int{start: start}
+	queue := []int{start}
+
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if goal(current) {
+			path := []int{}
+			for index := current; index != start; index = previous[index] {
+				path = append([]int{index}, path...)
+			}
+			return path
+		}
+
+		for _, next := range neighbours(current) {
+			if _, visited := previous[next]; visited {
+				continue
+			}
+			if !w.walkable(next) || w.bombTiles[next] || w.burning[next] || (avoidDanger && w.danger[next]) {
+				continue
+			}
+			previous[next] = current
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package chathistory
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// Constants of the chat history.
+const (
+	HISTORY_SIZE  = 100 // The number of messages kept per channel.
+	BACKFILL_SIZE = 20  // The number of messages sent to a player joining a room.
+	MAX_PAGE_SIZE = 50  // The maximal number of messages of a `chatHistory` reply.
+
+	// The history file is rewritten with the kept messages when it has this many times HISTORY_SIZE lines.
+	COMPACT_FACTOR = 2
+
+	EDIT_WINDOW = 5 * time.Minute // The time after which the sender can't edit or delete a message anymore.
+)
+
+// ErrMessageNotFound is returned when editing or deleting a message which is not in the history,
+// because it never existed, was deleted or is too old.
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrNotPersisted is wrapped by the errors of Add when the message was sent and kept in memory,
+// but could not be appended to the history file.
+var ErrNotPersisted = errors.New("message not persisted")
+
+// History is the bounded history of the messages of a chat channel, ordered by their DateCreate.
+// It is persisted in a file with one JSON message per line, if it has a file.
+//
+// The edits and deletions are appended to the file too, as the new version of the message
+// and as a deleted entry; the last line of a message ID wins when the file is loaded.
+type History struct {
+	mutex     sync.Mutex
+	messages  []webmodel.ChatMessage // The last HISTORY_SIZE messages, the oldest first.
+	lastID    uint64                 // The ID of the last message of the channel, the next one gets lastID+1.
+	file      string                 // The path of the history file, empty if the history is not persisted.
+	fileLines int                    // The number of lines in the file, including the dropped, edited and deleted messages.
+}
+
+// fileEntry is a line of the history file: a message, or the deletion of the message with its ID.
+type fileEntry struct {
+	webmodel.ChatMessage
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// newHistory creates a history persisted in `file`, loading the messages already in the file.
+// An empty `file` creates a history kept in memory only.
+func newHistory(file string) (*History, error) {
+	history := &History{file: file}
+	if file == "" {
+		return history, nil
+	}
+
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return history, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry fileEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return history, fmt.Errorf("line %d of %s: %v", history.fileLines+1, file, err)
+		}
+		history.fileLines++
+		history.lastID = max(history.lastID, entry.MessageID)
+
+		// An edit or a deletion of a message already loaded (the messages of older files have no ID)
+		if i, ok := history.find(entry.MessageID); ok {
+			if entry.Deleted {
+				history.messages = append(history.messages[:i], history.messages[i+1:]...)
+			} else {
+				history.messages[i] = entry.ChatMessage
+			}
+			continue
+		}
+		if !entry.Deleted {
+			history.insert(entry.ChatMessage)
+		}
+	}
+	return history, scanner.Err()
+}
+
+// Add stamps a message with the next ID of the channel and the current time, and sends it with `send`.
+// The message is sent under the lock of the history, so the players get the messages of the channel in the order of their IDs.
+// Once sent, the message is recorded in the history and appended to the history file; a message which could not be sent
+// is not recorded, and the error of `send` is returned.
+// It returns the stamped message, which is kept in memory even if it can't be persisted: the error wraps ErrNotPersisted then.
+func (h *History) Add(message webmodel.ChatMessage, send func(message webmodel.ChatMessage) error) (webmodel.ChatMessage, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// The ID and the time are set under the lock, so the IDs increase with the time
+	message.MessageID = h.lastID + 1
+	message.DateCreate = time.Now().UTC()
+	if err := send(message); err != nil {
+		return message, err
+	}
+
+	h.lastID = message.MessageID
+	h.insert(message)
+	if err := h.persist(fileEntry{ChatMessage: message}); err != nil {
+		return message, fmt.Errorf("%w: %v", ErrNotPersisted, err)
+	}
+	return message, nil
+}
+
+// Update changes the message with the given ID with `change`, and appends the new version to the history file.
+// Nothing changes if `change` returns an error, which is returned.
+// It returns the new version of the message, or ErrMessageNotFound.
+func (h *History) Update(messageID uint64, change func(message *webmodel.ChatMessage) error) (webmodel.ChatMessage, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	i, ok := h.find(messageID)
+	if !ok {
+		return webmodel.ChatMessage{}, ErrMessageNotFound
+	}
+	message := h.messages[i]
+	if err := change(&message); err != nil {
+		return webmodel.ChatMessage{}, err
+	}
+
+	h.messages[i] = message
+	return message, h.persist(fileEntry{ChatMessage: message})
+}
+
+// Delete removes the message with the given ID if `check` allows it, and appends the deletion to the history file.
+// Nothing changes if `check` returns an error, which is returned.
+// It returns the deleted message, or ErrMessageNotFound.
+func (h *History) Delete(messageID uint64, check func(message webmodel.ChatMessage) error) (webmodel.ChatMessage, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	i, ok := h.find(messageID)
+	if !ok {
+		return webmodel.ChatMessage{}, ErrMessageNotFound
+	}
+	message := h.messages[i]
+	if err := check(message); err != nil {
+		return webmodel.ChatMessage{}, err
+	}
+
+	h.messages = append(h.messages[:i], h.messages[i+1:]...)
+	return message, h.persist(fileEntry{ChatMessage: webmodel.ChatMessage{MessageID: messageID}, Deleted: true})
+}
+
+// Last returns the last `count` messages of the history, the oldest first.
+func (h *History) Last(count int) []webmodel.ChatMessage {
+	page, _ := h.Before(time.Time{}, count)
+	return page
+}
+
+/*
+Before returns a page of the history: the last `count` messages created before `before`, the oldest first.
+The zero `before` means the end of the history.
+
+Returns:
+  - the messages of the page;
+  - more: true if the history has older messages than the page.
+*/
+func (h *History) Before(before time.Time, count int) (page []webmodel.ChatMessage, more bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	end := len(h.messages)
+	if !before.IsZero() {
+		end = sort.Search(len(h.messages), func(i int) bool {
+			return !h.messages[i].DateCreate.Before(before)
+		})
+	}
+	start := max(0, end-count)
+
+	page = make([]webmodel.ChatMessage, end-start)
+	copy(page, h.messages[start:end])
+	return page, start > 0
+}
+
+// insert adds a message at its place by DateCreate and drops the oldest messages above HISTORY_SIZE.
+// The messages with the same date keep their arrival order.
+func (h *History) insert(message webmodel.ChatMessage) {
+	i := sort.Search(len(h.messages), func(i int) bool {
+		return h.messages[i].DateCreate.After(message.DateCreate)
+	})
+	h.messages = append(h.messages, webmodel.ChatMessage{})
+	copy(h.messages[i+1:], h.messages[i:])
+	h.messages[i] = message
+
+	if len(h.messages) > HISTORY_SIZE {
+		h.messages = h.messages[len(h.messages)-HISTORY_SIZE:]
+	}
+}
+
+// find returns the index of the message with the given ID, and false if there is none.
+func (h *History) find(messageID uint64) (int, bool) {
+	if messageID == 0 {
+		return 0, false
+	}
+	for i := len(h.messages) - 1; i >= 0; i-- {
+		if h.messages[i].MessageID == messageID {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// persist appends an entry to the history file, or rewrites the file if it is too long.
+func (h *History) persist(entry fileEntry) error {
+	if h.file == "" {
+		return nil
+	}
+	if h.fileLines+1 >= COMPACT_FACTOR*HISTORY_SIZE {
+		return h.compact()
+	}
+	return h.appendToFile(entry)
+}
+
+// appendToFile appends an entry to the history file.
+func (h *History) appendToFile(entry fileEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o664)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	h.fileLines++
+	return nil
+}
+
+// compact rewrites the history file with the kept messages only, so the file doesn't grow forever.
+// The file is replaced at once, a crash leaves either the old or the new file.
+func (h *History) compact() error {
+	temporary := h.file + ".tmp"
+	f, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]fileEntry, 0, len(h.messages)+1)
+	for _, message := range h.messages {
+		entries = append(entries, fileEntry{ChatMessage: message})
+	}
+	// Keep the last ID when the last message was deleted, so the IDs are not reused after a restart
+	if h.lastID > 0 && (len(h.messages) == 0 || h.messages[len(h.messages)-1].MessageID < h.lastID) {
+		entries = append(entries, fileEntry{ChatMessage: webmodel.ChatMessage{MessageID: h.lastID}, Deleted: true})
+	}
+
+	writer := bufio.NewWriter(f)
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temporary, h.file); err != nil {
+		return err
+	}
+	h.fileLines = len(entries)
+	return nil
+}
@@ -0,0 +1,59 @@
+package chathistory
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// sent is the send function of a message which is always sent.
+func sent(webmodel.ChatMessage) error {
+	return nil
+}
+
+func TestAddSendsTheMessagesInTheOrderOfTheirIDs(t *testing.T) {
+	history, _ := newHistory("")
+	var sentIDs []uint64
+	send := func(message webmodel.ChatMessage) error {
+		sentIDs = append(sentIDs, message.MessageID)
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := history.Add(webmodel.ChatMessage{UserName: "alice", Content: "hi"}, send); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	for i, messageID := range sentIDs {
+		if messageID != uint64(i+1) {
+			t.Errorf("got IDs %v sent, want 1, 2, 3", sentIDs)
+			break
+		}
+	}
+	if got := len(history.Last(BACKFILL_SIZE)); got != 3 {
+		t.Errorf("the history has %d messages, want 3", got)
+	}
+}
+
+func TestAddDoesNotRecordAMessageWhichWasNotSent(t *testing.T) {
+	history, _ := newHistory("")
+	sendErr := errors.New("not sent")
+	if _, err := history.Add(webmodel.ChatMessage{UserName: "alice", Content: "lost"}, func(webmodel.ChatMessage) error {
+		return sendErr
+	}); err != sendErr {
+		t.Fatalf("got error %v, want the error of the send function", err)
+	}
+	if got := len(history.Last(BACKFILL_SIZE)); got != 0 {
+		t.Fatalf("the history has %d messages, want none", got)
+	}
+
+	// The ID of the lost message was never seen by the players, it is given to the next message
+	message, err := history.Add(webmodel.ChatMessage{UserName: "alice", Content: "hi"}, sent)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if message.MessageID != 1 {
+		t.Errorf("got ID %d, want 1", message.MessageID)
+	}
+}
@@ -0,0 +1,86 @@
+package chathistory
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DEFAULT_DIR is the directory of the history files, relative to the working directory of the server.
+const DEFAULT_DIR = "chat_history"
+
+// Store holds the histories of the chat channels, one per channel of a room and one for the global channel.
+// The histories of the persisted channels are kept in the files `<dir>/<channel ID>.jsonl`,
+// the others only in memory until they are removed.
+type Store struct {
+	dir       string          // The directory of the history files, empty if the histories are not persisted.
+	persisted map[string]bool // The channels whose history is kept in a file: their ID outlives the server.
+	mutex     sync.Mutex
+	histories map[string]*History
+}
+
+// NewStore creates a store of histories, in which the `persisted` channels are persisted in `dir`,
+// creating the directory if needed. An empty `dir` creates a store kept in memory only.
+func NewStore(dir string, persisted ...string) (*Store, error) {
+	store := &Store{dir: dir, persisted: make(map[string]bool), histories: make(map[string]*History)}
+	for _, channelID := range persisted {
+		store.persisted[channelID] = true
+	}
+	if dir == "" {
+		return store, nil
+	}
+	if err := os.MkdirAll(dir, 0o775); err != nil {
+		// Keep the histories in memory, the chat works without them being persisted.
+		store.dir = ""
+		return store, err
+	}
+	return store, nil
+}
+
+// Channel returns the history of a channel, loading it from its file on first use.
+// The history is usable even if loading failed; the error tells which messages are lost.
+func (s *Store) Channel(channelID string) (*History, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if history, ok := s.histories[channelID]; ok {
+		return history, nil
+	}
+
+	file := ""
+	if s.persisted[channelID] {
+		file = s.file(channelID)
+	}
+	history, err := newHistory(file)
+	s.histories[channelID] = history
+	return history, err
+}
+
+// Remove forgets the history of a channel which is closed for good, e.g. the room channel of a destroyed room,
+// with the histories of its sub-channels, whose IDs are `<channel ID>/<name>`, and deletes its file if it has one.
+func (s *Store) Remove(channelID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id := range s.histories {
+		if id == channelID || strings.HasPrefix(id, channelID+"/") {
+			delete(s.histories, id)
+		}
+	}
+	if file := s.file(channelID); file != "" {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// file returns the path of the history file of a channel, empty if the histories are not persisted.
+func (s *Store) file(channelID string) string {
+	if s.dir == "" {
+		return ""
+	}
+	// The channel IDs are UUIDs or constants, so they are safe file names.
+	return filepath.Join(s.dir, filepath.Base(channelID)+".jsonl")
+}
@@ -0,0 +1,77 @@
+package chathistory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+func TestStorePersistsTheListedChannelsOnly(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, "global")
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	for _, channelID := range []string{"global", "room-1"} {
+		history, err := store.Channel(channelID)
+		if err != nil {
+			t.Fatalf("Channel(%q): %v", channelID, err)
+		}
+		if _, err := history.Add(webmodel.ChatMessage{UserName: "alice", Content: "hi"}, sent); err != nil {
+			t.Fatalf("Add to %q: %v", channelID, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "global.jsonl")); err != nil {
+		t.Errorf("the persisted channel has no file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "room-1.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("got %v for the file of a room channel, want it not to exist", err)
+	}
+
+	// A new store, like after a restart, finds the persisted messages only
+	restarted, err := NewStore(dir, "global")
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	for channelID, want := range map[string]int{"global": 1, "room-1": 0} {
+		history, _ := restarted.Channel(channelID)
+		if got := len(history.Last(BACKFILL_SIZE)); got != want {
+			t.Errorf("channel %q has %d messages after a restart, want %d", channelID, got, want)
+		}
+	}
+}
+
+func TestStoreRemove(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, "global")
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	for _, channelID := range []string{"room-1", "room-1/private"} {
+		history, _ := store.Channel(channelID)
+		history.Add(webmodel.ChatMessage{UserName: "alice", Content: "hi"}, sent)
+	}
+	// The file of a room persisted by an older version of the server
+	legacyFile := filepath.Join(dir, "room-1.jsonl")
+	if err := os.WriteFile(legacyFile, []byte(`{"userName":"bob","content":"old"}`+"\n"), 0o664); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := store.Remove("room-1"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := os.Stat(legacyFile); !os.IsNotExist(err) {
+		t.Errorf("got %v for the file of the removed channel, want it deleted", err)
+	}
+	for _, channelID := range []string{"room-1", "room-1/private"} {
+		if history, _ := store.Channel(channelID); len(history.Last(BACKFILL_SIZE)) != 0 {
+			t.Errorf("the removed channel %q still has its messages", channelID)
+		}
+	}
+	if err := store.Remove("room-2"); err != nil {
+		t.Errorf("Remove of a channel without history: %v", err)
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/mapgen"
+	"github.com/Pomog/bomberman/backend/webmodel"
+	"github.com/gorilla/websocket"
+)
+
+// Constants of the simulated player.
+const (
+	ROOM_SIZE      = 4                       // The clients are ready to start the game when their room has this many players.
+	START_AFTER    = 10 * time.Second        // The clients are ready anyway after this time.
+	TILE_SIZE      = 32                      // Size of a map tile in pixels.
+	MOVE_DISTANCE  = 6                       // Pixels per movement, about the speed of a player in the frontend.
+	TURN_CHANCE    = 0.1                     // Probability to change the direction at each movement.
+	WRITE_WAIT     = 10 * time.Second        // Time allowed to write a message to the server.
+	CHAT_TEXT      = "load test message #%d" // Text of the chat messages; the number identifies the message.
+	BROWSER_ORIGIN = "http://localhost:8080" // Origin accepted by the server's CORS check.
+	JOIN_GAME_PATH = "/joinGame"             // Path of the WebSocket endpoint.
+)
+
+// directions are the movements of the random walk, as the sprite direction and the pixel offsets.
+var directions = []struct {
+	sprite string
+	dx, dy float64
+}{
+	{"moveLeft", -1, 0},
+	{"moveRight", 1, 0},
+	{"moveUp", 0, -1},
+	{"moveDown", 0, 1},
+}
+
+// loadClient is one simulated player connected to the server.
+type loadClient struct {
+	cfg    config
+	name   string
+	stats  *stats
+	random *rand.Rand
+
+	conn      *websocket.Conn
+	writeLock sync.Mutex  // gorilla/websocket supports only one concurrent writer
+	closing   atomic.Bool // True once the client closes the connection itself
+
+	coords    [2]float64    // Position of the player in pixels
+	direction int           // Index of the current direction in `directions`
+	seq       uint64        // Sequence number of the last action
+	scriptPos int           // Position in the script
+	tick      atomic.Uint64 // Last tick received in the state updates
+
+	members     map[string]bool // Names of the players in the room, changed by the read loop only
+	memberCount atomic.Int32    // Size of `members`, read by the main loop when chatting
+	started     bool            // True once the client is ready to start the game
+	startNow    chan struct{}   // Signalled by the read loop when the room is full
+
+	chatLock sync.Mutex
+	chatSeq  int
+	chatSent map[int]time.Time // Send times of the chat messages waiting to come back
+}
+
+// newLoadClient creates a client; it connects when run is called.
+func newLoadClient(cfg config, name string, stats *stats) *loadClient {
+	return &loadClient{
+		cfg:      cfg,
+		name:     name,
+		stats:    stats,
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		coords:   [2]float64{TILE_SIZE, TILE_SIZE},
+		members:  make(map[string]bool),
+		startNow: make(chan struct{}, 1),
+		chatSent: make(map[int]time.Time),
+	}
+}
+
+// run connects to the server and plays until `stop` is closed or the server closes the connection.
+func (c *loadClient) run(stop <-chan struct{}) {
+	if err := c.connect(); err != nil {
+		c.stats.add(&c.stats.connectFailed, 1)
+		return
+	}
+	c.stats.add(&c.stats.connected, 1)
+
+	done := make(chan struct{})
+	go c.readLoop(done)
+
+	bombRate := c.cfg.bombRate
+	if c.cfg.script != nil {
+		bombRate = 0 // the script replaces the random actions
+	}
+	moves, stopMoves := every(c.cfg.moveRate)
+	defer stopMoves()
+	bombs, stopBombs := every(bombRate)
+	defer stopBombs()
+	chats, stopChats := every(c.cfg.chatRate)
+	defer stopChats()
+	pings := time.NewTicker(c.cfg.pingPeriod)
+	defer pings.Stop()
+	startTimer := time.NewTimer(START_AFTER)
+	defer startTimer.Stop()
+
+	for {
+		var err error
+		select {
+		case <-stop:
+			c.close()
+			<-done
+			return
+		case <-done:
+			return
+		case <-c.startNow:
+			err = c.start()
+		case <-startTimer.C:
+			err = c.start()
+		case <-moves:
+			err = c.move()
+		case <-bombs:
+			err = c.placeBomb()
+		case <-chats:
+			err = c.chat()
+		case <-pings.C:
+			err = c.send(webmodel.Ping, webmodel.LatencyPing{ClientTime: time.Now().UnixMilli()})
+		}
+		if err != nil {
+			// The read loop notices the broken connection and closes `done`
+			c.conn.Close()
+		}
+	}
+}
+
+// connect opens the WebSocket connection to `/joinGame`.
+func (c *loadClient) connect() error {
+	u := url.URL{Scheme: "ws", Host: c.cfg.addr, Path: JOIN_GAME_PATH, RawQuery: url.Values{
+		"name":                 {c.name},
+		webmodel.VERSION_PARAM: {fmt.Sprint(webmodel.PROTOCOL_VERSION)},
+	}.Encode()}
+	header := http.Header{}
+	header.Set("Origin", BROWSER_ORIGIN)
+
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), header)
+	if err != nil {
+		return fmt.Errorf("connect %s: %v", c.name, err)
+	}
+	c.conn = conn
+	return nil
+}
+
+// close closes the connection gracefully at the end of the test.
+func (c *loadClient) close() {
+	c.closing.Store(true)
+	c.writeLock.Lock()
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(WRITE_WAIT))
+	c.writeLock.Unlock()
+	c.conn.Close()
+}
+
+// send sends a message of the given type to the server.
+func (c *loadClient) send(messageType string, payload any) error {
+	rawPayload, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.sendMessage(webmodel.WSMessage{Type: messageType, Payload: rawPayload})
+}
+
+// sendMessage sends a prepared message to the server.
+func (c *loadClient) sendMessage(message webmodel.WSMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(WRITE_WAIT))
+	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return err
+	}
+	c.stats.add(&c.stats.sent, 1)
+	return nil
+}
+
+// start tells the server the client is ready to start the game, once.
+// The server starts the game when all the players of the room are ready and the countdown ends.
+func (c *loadClient) start() error {
+	if c.started || !c.cfg.startGame {
+		return nil
+	}
+	c.started = true
+	return c.send(webmodel.SetReady, webmodel.ReadyRequest{Ready: true})
+}
+
+// move sends the next line of the script, or a step of a random walk over the map.
+// The player doesn't move before the game runs, i.e. before the first state update.
+func (c *loadClient) move() error {
+	if c.tick.Load() == 0 {
+		return nil
+	}
+	if c.cfg.script != nil {
+		message := c.cfg.script[c.scriptPos%len(c.cfg.script)]
+		c.scriptPos++
+		return c.sendMessage(message)
+	}
+
+	if c.random.Float64() < TURN_CHANCE {
+		c.direction = c.random.Intn(len(directions))
+	}
+	direction := directions[c.direction]
+	x := c.coords[0] + direction.dx*MOVE_DISTANCE
+	y := c.coords[1] + direction.dy*MOVE_DISTANCE
+
+	// Turn back at the border of the map
+	if x < TILE_SIZE || x > (mapgen.MAP_COLUMNS-2)*TILE_SIZE || y < TILE_SIZE || y > (mapgen.MAP_ROWS-2)*TILE_SIZE {
+		c.direction ^= 1 // the opposite direction is the neighbour in `directions`
+		return nil
+	}
+	c.coords = [2]float64{x, y}
+
+	c.seq++
+	return c.send(webmodel.PlayerAction, webmodel.MoveAction{
+		ActionHeader: webmodel.ActionHeader{Type: webmodel.ACTION_MOVE, Seq: c.seq, Tick: c.tick.Load()},
+		Coords:       c.coords,
+		SpriteInfo:   &webmodel.SpriteInfo{Direction: direction.sprite, Frame: int(c.seq % 3)},
+	})
+}
+
+// placeBomb places a bomb on the tile of the player, once the game runs.
+func (c *loadClient) placeBomb() error {
+	if c.tick.Load() == 0 {
+		return nil
+	}
+	c.seq++
+	return c.send(webmodel.PlayerAction, webmodel.PlaceBombAction{
+		ActionHeader: webmodel.ActionHeader{Type: webmodel.ACTION_PLACE_BOMB, Seq: c.seq, Tick: c.tick.Load()},
+		Coords: webmodel.BombCoords{
+			Row:    int(c.coords[1]/TILE_SIZE + 0.5),
+			Column: int(c.coords[0]/TILE_SIZE + 0.5),
+			Power:  1,
+		},
+	})
+}
+
+// chat sends a numbered chat message and remembers when it was sent.
+func (c *loadClient) chat() error {
+	c.chatLock.Lock()
+	c.chatSeq++
+	number := c.chatSeq
+	c.chatSent[number] = time.Now()
+	c.chatLock.Unlock()
+
+	// Every player of the room, the sender included, should receive the message
+	c.stats.add(&c.stats.chatSent, 1)
+	c.stats.add(&c.stats.chatExpected, max(int(c.memberCount.Load()), 1))
+	return c.send(webmodel.SendMessageToChat, webmodel.ChatMessage{
+		Content:    fmt.Sprintf(CHAT_TEXT, number),
+		DateCreate: time.Now(),
+	})
+}
+
+// readLoop reads the messages of the server until the connection is closed, then closes `done`.
+func (c *loadClient) readLoop(done chan<- struct{}) {
+	defer close(done)
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if !c.closing.Load() {
+				c.stats.add(&c.stats.disconnects, 1)
+			}
+			return
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+		// The server may batch several messages in one frame, separated by new lines
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				c.handle([]byte(line))
+			}
+		}
+	}
+}
+
+// handle processes one message of the server.
+func (c *loadClient) handle(data []byte) {
+	c.stats.add(&c.stats.received, 1)
+
+	var message webmodel.WSMessage
+	var payload struct {
+		Result string          `json:"result"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(data, &message) != nil || json.Unmarshal(message.Payload, &payload) != nil {
+		c.stats.add(&c.stats.errorReplies, 1)
+		return
+	}
+	if payload.Result != webmodel.SUCCESS_RESULT {
+		c.stats.add(&c.stats.errorReplies, 1)
+		return
+	}
+
+	switch message.Type {
+	case webmodel.Ping:
+		var ping webmodel.LatencyPing
+		if json.Unmarshal(payload.Data, &ping) != nil {
+			return
+		}
+		if ping.ClientTime != 0 {
+			// The reply to our ping
+			c.stats.addLatency(&c.stats.pingRTT, time.Since(time.UnixMilli(ping.ClientTime)))
+		} else {
+			// The server measures its round-trip time
+			c.send(webmodel.Pong, ping)
+		}
+
+	case webmodel.StateUpdate:
+		var update webmodel.RoomStateUpdate
+		if json.Unmarshal(payload.Data, &update) != nil {
+			return
+		}
+		c.stats.add(&c.stats.stateUpdates, 1)
+		c.tick.Store(update.Tick)
+		c.send(webmodel.StateAck, update.Tick)
+
+	case webmodel.InputChatMessage:
+		var chatMessage webmodel.ChatMessage
+		var number int
+		if json.Unmarshal(payload.Data, &chatMessage) != nil {
+			return
+		}
+		if _, err := fmt.Sscanf(chatMessage.Content, CHAT_TEXT, &number); err != nil {
+			return
+		}
+		// The deliveries are counted by the receivers, the latency by the sender only
+		c.stats.add(&c.stats.chatDelivered, 1)
+		if chatMessage.UserName != c.name {
+			return
+		}
+		c.chatLock.Lock()
+		sentAt, ok := c.chatSent[number]
+		delete(c.chatSent, number)
+		c.chatLock.Unlock()
+		if ok {
+			c.stats.addLatency(&c.stats.chatLatency, time.Since(sentAt))
+		}
+
+	case webmodel.UsersInRoom:
+		var users []webmodel.PlayerInfo
+		if json.Unmarshal(payload.Data, &users) == nil {
+			for _, user := range users {
+				c.members[user.UserName] = true
+			}
+		}
+		c.memberCount.Store(int32(len(c.members)))
+		c.checkRoomFull()
+
+	case webmodel.RegisterNewPlayer:
+		var user webmodel.PlayerInfo
+		if json.Unmarshal(payload.Data, &user) == nil {
+			c.members[user.UserName] = true
+		}
+		c.memberCount.Store(int32(len(c.members)))
+		c.checkRoomFull()
+
+	case webmodel.UserQuitChat:
+		var user webmodel.PlayerInfo
+		if json.Unmarshal(payload.Data, &user) == nil {
+			delete(c.members, user.UserName)
+		}
+		c.memberCount.Store(int32(len(c.members)))
+	}
+}
+
+// checkRoomFull signals the main loop to get ready to start the game once the room is full.
+func (c *loadClient) checkRoomFull() {
+	if len(c.members) >= ROOM_SIZE {
+		select {
+		case c.startNow <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// every returns a channel receiving values `rate` times per second, or nil if the rate is not positive,
+// and the function stopping it.
+func every(rate float64) (<-chan time.Time, func()) {
+	if rate <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	return ticker.C, ticker.Stop
+}
@@ -0,0 +1,142 @@
+// Command loadbot stresses the game server: it opens many WebSocket connections to `/joinGame`,
+// plays scripted or random actions at realistic rates, sends chat messages and reports
+// the latency percentiles, the dropped messages and the disconnects.
+//
+// Usage:
+//
+//	go run ./cmd/loadbot -clients 100 -duration 1m
+//	go run ./cmd/loadbot -clients 20 -script actions.jsonl
+//
+// The script file contains one WebSocket message per line, e.g.
+// {"type":"playerAction","payload":{"type":"movePlayer","coords":[64,32]}};
+// the clients replay it in a loop instead of the random actions.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// config holds the command line options of the load test.
+type config struct {
+	addr       string        // Address of the server.
+	clients    int           // Number of connections to open.
+	duration   time.Duration // How long the clients play.
+	ramp       time.Duration // Delay between opening two connections.
+	namePrefix string        // Prefix of the user names.
+	moveRate   float64       // Movements (or script lines) per second per client.
+	bombRate   float64       // Bombs per second per client.
+	chatRate   float64       // Chat messages per second per client.
+	pingPeriod time.Duration // Period of the latency measurement pings.
+	startGame  bool          // True to get ready to start the game in every room.
+	script     []webmodel.WSMessage
+}
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	cfg := config{}
+	var scriptFile string
+	flag.StringVar(&cfg.addr, "addr", "localhost:8000", "address of the server")
+	flag.IntVar(&cfg.clients, "clients", 40, "number of WebSocket connections")
+	flag.DurationVar(&cfg.duration, "duration", 30*time.Second, "duration of the test")
+	flag.DurationVar(&cfg.ramp, "ramp", 20*time.Millisecond, "delay between opening two connections")
+	flag.StringVar(&cfg.namePrefix, "name", "loadbot", "prefix of the user names")
+	flag.Float64Var(&cfg.moveRate, "move-rate", 20, "movements (or script lines) per second per client")
+	flag.Float64Var(&cfg.bombRate, "bomb-rate", 0.2, "bombs per second per client")
+	flag.Float64Var(&cfg.chatRate, "chat-rate", 0.1, "chat messages per second per client")
+	flag.DurationVar(&cfg.pingPeriod, "ping", time.Second, "period of the latency pings")
+	flag.BoolVar(&cfg.startGame, "start", true, "get ready to start the game in every room")
+	flag.StringVar(&scriptFile, "script", "", "file with one WebSocket message per line to replay instead of random actions")
+	flag.Parse()
+
+	if scriptFile != "" {
+		script, err := readScript(scriptFile)
+		if err != nil {
+			log.Fatalf("loadbot: cannot read the script: %v", err)
+		}
+		cfg.script = script
+	}
+
+	stats := newStats()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Stop on Ctrl+C or when the duration is over
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		select {
+		case <-interrupt:
+		case <-time.After(cfg.duration):
+		}
+		close(stop)
+	}()
+
+	log.Printf("loadbot: opening %d connections to %s for %s", cfg.clients, cfg.addr, cfg.duration)
+	started := time.Now()
+	runID := started.Unix() % 100000
+
+opening:
+	for i := 0; i < cfg.clients; i++ {
+		client := newLoadClient(cfg, fmt.Sprintf("%s-%d-%d", cfg.namePrefix, runID, i), stats)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.run(stop)
+		}()
+
+		select {
+		case <-stop:
+			break opening
+		case <-time.After(cfg.ramp):
+		}
+	}
+
+	wg.Wait()
+	stats.report(os.Stdout, time.Since(started))
+}
+
+// readScript reads the WebSocket messages of a script file, skipping the empty lines.
+// The messages are validated as the server does, so a wrong script fails before the test.
+func readScript(fileName string) ([]webmodel.WSMessage, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var script []webmodel.WSMessage
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var message webmodel.WSMessage
+		if err := json.Unmarshal([]byte(text), &message); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if _, err := webmodel.DecodeMessage(message); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		script = append(script, message)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(script) == 0 {
+		return nil, fmt.Errorf("no messages in %s", fileName)
+	}
+	return script, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// stats collects the results of all clients of the load test. It is safe for concurrent use.
+type stats struct {
+	sync.Mutex
+
+	connected     int // Connections opened.
+	connectFailed int // Connections that could not be opened.
+	disconnects   int // Connections closed by the server before the end of the test.
+
+	sent         int // Messages sent to the server.
+	received     int // Messages received from the server.
+	errorReplies int // Messages with the error result.
+
+	chatSent      int // Chat messages sent.
+	chatExpected  int // Deliveries expected: the size of the sender's room for every chat message sent.
+	chatDelivered int // Chat messages received, counted by the receivers.
+
+	stateUpdates int // State updates received.
+
+	pingRTT     []time.Duration // Round-trip times of the application-level pings.
+	chatLatency []time.Duration // Time between sending a chat message and receiving it back.
+}
+
+// newStats creates empty statistics.
+func newStats() *stats {
+	return &stats{}
+}
+
+// add changes a counter of the statistics under the lock.
+func (s *stats) add(counter *int, delta int) {
+	s.Lock()
+	defer s.Unlock()
+	*counter += delta
+}
+
+// addLatency adds a sample to a latency series under the lock.
+func (s *stats) addLatency(series *[]time.Duration, sample time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	*series = append(*series, sample)
+}
+
+// report prints the statistics.
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	seconds := elapsed.Seconds()
+	fmt.Fprintf(w, "\n=== loadbot report (%s) ===\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "connections:    %d opened, %d failed, %d disconnected by the server\n", s.connected, s.connectFailed, s.disconnects)
+	fmt.Fprintf(w, "messages:       %d sent (%.0f/s), %d received (%.0f/s), %d error replies\n",
+		s.sent, float64(s.sent)/seconds, s.received, float64(s.received)/seconds, s.errorReplies)
+	fmt.Fprintf(w, "state updates:  %d received\n", s.stateUpdates)
+	// The rooms change while the messages are on their way, so the dropped deliveries are an estimate.
+	dropped := max(s.chatExpected-s.chatDelivered, 0)
+	fmt.Fprintf(w, "chat:           %d sent, %d of %d deliveries, about %d dropped", s.chatSent, s.chatDelivered, s.chatExpected, dropped)
+	if s.chatExpected != 0 {
+		fmt.Fprintf(w, " (%.2f%%)", 100*float64(dropped)/float64(s.chatExpected))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "ping RTT:       %s\n", percentiles(s.pingRTT))
+	fmt.Fprintf(w, "chat latency:   %s\n", percentiles(s.chatLatency))
+}
+
+// percentiles formats the count, the median, the 90th and 99th percentiles and the maximum of the samples.
+func percentiles(samples []time.Duration) string {
+	if len(samples) == 0 {
+		return "no samples"
+	}
+
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	at := func(p float64) time.Duration {
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+	return fmt.Sprintf("n=%d p50=%s p90=%s p99=%s max=%s",
+		len(sorted), at(0.5), at(0.9), at(0.99), sorted[len(sorted)-1])
+}
@@ -0,0 +1,37 @@
+// Command schemagen writes the JSON Schema of the WebSocket messages the clients can send,
+// generated from the message registry of the webmodel package (see webmodel.MessagesJSONSchema).
+// The frontend requests can be checked against it with any JSON Schema validator.
+//
+// Usage:
+//
+//	go run ./cmd/schemagen -o ../frontend/schema/messages.schema.json
+//	go generate ./webmodel
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+func main() {
+	output := flag.String("o", "", "file to write the schema to, standard output if empty")
+	flag.Parse()
+
+	schema, err := json.MarshalIndent(webmodel.MessagesJSONSchema(), "", "  ")
+	if err != nil {
+		log.Fatalf("schemagen: %v", err)
+	}
+	schema = append(schema, '\n')
+
+	if *output == "" {
+		os.Stdout.Write(schema)
+		return
+	}
+	if err := os.WriteFile(*output, schema, 0o644); err != nil {
+		log.Fatalf("schemagen: %v", err)
+	}
+}
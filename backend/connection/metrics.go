@@ -0,0 +1,82 @@
+package wsconnection
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// MessageMetrics are the statistics of the handled messages of one type.
+type MessageMetrics struct {
+	Handled   int64         `json:"handled"`   // Number of handled messages.
+	Errors    int64         `json:"errors"`    // Number of messages whose handling failed, excluding the bad requests.
+	Panics    int64         `json:"panics"`    // Number of messages whose handler panicked.
+	TotalTime time.Duration `json:"totalTime"` // Total handling time, in nanoseconds.
+	MaxTime   time.Duration `json:"maxTime"`   // Longest handling time, in nanoseconds.
+}
+
+// Metrics collects the statistics of the handled messages by type. It is safe for concurrent use;
+// a nil *Metrics records nothing.
+type Metrics struct {
+	sync.Mutex
+	messages map[string]*MessageMetrics
+}
+
+// NewMetrics creates empty metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{messages: make(map[string]*MessageMetrics)}
+}
+
+// of returns the statistics of a message type. It must be called with the metrics locked.
+func (m *Metrics) of(messageType string) *MessageMetrics {
+	stats, ok := m.messages[messageType]
+	if !ok {
+		stats = &MessageMetrics{}
+		m.messages[messageType] = stats
+	}
+	return stats
+}
+
+// record adds a handled message with its handling time and error to the metrics.
+func (m *Metrics) record(messageType string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+
+	stats := m.of(messageType)
+	stats.Handled++
+	if err != nil && !errors.Is(err, webmodel.ErrWarning) {
+		stats.Errors++
+	}
+	stats.TotalTime += duration
+	stats.MaxTime = max(stats.MaxTime, duration)
+}
+
+// recordPanic counts a panic of the handler of a message type.
+func (m *Metrics) recordPanic(messageType string) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.of(messageType).Panics++
+}
+
+// Snapshot returns a copy of the statistics by message type.
+func (m *Metrics) Snapshot() map[string]MessageMetrics {
+	snapshot := make(map[string]MessageMetrics)
+	if m == nil {
+		return snapshot
+	}
+	m.Lock()
+	defer m.Unlock()
+
+	for messageType, stats := range m.messages {
+		snapshot[messageType] = *stats
+	}
+	return snapshot
+}
@@ -0,0 +1,132 @@
+package wsconnection
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// Middleware wraps a Replier to add a cross-cutting behaviour (logging, rate limiting, guards, ...).
+// A middleware calls `next.SendReply` to handle the message, or replies itself to stop the handling.
+type Middleware func(next Replier) Replier
+
+// ErrKicked is returned by a middleware when the connection must be closed.
+var ErrKicked = errors.New("client kicked")
+
+// Chain wraps the replier with the middlewares; the first middleware is the outermost one,
+// i.e. it sees the message first.
+func Chain(replier Replier, middlewares ...Middleware) Replier {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		replier = middlewares[i](replier)
+	}
+	return replier
+}
+
+// Use adds middlewares applied to the messages of all types, including the types registered later.
+// The global middlewares run before the middlewares of the route.
+func (mux *WSmux) Use(middlewares ...Middleware) {
+	mux.middlewares = append(mux.middlewares, middlewares...)
+}
+
+// Handle registers the replier of a message type, wrapped with the middlewares of the route.
+func (mux *WSmux) Handle(messageType string, replier Replier, middlewares ...Middleware) {
+	if mux.WShandlers == nil {
+		mux.WShandlers = make(map[string]Replier)
+	}
+	mux.WShandlers[messageType] = Chain(replier, middlewares...)
+}
+
+// replier returns the replier of a message type wrapped with the global middlewares.
+func (mux *WSmux) replier(messageType string) (Replier, bool) {
+	replier, ok := mux.WShandlers[messageType]
+	if !ok {
+		return nil, false
+	}
+	return Chain(replier, mux.middlewares...), true
+}
+
+// Recovering recovers the panics of the handlers, so a failing handler closes only the connection
+// of its client instead of the whole server. The panic is logged with its stack, counted
+// in the metrics and reported to the client as an ERROR message.
+func Recovering(next Replier) Replier {
+	return FuncReplier(func(currConnection *UsersConnection, message webmodel.WSMessage) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				currConnection.WsServer.Metrics.recordPanic(message.Type)
+				// WSError logs the error with the stack of the panic
+				err = currConnection.WSError(message, fmt.Sprintf("handling '%s' failed", message.Type), fmt.Errorf("panic: %v", r))
+			}
+		}()
+		return next.SendReply(currConnection, message)
+	})
+}
+
+// Measuring records the number of handled messages, the errors and the handling time in the metrics of the mux.
+func Measuring(next Replier) Replier {
+	return FuncReplier(func(currConnection *UsersConnection, message webmodel.WSMessage) error {
+		start := time.Now()
+		err := next.SendReply(currConnection, message)
+		currConnection.WsServer.Metrics.record(message.Type, time.Since(start), err)
+		return err
+	})
+}
+
+// Logging logs every handled message with the time it took and the error, if any.
+func Logging(next Replier) Replier {
+	return FuncReplier(func(currConnection *UsersConnection, message webmodel.WSMessage) error {
+		start := time.Now()
+		err := next.SendReply(currConnection, message)
+		if err != nil && !errors.Is(err, webmodel.ErrWarning) {
+			currConnection.WsServer.ErrLog.Printf("websocket:: '%s' from '%s' failed in %s: %v", message.Type, currConnection.Client.UserName, time.Since(start), err)
+		} else {
+			currConnection.WsServer.InfoLog.Printf("websocket:: '%s' from '%s' handled in %s", message.Type, currConnection.Client.UserName, time.Since(start))
+		}
+		return err
+	})
+}
+
+// RateLimiting throttles the clients exceeding the rate limits of the mux (see WSmux.RateLimits)
+// with a bad request reply, and kicks them if they keep doing it.
+func RateLimiting(next Replier) Replier {
+	return FuncReplier(func(currConnection *UsersConnection, message webmodel.WSMessage) error {
+		allowed, kick := currConnection.allowMessage(message.Type)
+		if kick {
+			currConnection.kickForFlooding()
+			return ErrKicked
+		}
+		if !allowed {
+			return currConnection.WSBadRequest(message, "too many messages, slow down")
+		}
+		return next.SendReply(currConnection, message)
+	})
+}
+
+// Decoding decodes and validates the payload of the message with the schema of its type (see webmodel.DecodeMessage),
+// and rejects the malformed messages with a bad request reply saying what is wrong.
+// The handlers find the decoded payload in `message.Data`.
+func Decoding(next Replier) Replier {
+	return FuncReplier(func(currConnection *UsersConnection, message webmodel.WSMessage) error {
+		data, err := webmodel.DecodeMessage(message)
+		if err != nil {
+			if errors.Is(err, webmodel.ErrInvalidRequestID) {
+				// The invalid ID is not echoed
+				message.ID = ""
+			}
+			return currConnection.WSBadRequest(message, err.Error())
+		}
+		message.Data = data
+		return next.SendReply(currConnection, message)
+	})
+}
+
+// DuringGame rejects the messages sent while the game is not running in the client's room.
+func DuringGame(next Replier) Replier {
+	return FuncReplier(func(currConnection *UsersConnection, message webmodel.WSMessage) error {
+		if !currConnection.Client.Room.State.Running() {
+			return currConnection.WSBadRequest(message, "the game is not running")
+		}
+		return next.SendReply(currConnection, message)
+	})
+}
@@ -0,0 +1,107 @@
+package wsconnection
+
+import "time"
+
+// Constants of the flood protection.
+const (
+	CLOSE_FLOODING = 4002 // WebSocket close code sent to the clients kicked for flooding.
+
+	KICK_AFTER_VIOLATIONS = 30               // A client exceeding the limits this many times within VIOLATION_WINDOW is kicked.
+	VIOLATION_WINDOW      = 10 * time.Second // The period the violations are counted in.
+)
+
+// RateLimit is a token-bucket limit of the messages of one type:
+// `Rate` messages per second on average, with bursts of up to `Burst` messages.
+// The zero RateLimit means no limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// tokenBucket counts the messages of one type received from a connection.
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64   // Messages which can be received now.
+	last   time.Time // The last time the tokens were refilled.
+}
+
+// allow takes a token from the bucket; it returns false if the bucket is empty.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// rateLimiter holds the token buckets of a connection and counts its violations.
+// It is used by the ReadPump goroutine only.
+type rateLimiter struct {
+	buckets     map[string]*tokenBucket
+	violations  int       // Violations since windowStart.
+	windowStart time.Time // Start of the current violation window.
+}
+
+// limitFor returns the limit of a message type: the limit configured for the type in the mux,
+// or its DefaultRateLimit.
+func (mux *WSmux) limitFor(messageType string) RateLimit {
+	if limit, ok := mux.RateLimits[messageType]; ok {
+		return limit
+	}
+	return mux.DefaultRateLimit
+}
+
+/*
+allowMessage checks the message against the rate limit of its type.
+
+Returns:
+  - allowed: true if the message can be handled;
+  - kick: true if the client exceeded the limits KICK_AFTER_VIOLATIONS times within VIOLATION_WINDOW.
+*/
+func (uc *UsersConnection) allowMessage(messageType string) (allowed bool, kick bool) {
+	limit := uc.WsServer.limitFor(messageType)
+	if limit.Rate <= 0 {
+		return true, false
+	}
+
+	now := time.Now()
+	if uc.limiter == nil {
+		uc.limiter = &rateLimiter{buckets: make(map[string]*tokenBucket), windowStart: now}
+	}
+	bucket, ok := uc.limiter.buckets[messageType]
+	if !ok {
+		// A new connection starts with a full bucket
+		bucket = &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		uc.limiter.buckets[messageType] = bucket
+	}
+	if bucket.allow(now) {
+		return true, false
+	}
+	return false, uc.limiter.violate(now)
+}
+
+// violate counts a violation in the current window, or in a new one if VIOLATION_WINDOW passed since its start.
+// It returns true if the client reached KICK_AFTER_VIOLATIONS violations within the window.
+func (l *rateLimiter) violate(now time.Time) bool {
+	if now.Sub(l.windowStart) > VIOLATION_WINDOW {
+		l.windowStart = now
+		l.violations = 0
+	}
+	l.violations++
+	return l.violations >= KICK_AFTER_VIOLATIONS
+}
+
+// kickForFlooding closes the connection of a client who keeps exceeding the rate limits.
+func (uc *UsersConnection) kickForFlooding() {
+	const reason = "too many messages"
+	uc.WsServer.ErrLog.Printf("kicking client '%s' of room '%s': %s", uc.Client.UserName, uc.Client.Room, reason)
+
+	// WritePump writes the close message and closes the connection.
+	uc.Client.Close(CLOSE_FLOODING, reason)
+}
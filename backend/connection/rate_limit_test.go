@@ -0,0 +1,113 @@
+package wsconnection
+
+import (
+	"testing"
+	"time"
+)
+
+// fullBucket returns a bucket with the given limit, full at `start`, as for a new connection.
+func fullBucket(limit RateLimit, start time.Time) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: start}
+}
+
+func TestTokenBucketAllowsBursts(t *testing.T) {
+	start := time.Unix(1000, 0)
+	bucket := fullBucket(RateLimit{Rate: 2, Burst: 5}, start)
+
+	for i := 1; i <= 5; i++ {
+		if !bucket.allow(start) {
+			t.Fatalf("message %d of the burst was refused", i)
+		}
+	}
+	if bucket.allow(start) {
+		t.Error("a message over the burst was allowed")
+	}
+}
+
+func TestTokenBucketRefills(t *testing.T) {
+	start := time.Unix(1000, 0)
+	bucket := fullBucket(RateLimit{Rate: 2, Burst: 5}, start)
+	for i := 0; i < 5; i++ {
+		bucket.allow(start)
+	}
+
+	// 2 messages per second: a token is back after half a second, not before
+	if bucket.allow(start.Add(400 * time.Millisecond)) {
+		t.Error("a message was allowed before a token was refilled")
+	}
+	if !bucket.allow(start.Add(500 * time.Millisecond)) {
+		t.Error("a message was refused after a token was refilled")
+	}
+
+	// A long pause refills the bucket up to the burst only
+	later := start.Add(time.Minute)
+	for i := 1; i <= 5; i++ {
+		if !bucket.allow(later) {
+			t.Fatalf("message %d of the burst after a pause was refused", i)
+		}
+	}
+	if bucket.allow(later) {
+		t.Error("the bucket was refilled over the burst")
+	}
+}
+
+func TestRateLimiterKicksAfterTooManyViolations(t *testing.T) {
+	start := time.Unix(1000, 0)
+	limiter := &rateLimiter{windowStart: start}
+
+	for i := 1; i < KICK_AFTER_VIOLATIONS; i++ {
+		if limiter.violate(start.Add(time.Duration(i) * time.Millisecond)) {
+			t.Fatalf("kicked after %d violations, want %d", i, KICK_AFTER_VIOLATIONS)
+		}
+	}
+	if !limiter.violate(start.Add(VIOLATION_WINDOW)) {
+		t.Errorf("not kicked after %d violations within the window", KICK_AFTER_VIOLATIONS)
+	}
+}
+
+func TestRateLimiterResetsTheViolationWindow(t *testing.T) {
+	start := time.Unix(1000, 0)
+	limiter := &rateLimiter{windowStart: start}
+
+	for i := 1; i < KICK_AFTER_VIOLATIONS; i++ {
+		limiter.violate(start)
+	}
+	// The violations of the previous window are forgotten
+	next := start.Add(VIOLATION_WINDOW + time.Millisecond)
+	if limiter.violate(next) {
+		t.Fatal("kicked for the violations of the previous window")
+	}
+	if limiter.violations != 1 || !limiter.windowStart.Equal(next) {
+		t.Errorf("got %d violations in the window started at %v, want 1 in the window started at %v", limiter.violations, limiter.windowStart, next)
+	}
+	for i := 2; i < KICK_AFTER_VIOLATIONS; i++ {
+		if limiter.violate(next) {
+			t.Fatalf("kicked after %d violations in the new window", i)
+		}
+	}
+	if !limiter.violate(next.Add(VIOLATION_WINDOW)) {
+		t.Errorf("not kicked after %d violations in the new window", KICK_AFTER_VIOLATIONS)
+	}
+}
+
+func TestFloodingClientIsKicked(t *testing.T) {
+	// A client sending a message every millisecond to a type limited to 1 message per second
+	start := time.Unix(1000, 0)
+	bucket := fullBucket(RateLimit{Rate: 1, Burst: 3}, start)
+	limiter := &rateLimiter{windowStart: start}
+
+	violations := 0
+	for i := 0; i < 1000; i++ {
+		now := start.Add(time.Duration(i) * time.Millisecond)
+		if bucket.allow(now) {
+			continue
+		}
+		violations++
+		if limiter.violate(now) {
+			break
+		}
+	}
+	if violations != KICK_AFTER_VIOLATIONS {
+		t.Errorf("kicked after %d refused messages, want %d", violations, KICK_AFTER_VIOLATIONS)
+	}
+}
@@ -1,10 +1,14 @@
 package wsconnection
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/Pomog/bomberman/backend/helpers"
 	"github.com/Pomog/bomberman/backend/webmodel"
 	"io"
+	"runtime/debug"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -16,6 +20,8 @@ const (
 	pongWait       = 60 * time.Second    // Time allowed to read the next pong message from the peer.
 	pingPeriod     = (pongWait * 9) / 10 // Send pings to peer with this period. Must be less than pongWait.
 	maxMessageSize = 4096                // Maximum message size allowed from peer.
+
+	latencyPingPeriod = 2 * time.Second // Send application-level pings to measure the round-trip time with this period.
 )
 
 var NewLine = []byte("\n") // Used for separating messages.
@@ -24,13 +30,25 @@ var NewLine = []byte("\n") // Used for separating messages.
 // It receives messages, processes them, and handles any errors that may occur, such as unexpected disconnections.
 func (uc *UsersConnection) ReadPump() {
 	defer func() {
+		// A panic outside of the handlers (they are recovered by the Recovering middleware)
+		// closes this connection only.
+		if r := recover(); r != nil {
+			uc.WsServer.ErrLog.Printf("ReadPump: PANIC on connection %p: %v\nStack: %s", uc.Client.Conn, r, debug.Stack())
+		}
+
 		// Clean up when the connection is closed.
 		err := uc.deleteClientAndSendUserOffline()
 		if err != nil {
 			uc.WsServer.ErrLog.Printf("ReadPump: error client delete: %v", err)
 		}
 
-		close(uc.Client.ReceivedMessages)
+		if uc.Client.Closed() {
+			// The client was closed by the server, e.g. kicked: WritePump writes the close message
+			// with the reason, then closes the connection.
+			uc.WsServer.InfoLog.Printf("ReadPump leaves connection %p to WritePump, the client was closed", uc.Client.Conn)
+			return
+		}
+		uc.Client.Close(websocket.CloseNormalClosure, "")
 		err = uc.Client.Conn.Close()
 		uc.WsServer.InfoLog.Printf("ReadPump closed connection %p because: %s", uc.Client.Conn, err)
 	}()
@@ -40,15 +58,18 @@ func (uc *UsersConnection) ReadPump() {
 	uc.Client.Conn.SetReadDeadline(time.Now().Add(pongWait))
 
 	// Set pong handler to reset the read deadline upon receiving a pong message.
-	uc.Client.Conn.SetPongHandler(func(string) error {
+	// The pong carries the time the ping was sent, which gives a round-trip time sample.
+	uc.Client.Conn.SetPongHandler(func(appData string) error {
 		uc.Client.Conn.SetReadDeadline(time.Now().Add(pongWait))
+		if nonce, err := strconv.ParseUint(appData, 10, 64); err == nil {
+			uc.Client.Latency.CompletePing(nonce)
+		}
 		return nil
 	})
 
 	for {
-		var message webmodel.WSMessage
-		err := uc.Client.Conn.ReadJSON(&message)
-		uc.WsServer.InfoLog.Printf("Message received from js: %s\n ", message)
+		message, err := uc.readMessage()
+		uc.WsServer.InfoLog.Printf("Message received from js: %s\n ", &message)
 
 		if err != nil {
 			// Handle unexpected connection closures.
@@ -59,10 +80,10 @@ func (uc *UsersConnection) ReadPump() {
 			break
 		}
 
-		// Find the appropriate message handler for the message type.
-		replier, ok := uc.WsServer.WShandlers[message.Type]
+		// Find the appropriate message handler for the message type, wrapped with the middlewares.
+		replier, ok := uc.WsServer.replier(message.Type)
 		if !ok {
-			uc.WsServer.ErrLog.Printf("unknown type message received: %s", message.Type)
+			uc.WSBadRequest(message, fmt.Sprintf("%v '%s'", webmodel.ErrUnknownMessageType, message.Type))
 			continue
 		}
 
@@ -78,8 +99,10 @@ func (uc *UsersConnection) ReadPump() {
 // It writes messages from the hub to the client and sends periodic pings to keep the connection alive.
 func (uc *UsersConnection) WritePump() {
 	ticker := time.NewTicker(pingPeriod)
+	latencyTicker := time.NewTicker(latencyPingPeriod)
 	defer func() {
 		ticker.Stop()
+		latencyTicker.Stop()
 		err := uc.Client.Conn.Close()
 		if err != nil {
 			uc.WsServer.InfoLog.Printf("WritePump: error closing connection: %v", err)
@@ -88,47 +111,113 @@ func (uc *UsersConnection) WritePump() {
 		}
 	}()
 	for {
-		chann := uc.Client.ReceivedMessages
 		select {
-		case message, ok := <-chann:
-			uc.WsServer.InfoLog.Printf("write message %s\n", message)
-			if !ok {
-				// The hub closed the channel, so close the connection.
-				uc.Client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				uc.WsServer.InfoLog.Printf("WritePump is closing connection because the hub closed the channel %p ", chann)
-				return
-			}
+		case <-uc.Client.Ready():
+			messages, closed := uc.Client.TakeMessages()
 
-			// Set write deadline and begin sending the message.
-			uc.Client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			w, err := uc.Client.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				uc.WsServer.ErrLog.Printf("cannot create the NextWriter on the connection %p : %v", uc.Client.Conn, err)
+			// Send the queued messages, the control messages first.
+			if err := uc.writeQueuedMessages(messages); err != nil {
+				uc.WsServer.ErrLog.Printf("cannot write to the connection %p : %v", uc.Client.Conn, err)
 				return
 			}
-			uc.writeMessage(w, message)
-
-			// Write any additional messages queued in the channel.
-			n := len(chann)
-			for i := 0; i < n; i++ {
-				message = <-chann
-				uc.writeMessage(w, message)
-			}
 
-			// Close the writer after sending all the messages.
-			if err := w.Close(); err != nil {
-				uc.WsServer.ErrLog.Printf("cannot close the writer on the connection %p : %v", uc.Client.Conn, err)
+			if closed {
+				// The client was closed, so close the connection with the reason.
+				code, reason := uc.Client.CloseReason()
+				uc.Client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+				uc.Client.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+				uc.WsServer.InfoLog.Printf("WritePump is closing connection because the client was closed: %d %s", code, reason)
 				return
 			}
 		case <-ticker.C:
 			// Send periodic ping messages to keep the connection alive.
+			// The ping carries a nonce, so the pong can be used to measure the round-trip time.
 			uc.Client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := uc.Client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			nonce := strconv.FormatUint(uc.Client.Latency.StartPing(), 10)
+			if err := uc.Client.Conn.WriteMessage(websocket.PingMessage, []byte(nonce)); err != nil {
 				uc.WsServer.ErrLog.Printf("ping the connection %s failed: %v", uc.Client.Conn.LocalAddr(), err)
 				return
 			}
+		case <-latencyTicker.C:
+			// Send an application-level ping, the client replies with a `pong` message.
+			if err := uc.writeLatencyPing(); err != nil {
+				uc.WsServer.ErrLog.Printf("latency ping of the connection %s failed: %v", uc.Client.Conn.LocalAddr(), err)
+				return
+			}
+		}
+	}
+}
+
+// writeLatencyPing writes an application-level `ping` message with a nonce and the current server time.
+// It is written directly to the connection, so it is not delayed by the queued messages.
+func (uc *UsersConnection) writeLatencyPing() error {
+	ping, err := webmodel.CreateJSONMessage(webmodel.Ping, webmodel.SUCCESS_RESULT,
+		webmodel.LatencyPing{Nonce: uc.Client.Latency.StartPing(), ServerTime: time.Now().UnixMilli()})
+	if err != nil {
+		return err
+	}
+	uc.Client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return uc.Client.Conn.WriteMessage(websocket.TextMessage, ping)
+}
+
+// readMessage reads the next message from the WebSocket connection.
+// Text messages are decoded from JSON; binary messages are decoded with the compact binary schema
+// of the game messages (see webmodel.DecodeBinaryMessage).
+func (uc *UsersConnection) readMessage() (webmodel.WSMessage, error) {
+	var message webmodel.WSMessage
+	messageType, data, err := uc.Client.Conn.ReadMessage()
+	if err != nil {
+		return message, err
+	}
+
+	if messageType == websocket.BinaryMessage {
+		return webmodel.DecodeBinaryMessage(data)
+	}
+	err = json.Unmarshal(data, &message)
+	return message, err
+}
+
+// writeQueuedMessages writes the messages taken from the client's queue, in their order.
+// Consecutive JSON messages are joined in one text frame, separated by new lines.
+// Every binary message is sent in its own binary frame.
+func (uc *UsersConnection) writeQueuedMessages(messages [][]byte) error {
+	var w io.WriteCloser
+	var err error
+
+	for _, message := range messages {
+		// Set write deadline and begin sending the message.
+		uc.Client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if webmodel.IsBinaryMessage(message) {
+			// Finish the current text frame before sending the binary one.
+			if w != nil {
+				if err = w.Close(); err != nil {
+					return fmt.Errorf("cannot close the writer: %v", err)
+				}
+				w = nil
+			}
+			if err = uc.Client.Conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
+				return fmt.Errorf("cannot write a binary message: %v", err)
+			}
+		} else {
+			if w == nil {
+				w, err = uc.Client.Conn.NextWriter(websocket.TextMessage)
+				if err != nil {
+					return fmt.Errorf("cannot create the NextWriter: %v", err)
+				}
+			}
+			if err = uc.writeMessage(w, message); err != nil {
+				return fmt.Errorf("cannot write a text message: %v", err)
+			}
 		}
 	}
+
+	// Close the writer after sending all the messages.
+	if w != nil {
+		if err = w.Close(); err != nil {
+			return fmt.Errorf("cannot close the writer: %v", err)
+		}
+	}
+	return nil
 }
 
 // writeMessage writes a message to the WebSocket connection.
@@ -148,9 +237,13 @@ func (uc *UsersConnection) writeMessage(w io.WriteCloser, message []byte) error
 // deleteClientAndSendUserOffline handles removing a client from the server's hub and notifying the system that the user has gone offline.
 func (uc *UsersConnection) deleteClientAndSendUserOffline() error {
 	uc.WsServer.Hub.UnRegisterClientFromHub(uc.Client)
+	uc.Client.Room.State.RemovePlayer(uc.Client.UserName)
 	if uc.Client.UserName != "" {
 		// Send user quit message to inform the system.
-		err := uc.WsServer.WShandlers[webmodel.UserQuitChat].SendReply(uc, webmodel.WSMessage{Type: webmodel.UserQuitChat, Payload: nil})
+		// The quit is not sent by the client, so it is not rate-limited nor decoded,
+		// but a panic of its handler is recovered and the handling is measured and logged as for the messages.
+		quit := Chain(uc.WsServer.WShandlers[webmodel.UserQuitChat], Recovering, Measuring, Logging)
+		err := quit.SendReply(uc, webmodel.WSMessage{Type: webmodel.UserQuitChat, Payload: nil})
 		return err
 	}
 	return nil
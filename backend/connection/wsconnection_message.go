@@ -11,7 +11,8 @@ import (
 // WSError sends an error message to the front-end WebSocket connection (`conn`)
 // and logs the error details along with the debug stack trace. It creates a JSON
 // message of type 'ERROR' and sends it via the WebSocket connection.
-func (uc *UsersConnection) WSError(errMessage string, err error) error {
+// The message replies to `requestMessage` with its ID; it is pushed if `requestMessage` is the zero WSMessage.
+func (uc *UsersConnection) WSError(requestMessage webmodel.WSMessage, errMessage string, err error) error {
 	// Retrieve the function name from the caller for better error context.
 	funcName := ""
 	pc, _, _, ok := runtime.Caller(1)
@@ -26,13 +27,13 @@ func (uc *UsersConnection) WSError(errMessage string, err error) error {
 	uc.WsServer.ErrLog.Output(2, fmt.Sprintf("websocket:: ERROR: %s: %v\nDebug Stack:  %s", errMessage, err, debug.Stack()))
 
 	// Create a JSON message containing the error message to send to the client.
-	wsMessage, err := webmodel.CreateJSONMessage(webmodel.ERROR_TYPE, "serverError", errMessage)
-	if err != nil {
+	wsMessage, createErr := requestMessage.CreateServerErrorMessage(errMessage)
+	if createErr != nil {
 		// If message creation fails, send a plain error message to the client and log it.
-		errText := fmt.Sprintf("websocket:: WSError:can't create serverError WSmessage: %v", err)
+		errText := fmt.Sprintf("websocket:: WSError:can't create serverError WSmessage: %v", createErr)
 		uc.Client.WriteMessage([]byte(`"` + errText + `"`))
 		uc.WsServer.ErrLog.Output(2, fmt.Sprintf("%s\nDebug Stack:  %s", errText, debug.Stack()))
-		return fmt.Errorf("%s: %#v", errText, err)
+		return fmt.Errorf("%s: %#v", errText, createErr)
 	}
 	// Send the created error message to the WebSocket client.
 	uc.Client.WriteMessage(wsMessage)
@@ -42,8 +43,8 @@ func (uc *UsersConnection) WSError(errMessage string, err error) error {
 
 // WSErrCreateMessage handles error message creation for WebSocket communication.
 // It wraps WSError with a more specific error message for the WebSocket client.
-func (uc *UsersConnection) WSErrCreateMessage(err error) error {
-	return uc.WSError("creating message to websocket failed", err)
+func (uc *UsersConnection) WSErrCreateMessage(requestMessage webmodel.WSMessage, err error) error {
+	return uc.WSError(requestMessage, "creating message to websocket failed", err)
 }
 
 // WSBadRequest sends a "Bad Request" message to the WebSocket connection.
@@ -10,6 +10,10 @@ import (
 type UsersConnection struct {
 	Client   *websocket_hub.Client // Represents the WebSocket client associated with the user
 	WsServer WSmux                 // WebSocket server that handles multiple WebSocket connections
+
+	ProtocolVersion int // The protocol version negotiated on join (see webmodel.ParseProtocolVersion)
+
+	limiter *rateLimiter // Rate limits of the messages received from the user, created on the first message
 }
 
 /*
@@ -22,7 +26,7 @@ func (uc *UsersConnection) SendReply(requestMessage webmodel.WSMessage, data any
 	wsMessage, err := requestMessage.CreateReplyToRequestMessage(webmodel.SUCCESS_RESULT, data)
 	if err != nil {
 		// If message creation fails, create and send an error message
-		return uc.WSErrCreateMessage(err)
+		return uc.WSErrCreateMessage(requestMessage, err)
 	}
 
 	// Send the created message to the WebSocket client
@@ -42,7 +46,7 @@ func (uc *UsersConnection) SendSuccessMessage(messageType string, data any) (jso
 	wsMessage, err := webmodel.CreateJSONMessage(messageType, webmodel.SUCCESS_RESULT, data)
 	if err != nil {
 		// If message creation fails, create and send an error message
-		return wsMessage, uc.WSErrCreateMessage(err)
+		return wsMessage, uc.WSErrCreateMessage(webmodel.WSMessage{}, err)
 	}
 
 	// Send the created message to the WebSocket client
@@ -52,30 +56,57 @@ func (uc *UsersConnection) SendSuccessMessage(messageType string, data any) (jso
 
 /*
 SendMessageToClientRoom sends a successful message of type `messageType` with `data` as the payload to the WebSocket client's room.
-It returns the message in JSON format and a map that indicates whether the message was successfully sent to each client in the room.
+It returns the message in JSON format and a channel receiving the map that indicates whether the message was successfully sent
+to each client in the room; the message is queued without waiting for it.
 If message creation fails, it calls `WSErrCreateMessage` to handle the error.
 */
-func (uc *UsersConnection) SendMessageToClientRoom(messageType string, data any) (json.RawMessage, map[string]bool, error) {
+func (uc *UsersConnection) SendMessageToClientRoom(messageType string, data any) (json.RawMessage, <-chan map[string]bool, error) {
 	// Create a successful message for the room with the provided type and data
 	wsMessage, err := webmodel.CreateJSONMessage(messageType, webmodel.SUCCESS_RESULT, data)
 	if err != nil {
 		// If message creation fails, create and send an error message
-		return wsMessage, nil, uc.WSErrCreateMessage(err)
+		return wsMessage, nil, uc.WSErrCreateMessage(webmodel.WSMessage{}, err)
 	}
 
-	// Send the message to the room and get the map indicating the success of message sending
-	sentMarksMap := uc.SendBytesToClientRoom(wsMessage)
+	// Queue the message for the room and get the channel of the map indicating the success of message sending
+	sentMarks := uc.SendBytesToClientRoom(wsMessage)
 
-	return wsMessage, sentMarksMap, nil
+	return wsMessage, sentMarks, nil
+}
+
+/*
+SendMessageToUsersInRoom sends a successful message of type `messageType` with `data` as the payload
+to some users of the WebSocket client's room, in order with the other messages of the room.
+It returns a channel receiving the map that indicates whether the message was successfully sent to each of them.
+If message creation fails, it calls `WSErrCreateMessage` to handle the error.
+*/
+func (uc *UsersConnection) SendMessageToUsersInRoom(messageType string, data any, userNames []string) (<-chan map[string]bool, error) {
+	wsMessage, err := webmodel.CreateJSONMessage(messageType, webmodel.SUCCESS_RESULT, data)
+	if err != nil {
+		return nil, uc.WSErrCreateMessage(webmodel.WSMessage{}, err)
+	}
+	return uc.WsServer.Hub.SendMessageToUsersInRoom(wsMessage, uc.Client.Room, userNames), nil
 }
 
 /*
-SendBytesToClientRoom sends the raw byte data to the WebSocket client's room.
-It returns a map that indicates whether the message was successfully sent to each client in the room.
+SendMessageToAllRooms sends a successful message of type `messageType` with `data` as the payload
+to the users of all rooms, without waiting for the rooms to broadcast it.
+If message creation fails, it calls `WSErrCreateMessage` to handle the error.
 */
-func (uc *UsersConnection) SendBytesToClientRoom(rawData []byte) map[string]bool {
-	// Broadcast the raw message to all clients in the room and return the success map
-	sentMarksMap := uc.WsServer.Hub.BroadcastMessageInRoom(rawData, uc.Client.Room)
+func (uc *UsersConnection) SendMessageToAllRooms(messageType string, data any) error {
+	wsMessage, err := webmodel.CreateJSONMessage(messageType, webmodel.SUCCESS_RESULT, data)
+	if err != nil {
+		return uc.WSErrCreateMessage(webmodel.WSMessage{}, err)
+	}
+	uc.WsServer.Hub.BroadcastMessageToAllRooms(wsMessage)
+	return nil
+}
 
-	return sentMarksMap
+/*
+SendBytesToClientRoom queues the raw byte data for the WebSocket client's room without waiting for it to be sent.
+It returns a channel receiving the map that indicates whether the message was successfully sent to each client in the room.
+*/
+func (uc *UsersConnection) SendBytesToClientRoom(rawData []byte) <-chan map[string]bool {
+	// Queue the raw message for all clients in the room and return the channel of the success map
+	return uc.WsServer.Hub.BroadcastMessageInRoom(rawData, uc.Client.Room)
 }
@@ -23,10 +23,21 @@ type FuncReplier func(*UsersConnection, webmodel.WSMessage) error
 
 // WSmux struct is responsible for managing WebSocket handlers, logs, and connections in a hub.
 type WSmux struct {
-	// WShandlers is a map that associates message types with specific Replier handlers.
+	// WShandlers is a map that associates message types with specific Replier handlers,
+	// wrapped with the middlewares of their routes (see Handle).
 	WShandlers      map[string]Replier
 	InfoLog, ErrLog *log.Logger        // Loggers for informational and error messages
 	Hub             *websocket_hub.Hub // The WebSocket hub that manages connections and messages
+
+	// RateLimits maps message types to the limits of the messages a connection can send;
+	// the types without a limit get DefaultRateLimit.
+	RateLimits       map[string]RateLimit
+	DefaultRateLimit RateLimit
+
+	// Metrics collects the statistics of the handled messages, see the Measuring and Recovering middlewares
+	Metrics *Metrics
+
+	middlewares []Middleware // Middlewares applied to all message types, see Use
 }
 
 // SendReply method for FuncReplyCreator creates the reply data and then sends it using the current connection's SendReply method.
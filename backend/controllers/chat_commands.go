@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	wsconnection "github.com/Pomog/bomberman/backend/connection"
+	"github.com/Pomog/bomberman/backend/server"
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// COMMAND_PREFIX starts the chat messages which are commands, e.g. "/roll 2d6".
+// A message starting with two prefixes is sent as a text starting with one, e.g. "//roll".
+const COMMAND_PREFIX = "/"
+
+// Constants representing who can run a chat command.
+const (
+	PERMISSION_ANYONE = iota // Every player of the room.
+	PERMISSION_HOST          // The host of the room only (see websocket_hub.Room.Host).
+)
+
+// Constants representing who gets the reply of a chat command.
+const (
+	REPLY_TO_ISSUER = iota // The player who ran the command only.
+	REPLY_TO_ROOM          // All players of the room.
+)
+
+// Constants of the `/roll` command.
+const (
+	MAX_DICE       = 10
+	MAX_DICE_SIDES = 1000
+)
+
+// ChatCommandContext is what a chat command runs with.
+type ChatCommandContext struct {
+	App        *server.Application
+	Connection *wsconnection.UsersConnection // The connection of the player who ran the command
+	Args       []string                      // The words after the name of the command
+}
+
+// ChatCommand is a command of the chat, run on the server when a player sends "/<name> <args>" to the room channel.
+type ChatCommand struct {
+	Name        string // The name of the command, without the prefix
+	Usage       string // The syntax of the command, e.g. "/roll [NdM]"
+	Description string // What the command does, listed by `/help`
+	Permission  int    // Who can run the command, one of the PERMISSION_ constants
+	ReplyTo     int    // Who gets the reply of the command, one of the REPLY_TO_ constants
+
+	// Run runs the command and returns the text of the reply; the text is not sent if it is empty.
+	// A chatRefusal is sent to the player who ran the command, any other error is a server error.
+	Run func(ctx ChatCommandContext) (string, error)
+}
+
+// ChatCommands is the registry of the chat commands.
+type ChatCommands struct {
+	commands map[string]ChatCommand
+}
+
+// NewChatCommands creates an empty registry of chat commands.
+func NewChatCommands() *ChatCommands {
+	return &ChatCommands{commands: make(map[string]ChatCommand)}
+}
+
+// Register adds a command to the registry. It panics if a command with the same name is already registered,
+// since a registry is built once at startup.
+func (c *ChatCommands) Register(command ChatCommand) {
+	if _, ok := c.commands[command.Name]; ok {
+		panic(fmt.Sprintf("chat command '%s' is registered twice", command.Name))
+	}
+	c.commands[command.Name] = command
+}
+
+// DefaultChatCommands creates the registry of the built-in chat commands: /help, /ready, /unready, /kick, /roll and /stats.
+func DefaultChatCommands() *ChatCommands {
+	commands := NewChatCommands()
+	commands.Register(ChatCommand{
+		Name:        "help",
+		Usage:       "/help",
+		Description: "lists the chat commands",
+		Run:         commands.help,
+	})
+	commands.Register(ChatCommand{
+		Name:        "ready",
+		Usage:       "/ready",
+		Description: "tells the room you are ready to start",
+		ReplyTo:     REPLY_TO_ROOM,
+		Run:         readyCommand,
+	})
+	commands.Register(ChatCommand{
+		Name:        "unready",
+		Usage:       "/unready",
+		Description: "tells the room you are not ready anymore, before the game starts",
+		ReplyTo:     REPLY_TO_ROOM,
+		Run:         unreadyCommand,
+	})
+	commands.Register(ChatCommand{
+		Name:        "kick",
+		Usage:       "/kick <player> [reason]",
+		Description: "kicks a player out of the room",
+		Permission:  PERMISSION_HOST,
+		Run:         kickCommand,
+	})
+	commands.Register(ChatCommand{
+		Name:        "roll",
+		Usage:       "/roll [NdM]",
+		Description: "rolls N dice with M sides, one six-sided die by default",
+		ReplyTo:     REPLY_TO_ROOM,
+		Run:         rollCommand,
+	})
+	commands.Register(ChatCommand{
+		Name:        "stats",
+		Usage:       "/stats",
+		Description: "shows your player number, connection quality and lives",
+		Run:         statsCommand,
+	})
+	return commands
+}
+
+// parseCommand reads the name and the arguments of a chat command from the text of a message.
+// It reports false if the text is not a command.
+func parseCommand(text string) (name string, args []string, ok bool) {
+	if !strings.HasPrefix(text, COMMAND_PREFIX) || strings.HasPrefix(text, COMMAND_PREFIX+COMMAND_PREFIX) {
+		return "", nil, false
+	}
+	fields := strings.Fields(strings.TrimPrefix(text, COMMAND_PREFIX))
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+	return strings.ToLower(fields[0]), fields[1:], true
+}
+
+/*
+run runs the chat command of a `sendMessageToChat` message and sends its reply as a `systemMessage`
+to the player who ran it or to the room.
+
+Returns "sent", like for a chat message.
+*/
+func (c *ChatCommands) run(app *server.Application, currConnection *wsconnection.UsersConnection, message webmodel.WSMessage, name string, args []string) (any, error) {
+	command, ok := c.commands[name]
+	if !ok {
+		return nil, currConnection.WSBadRequest(message, fmt.Sprintf("unknown command '%s%s', see %shelp", COMMAND_PREFIX, name, COMMAND_PREFIX))
+	}
+	if command.Permission == PERMISSION_HOST && currConnection.Client.Room.Host() != currConnection.Client {
+		return nil, currConnection.WSBadRequest(message, fmt.Sprintf("only the room host can use %s%s", COMMAND_PREFIX, name))
+	}
+	// A muted player can't write to the room through the replies of the commands either, e.g. with /roll;
+	// the Ready button still works for /ready and /unready.
+	if command.ReplyTo == REPLY_TO_ROOM {
+		if until, muted := app.Moderator.MutedUntil(currConnection.Client.Room.ID, currConnection.Client.UserName); muted {
+			return nil, currConnection.WSBadRequest(message, fmt.Sprintf("you are muted until %s, %s%s replies to the room", until.Format(time.TimeOnly), COMMAND_PREFIX, name))
+		}
+	}
+
+	text, err := command.Run(ChatCommandContext{App: app, Connection: currConnection, Args: args})
+	var refusal chatRefusal
+	if errors.As(err, &refusal) {
+		return nil, currConnection.WSBadRequest(message, refusal.Error())
+	}
+	if err != nil {
+		return nil, currConnection.WSError(message, fmt.Sprintf("command '%s' failed", name), err)
+	}
+
+	// The command is acknowledged as a chat message, with "sent"; its reply is a system message
+	if text == "" {
+		return "sent", nil
+	}
+	reply := webmodel.ChatSystemMessage{Content: text, Command: name, UserName: currConnection.Client.UserName, DateCreate: time.Now().UTC()}
+	if command.ReplyTo == REPLY_TO_ROOM {
+		_, _, err := currConnection.SendMessageToClientRoom(webmodel.SystemMessage, reply)
+		if err != nil {
+			return nil, currConnection.WSError(message, "sending command reply to client room failed", err)
+		}
+		return "sent", nil
+	}
+	_, err = currConnection.SendSuccessMessage(webmodel.SystemMessage, reply)
+	return "sent", err
+}
+
+// help lists the commands the player can run.
+func (c *ChatCommands) help(ctx ChatCommandContext) (string, error) {
+	isHost := ctx.Connection.Client.Room.Host() == ctx.Connection.Client
+
+	names := make([]string, 0, len(c.commands))
+	for name := range c.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		command := c.commands[name]
+		if command.Permission == PERMISSION_HOST && !isHost {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", command.Usage, command.Description))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// readyCommand marks the player as ready to start, like the `readyToStart` message.
+func readyCommand(ctx ChatCommandContext) (string, error) {
+	check, err := setPlayerReady(ctx.App, ctx.Connection, true)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s is ready (%d/%d)", ctx.Connection.Client.UserName, check.Ready, check.Players), nil
+}
+
+// unreadyCommand marks the player as not ready to start, like the `setReady` message with `"ready": false`.
+func unreadyCommand(ctx ChatCommandContext) (string, error) {
+	check, err := setPlayerReady(ctx.App, ctx.Connection, false)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s is not ready (%d/%d)", ctx.Connection.Client.UserName, check.Ready, check.Players), nil
+}
+
+// kickCommand kicks a player out of the room, like the `kickPlayer` message; the room gets a `moderation` message.
+func kickCommand(ctx ChatCommandContext) (string, error) {
+	if len(ctx.Args) == 0 {
+		return "", chatRefusal("usage: /kick <player> [reason]")
+	}
+	reason := strings.Join(ctx.Args[1:], " ")
+	if len([]rune(reason)) > 200 {
+		return "", chatRefusal("the reason must be at most 200 characters")
+	}
+	_, err := kickPlayer(ctx.App, ctx.Connection, ctx.Args[0], reason)
+	return "", err
+}
+
+// rollCommand rolls dice written as NdM, e.g. "2d6", and tells the room the result.
+func rollCommand(ctx ChatCommandContext) (string, error) {
+	dice, sides := 1, 6
+	if len(ctx.Args) > 0 {
+		n, m, ok := strings.Cut(strings.ToLower(ctx.Args[0]), "d")
+		var errN, errM error
+		if n != "" {
+			dice, errN = strconv.Atoi(n)
+		}
+		sides, errM = strconv.Atoi(m)
+		if !ok || errN != nil || errM != nil || dice < 1 || dice > MAX_DICE || sides < 2 || sides > MAX_DICE_SIDES {
+			return "", chatRefusal(fmt.Sprintf("usage: /roll [NdM], with up to %d dice of up to %d sides", MAX_DICE, MAX_DICE_SIDES))
+		}
+	}
+
+	rolls := make([]string, dice)
+	total := 0
+	for i := range rolls {
+		roll := rand.Intn(sides) + 1
+		total += roll
+		rolls[i] = strconv.Itoa(roll)
+	}
+	result := fmt.Sprintf("%s rolled %dd%d: %s", ctx.Connection.Client.UserName, dice, sides, rolls[0])
+	if dice > 1 {
+		result = fmt.Sprintf("%s rolled %dd%d: %s = %d", ctx.Connection.Client.UserName, dice, sides, strings.Join(rolls, " + "), total)
+	}
+	return result, nil
+}
+
+// statsCommand shows the player's number, the quality of the connection and the lives left in the game.
+func statsCommand(ctx ChatCommandContext) (string, error) {
+	client := ctx.Connection.Client
+	user := client.User()
+	stats := fmt.Sprintf("player #%d, round-trip time %d ms, jitter %d ms", user.PlayerNumber, user.RTT, user.Jitter)
+	if player, ok := client.Room.State.Player(client.UserName); ok && player.Lives > 0 {
+		stats += fmt.Sprintf(", %d lives left", player.Lives)
+	}
+	return stats, nil
+}
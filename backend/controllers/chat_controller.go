@@ -1,49 +1,115 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/chathistory"
 	wsconnection "github.com/Pomog/bomberman/backend/connection"
-	"github.com/Pomog/bomberman/backend/parse"
+	"github.com/Pomog/bomberman/backend/moderation"
 	"github.com/Pomog/bomberman/backend/server"
 	"github.com/Pomog/bomberman/backend/webmodel"
 )
 
 // Constants defining different types of chat rooms
 const (
-	PRIVATE_CHAT_ROOM = "private" // Represents a one-on-one chat room
-	GROUP_CHAT_ROOM   = "group"   // Represents a group chat room
+	PRIVATE_CHAT_ROOM = webmodel.CHAT_CHANNEL_PRIVATE // Represents a one-on-one chat room
+	GROUP_CHAT_ROOM   = webmodel.CHAT_CHANNEL_GROUP   // Represents a group chat room
+	GLOBAL_CHAT_ROOM  = webmodel.CHAT_CHANNEL_GLOBAL  // Represents the chat room of all players, in every room
 )
 
 // ReplySendMessageToChat handles broadcasting messages to clients in a chat room.
 // This function returns a WebSocket response handler (wsconnection.FuncReplyCreator),
-// which processes incoming chat messages from a client and forwards them to the appropriate chat room.
-func ReplySendMessageToChat(app *server.Application) wsconnection.FuncReplyCreator {
+// which processes incoming chat messages from a client and forwards them to the appropriate chat room:
+// the sender's room by default, one or some players of the room, or the players of all rooms.
+// The messages of the room channel starting with COMMAND_PREFIX run the chat commands of `commands`.
+func ReplySendMessageToChat(app *server.Application, commands *ChatCommands) wsconnection.FuncReplyCreator {
 	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) (any, error) {
-		// Parse the incoming WebSocket message payload into a ChatMessage struct.
-		chatMessage, err := parse.PayloadToChatMessage(message.Payload)
-		if err != nil {
-			// Return an error if the payload format is invalid.
-			return nil, currConnection.WSError(fmt.Sprintf("Invalid payload for a chat message: '%s'", message.Payload), err)
-		}
-
-		// Validate the parsed chat message (e.g., check if required fields are present).
-		errmessage := chatMessage.Validate()
-		if errmessage != "" {
-			// Return a "bad request" error if validation fails.
-			return nil, currConnection.WSBadRequest(message, errmessage)
+		// The payload is decoded and validated as a ChatMessage before the handler runs.
+		chatMessage, ok := message.Data.(webmodel.ChatMessage)
+		if !ok {
+			return nil, currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
 		}
 
 		// Set the sender's username in the chat message (retrieved from the WebSocket connection).
 		chatMessage.UserName = currConnection.Client.UserName
+		roomID := currConnection.Client.Room.ID
+		if chatMessage.Channel == "" {
+			chatMessage.Channel = webmodel.CHAT_CHANNEL_ROOM
+		}
+
+		// A command is run instead of being sent; a muted player can run only the commands replying to the player.
+		// "//text" is sent as "/text".
+		if chatMessage.Channel == webmodel.CHAT_CHANNEL_ROOM {
+			if name, args, ok := parseCommand(chatMessage.Content); ok {
+				return commands.run(app, currConnection, message, name, args)
+			}
+			if strings.HasPrefix(chatMessage.Content, COMMAND_PREFIX+COMMAND_PREFIX) {
+				chatMessage.Content = strings.TrimPrefix(chatMessage.Content, COMMAND_PREFIX)
+			}
+		}
 
-		// Send the chat message to all clients in the sender's chat room.
-		_, _, err = currConnection.SendMessageToClientRoom(webmodel.InputChatMessage, chatMessage)
-		if err != nil {
+		// A player muted by the room host can't chat until the mute ends.
+		if until, muted := app.Moderator.MutedUntil(roomID, chatMessage.UserName); muted {
+			return nil, currConnection.WSBadRequest(message, fmt.Sprintf("you are muted until %s", until.Format(time.TimeOnly)))
+		}
+		// Mask the filtered words; the message is sent anyway.
+		if content, filtered := app.Moderator.Filter.Censor(chatMessage.Content); filtered {
+			chatMessage.Content = content
+			app.Moderator.Record(moderation.ACTION_FILTER, roomID, "", chatMessage.UserName, "")
+		}
+
+		// The server's clock orders the messages; the time of the sender's clock is kept apart.
+		// Older clients send their time as the creation date.
+		if chatMessage.ClientDate == nil && !chatMessage.DateCreate.IsZero() {
+			clientDate := chatMessage.DateCreate
+			chatMessage.ClientDate = &clientDate
+		}
+		chatMessage.MessageID, chatMessage.EditedAt = 0, nil
+
+		// The recipients must be other players of the sender's room.
+		if chatMessage.Channel == PRIVATE_CHAT_ROOM || chatMessage.Channel == GROUP_CHAT_ROOM {
+			if errMessage := validateRecipients(currConnection, chatMessage.To); errMessage != "" {
+				return nil, currConnection.WSBadRequest(message, errMessage)
+			}
+		}
+
+		// The message gets the next ID and the time of its channel as it is sent, so it can be edited and deleted,
+		// and the players get the messages of the channel in the order of their IDs.
+		// Only the messages of the room and global channels are shown to the players who join later.
+		history := channelHistory(app, currConnection, chatMessage.Channel)
+		_, err := history.Add(chatMessage, func(chatMessage webmodel.ChatMessage) error {
+			return sendToChatChannel(currConnection, chatMessage.Channel, chatMessage, webmodel.InputChatMessage, chatMessage)
+		})
+		if errors.Is(err, chathistory.ErrNotPersisted) {
+			// The message is sent and kept in memory, only its persistence failed
+			app.ErrLog.Printf("Saving chat message failed: %v", err)
+		} else if err != nil {
 			// Return an error if message broadcasting fails.
-			return nil, currConnection.WSError("sending message to client room failed", err)
+			return nil, currConnection.WSError(message, "sending message to client room failed", err)
 		}
 
 		// Return a success response ("sent") to the sender.
-		return "sent", err
+		return "sent", nil
+	}
+}
+
+// validateRecipients checks that the recipients of a private or group message are other players of the sender's room.
+// Returns an error message if validation fails, otherwise returns an empty string.
+func validateRecipients(currConnection *wsconnection.UsersConnection, recipients []string) string {
+	for i, userName := range recipients {
+		if userName == currConnection.Client.UserName {
+			return "you can't send a message to yourself"
+		}
+		if slices.Contains(recipients[:i], userName) {
+			return fmt.Sprintf("player '%s' is listed twice", userName)
+		}
+		if !currConnection.Client.Room.ContainsUser(userName) {
+			return fmt.Sprintf("player '%s' is not in your room", userName)
+		}
 	}
+	return ""
 }
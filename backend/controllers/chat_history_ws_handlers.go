@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/chathistory"
+	wsconnection "github.com/Pomog/bomberman/backend/connection"
+	"github.com/Pomog/bomberman/backend/moderation"
+	"github.com/Pomog/bomberman/backend/server"
+	"github.com/Pomog/bomberman/backend/webmodel"
+	"github.com/Pomog/bomberman/backend/websocket_hub"
+)
+
+/*
+SendChatHistory sends the last messages of the room and global chat channels to the newly joined user,
+one `chatHistory` message per channel.
+*/
+func SendChatHistory(app *server.Application, currConnection *wsconnection.UsersConnection) error {
+	for _, channel := range []string{webmodel.CHAT_CHANNEL_ROOM, webmodel.CHAT_CHANNEL_GLOBAL} {
+		page := chatHistoryPage(app, currConnection, channel, time.Time{}, chathistory.BACKFILL_SIZE)
+		_, err := currConnection.SendSuccessMessage(webmodel.ChatHistory, page)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ReplyChatHistory replies to a client's `chatHistory` request with a page of the history of a channel:
+the messages created before the requested date, the oldest first.
+*/
+func ReplyChatHistory(app *server.Application) wsconnection.FuncReplyCreator {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) (any, error) {
+		request, ok := message.Data.(webmodel.ChatHistoryRequest)
+		if !ok {
+			return nil, currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+		if request.Channel == "" {
+			request.Channel = webmodel.CHAT_CHANNEL_ROOM
+		}
+		if request.Limit == 0 {
+			request.Limit = chathistory.BACKFILL_SIZE
+		}
+
+		return chatHistoryPage(app, currConnection, request.Channel, request.Before, request.Limit), nil
+	}
+}
+
+/*
+ReplyEditChatMessage replaces the content of a chat message of any channel at the request of its sender,
+during chathistory.EDIT_WINDOW after the message was sent.
+The channel gets the new version of the message in a `chatMessageEdited` message, which is also the reply.
+*/
+func ReplyEditChatMessage(app *server.Application) wsconnection.FuncReplyCreator {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) (any, error) {
+		request, ok := message.Data.(webmodel.EditChatMessageRequest)
+		if !ok {
+			return nil, currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+		if request.Channel == "" {
+			request.Channel = webmodel.CHAT_CHANNEL_ROOM
+		}
+		userName := currConnection.Client.UserName
+		roomID := currConnection.Client.Room.ID
+
+		// The edits are moderated as the new messages
+		if until, muted := app.Moderator.MutedUntil(roomID, userName); muted {
+			return nil, currConnection.WSBadRequest(message, fmt.Sprintf("you are muted until %s", until.Format(time.TimeOnly)))
+		}
+		content, filtered := app.Moderator.Filter.Censor(request.Content)
+		if filtered {
+			app.Moderator.Record(moderation.ACTION_FILTER, roomID, "", userName, fmt.Sprintf("messageId=%d", request.MessageID))
+		}
+
+		history := channelHistory(app, currConnection, request.Channel)
+		edited, err := history.Update(request.MessageID, func(chatMessage *webmodel.ChatMessage) error {
+			if chatMessage.UserName != userName {
+				return chatRefusal("you can edit only your own messages")
+			}
+			if time.Since(chatMessage.DateCreate) > chathistory.EDIT_WINDOW {
+				return chatRefusal(fmt.Sprintf("a message can be edited only during %s", chathistory.EDIT_WINDOW))
+			}
+			editedAt := time.Now().UTC()
+			chatMessage.Content = content
+			chatMessage.EditedAt = &editedAt
+			return nil
+		})
+		if errMessage := chatEditError(app, request.Channel, request.MessageID, err); errMessage != "" {
+			return nil, currConnection.WSBadRequest(message, errMessage)
+		}
+
+		if err := sendToChatChannel(currConnection, request.Channel, edited, webmodel.ChatMessageEdited, edited); err != nil {
+			return nil, currConnection.WSError(message, "sending edited message to the channel failed", err)
+		}
+		return edited, nil
+	}
+}
+
+/*
+ReplyDeleteChatMessage deletes a chat message of any channel at the request of its sender,
+during chathistory.EDIT_WINDOW after the message was sent. The room host can delete any message of the room channel,
+which is written to the audit log.
+The channel is told with a `chatMessageDeleted` message, which is also the reply.
+*/
+func ReplyDeleteChatMessage(app *server.Application) wsconnection.FuncReplyCreator {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) (any, error) {
+		request, ok := message.Data.(webmodel.ChatMessageRef)
+		if !ok {
+			return nil, currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+		if request.Channel == "" {
+			request.Channel = webmodel.CHAT_CHANNEL_ROOM
+		}
+		userName := currConnection.Client.UserName
+		room := currConnection.Client.Room
+		isModerator := request.Channel == webmodel.CHAT_CHANNEL_ROOM && room.Host() == currConnection.Client
+
+		history := channelHistory(app, currConnection, request.Channel)
+		deleted, err := history.Delete(request.MessageID, func(chatMessage webmodel.ChatMessage) error {
+			if isModerator {
+				return nil
+			}
+			if chatMessage.UserName != userName {
+				return chatRefusal("you can delete only your own messages")
+			}
+			if time.Since(chatMessage.DateCreate) > chathistory.EDIT_WINDOW {
+				return chatRefusal(fmt.Sprintf("a message can be deleted only during %s", chathistory.EDIT_WINDOW))
+			}
+			return nil
+		})
+		if errMessage := chatEditError(app, request.Channel, request.MessageID, err); errMessage != "" {
+			return nil, currConnection.WSBadRequest(message, errMessage)
+		}
+		if deleted.UserName != userName {
+			app.Moderator.Record(moderation.ACTION_DELETE, room.ID, userName, deleted.UserName, fmt.Sprintf("messageId=%d", deleted.MessageID))
+		}
+
+		if err := sendToChatChannel(currConnection, request.Channel, deleted, webmodel.ChatMessageDeleted, request); err != nil {
+			return nil, currConnection.WSError(message, "sending deleted message to the channel failed", err)
+		}
+		return request, nil
+	}
+}
+
+// chatRefusal is the error of a chat request the sender is not allowed to do, or did wrong;
+// its text is sent to the sender.
+type chatRefusal string
+
+func (r chatRefusal) Error() string {
+	return string(r)
+}
+
+// chatEditError converts the error of an edit or a deletion of a chat message to the message for the client.
+// A failure to persist the change is only logged, since the change is done.
+// Returns an empty string if the change is done.
+func chatEditError(app *server.Application, channel string, messageID uint64, err error) string {
+	var refusal chatRefusal
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, chathistory.ErrMessageNotFound):
+		return fmt.Sprintf("message %d is not in the %s channel", messageID, channel)
+	case errors.As(err, &refusal):
+		return refusal.Error()
+	}
+	app.ErrLog.Printf("Saving chat message change failed: %v", err)
+	return ""
+}
+
+// sendToChatChannel sends a message about `chatMessage` to the players of its channel: the players of the room of the client,
+// of all rooms, or the sender and the recipients of a private or group message.
+func sendToChatChannel(currConnection *wsconnection.UsersConnection, channel string, chatMessage webmodel.ChatMessage, messageType string, data any) error {
+	switch channel {
+	case webmodel.CHAT_CHANNEL_GLOBAL:
+		return currConnection.SendMessageToAllRooms(messageType, data)
+	case webmodel.CHAT_CHANNEL_PRIVATE, webmodel.CHAT_CHANNEL_GROUP:
+		// The sender gets its own message too, as in the room channel.
+		recipients := append(slices.Clone(chatMessage.To), chatMessage.UserName)
+		_, err := currConnection.SendMessageToUsersInRoom(messageType, data, recipients)
+		return err
+	}
+	_, _, err := currConnection.SendMessageToClientRoom(messageType, data)
+	return err
+}
+
+// chatHistoryPage returns a page of the history of the room or global channel of the client.
+func chatHistoryPage(app *server.Application, currConnection *wsconnection.UsersConnection, channel string, before time.Time, limit int) webmodel.ChatHistoryPage {
+	messages, more := channelHistory(app, currConnection, channel).Before(before, min(limit, chathistory.MAX_PAGE_SIZE))
+	return webmodel.ChatHistoryPage{Channel: channel, Messages: messages, More: more}
+}
+
+// channelHistory returns the history of a channel of the room of the client, or of the global channel.
+// The history is usable even if loading its file failed, which is logged.
+func channelHistory(app *server.Application, currConnection *wsconnection.UsersConnection, channel string) *chathistory.History {
+	history, err := app.ChatHistory.Channel(chatHistoryID(currConnection, channel))
+	if err != nil {
+		app.ErrLog.Printf("Loading chat history failed: %v", err)
+	}
+	return history
+}
+
+// chatHistoryID returns the ID of the history of a channel: the room ID of the client, UNIVERSAL_ROOM_ID for the global channel,
+// or `<room ID>/<channel>` for the private and group messages of the room, removed with the room channel.
+func chatHistoryID(currConnection *wsconnection.UsersConnection, channel string) string {
+	switch channel {
+	case webmodel.CHAT_CHANNEL_GLOBAL:
+		return websocket_hub.UNIVERSAL_ROOM_ID
+	case webmodel.CHAT_CHANNEL_PRIVATE, webmodel.CHAT_CHANNEL_GROUP:
+		return currConnection.Client.Room.ID + "/" + channel
+	}
+	return currConnection.Client.Room.ID
+}
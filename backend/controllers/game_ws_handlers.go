@@ -1,55 +1,138 @@
 package controllers
 
 import (
+	"errors"
+
 	wsconnection "github.com/Pomog/bomberman/backend/connection"
+	"github.com/Pomog/bomberman/backend/gamestate"
 	"github.com/Pomog/bomberman/backend/server"
 	"github.com/Pomog/bomberman/backend/webmodel"
 )
 
 /*
-ReadyToStart handles a WebSocket request when a player is ready to start the game.
-If the player is in the waiting room, it clears the waiting room state.
+ReadyToStart handles a WebSocket request when a player is ready to start the game, like `setReady` with `"ready": true`.
+The countdown to the start of the game starts when all the players of the room are ready (see UpdateReadyCheck).
 */
 func ReadyToStart(app *server.Application) wsconnection.FuncReplier {
 	return func(currConnection *wsconnection.UsersConnection, wsMessage webmodel.WSMessage) error {
-		// If the player is in the waiting room, clear it to indicate the game can start
-		if app.WaitingRoom != nil && app.WaitingRoom.ID == currConnection.Client.Room.ID {
-			app.WaitingRoom = nil
+		_, err := setPlayerReady(app, currConnection, true)
+		var refusal chatRefusal
+		if errors.As(err, &refusal) {
+			return currConnection.WSBadRequest(wsMessage, refusal.Error())
+		}
+		if err != nil {
+			return currConnection.WSError(wsMessage, "sending ready state to client room failed", err)
 		}
 		return nil
 	}
 }
 
 /*
-ReplyStartGame sends the GameMap string to the frontend.
+ReplyStartGame sends the GameMap string to the frontend, with the game rules of the room
+from RULES_PROTOCOL_VERSION (see webmodel.GameStart).
 The GameMap string is used by the frontend to generate the game map.
+
+The game is started by the server when the countdown of the ready check ends (see UpdateReadyCheck),
+so the request is refused before: it only lets the clients older than `gameStarted` join the game.
 */
 func ReplyStartGame(app *server.Application) wsconnection.FuncReplyCreator {
 	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) (any, error) {
+		room := currConnection.Client.Room
+		if room.State.Ended() {
+			return nil, currConnection.WSBadRequest(message, "the match is over")
+		}
+		if !room.Starting() && !room.State.Running() {
+			return nil, currConnection.WSBadRequest(message, "the game starts when all the players are ready and the countdown ends")
+		}
 		// If the player's room is in the waiting room, clear it
-		if app.WaitingRoom != nil && app.WaitingRoom.ID == currConnection.Client.Room.ID {
-			app.WaitingRoom = nil
+		app.CloseWaitingRoom(room)
+		rules := room.Rules()
+		// The player starts with the lives of the game rules
+		room.State.Join(currConnection.Client.UserName, rules.Lives)
+		// Start sending the state of the room to the players, if it's not sent already
+		startStateUpdates(app, room)
+		if err := updatePresence(currConnection, webmodel.PRESENCE_IN_GAME); err != nil {
+			app.ErrLog.Printf("sending presence of '%s' failed: %v", currConnection.Client.UserName, err)
 		}
 		// Send the GameMap to the client so they can render the game
-		return currConnection.Client.Room.GameMap, nil
+		if currConnection.ProtocolVersion < webmodel.RULES_PROTOCOL_VERSION {
+			return room.GameMap(), nil
+		}
+		return webmodel.GameStart{GameMap: room.GameMap(), Rules: rules}, nil
 	}
 }
 
 /*
-ReplyPlayerAction broadcasts a player's action to all other players in the same room.
+ReplyPlayerAction applies a player's action to the room state.
+The action is decoded and validated before the handler runs, so unknown actions never reach the room.
+Movements are sent to the players in the state updates; the other actions
+are broadcast to all players in the same room.
 */
 func ReplyPlayerAction(app *server.Application) wsconnection.FuncReplier {
 	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) error {
-		// Create a player action object containing the username and action payload
+		action, ok := message.Data.(webmodel.Action)
+		if !ok {
+			return currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+		header := action.Header()
+
+		state := currConnection.Client.Room.State
+		// Drop duplicate and out-of-order inputs, and reject the inputs of the players out of the game
+		if err := state.AcceptInput(currConnection.Client.UserName, header.Seq); err != nil {
+			if errors.Is(err, gamestate.ErrOutOfOrderInput) {
+				app.InfoLog.Printf("input %d of '%s' is dropped as out of order", header.Seq, currConnection.Client.UserName)
+				return nil
+			}
+			return currConnection.WSBadRequest(message, err.Error())
+		}
+
+		switch action := action.(type) {
+		case webmodel.MoveAction:
+			// The movement reaches the other players with the next state update
+			state.MovePlayer(currConnection.Client.UserName, action.Coords, action.SpriteInfo)
+			return nil
+		case webmodel.PlaceBombAction:
+			// Validate the bomb against the state the player saw when placing it
+			err := state.PlaceBomb(currConnection.Client.UserName, action.Coords, header.Tick, currConnection.Client.Latency.RTT())
+			if err != nil {
+				return currConnection.WSBadRequest(message, err.Error())
+			}
+		case webmodel.PowerPickedAction:
+			state.PickPowerUp(action.Coords.Row, action.Coords.Column)
+		case webmodel.DieAction:
+			// Validate the hit against the state the player saw when dying
+			err := state.ValidateDeath(currConnection.Client.UserName, header.Tick, currConnection.Client.Latency.RTT())
+			if err != nil {
+				// The player is alive for the server and the other players, the client gets its state back
+				if player, ok := state.Player(currConnection.Client.UserName); ok {
+					if _, sendErr := currConnection.SendSuccessMessage(webmodel.PlayerCorrection, player); sendErr != nil {
+						app.ErrLog.Printf("sending the state of '%s' failed: %v", currConnection.Client.UserName, sendErr)
+					}
+				}
+				return currConnection.WSBadRequest(message, err.Error())
+			}
+			// A player can't have more lives than the game rules give
+			lives := min(action.Lives, currConnection.Client.Room.Rules().Lives)
+			state.SetLives(currConnection.Client.UserName, lives)
+			if lives <= 0 {
+				// A player without lives leaves the game and watches it
+				state.RemovePlayer(currConnection.Client.UserName)
+				if err := updatePresence(currConnection, webmodel.PRESENCE_SPECTATING); err != nil {
+					app.ErrLog.Printf("sending presence of '%s' failed: %v", currConnection.Client.UserName, err)
+				}
+			}
+		}
+
+		// Create a player action object containing the username and the validated action
 		playerAction := webmodel.PlrAction{
 			UserName: currConnection.Client.UserName,
-			Action:   message.Payload,
+			Action:   action,
 		}
 
 		// Broadcast the action to all clients in the same room
 		_, _, err := currConnection.SendMessageToClientRoom(webmodel.PlayerAction, playerAction)
 		if err != nil {
-			return currConnection.WSError("sending action to client room failed", err)
+			return currConnection.WSError(message, "sending action to client room failed", err)
 		}
 		return nil
 	}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"time"
+
+	wsconnection "github.com/Pomog/bomberman/backend/connection"
+	"github.com/Pomog/bomberman/backend/server"
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// LATENCY_REPORT_PERIOD is the minimal period between two broadcasts of the players' latency in a room.
+const LATENCY_REPORT_PERIOD = 5 * time.Second
+
+/*
+ReplyPing replies to a client's application-level ping with the client time
+and the server time, so the client can measure its round-trip time.
+*/
+func ReplyPing(app *server.Application) wsconnection.FuncReplyCreator {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) (any, error) {
+		ping, ok := message.Data.(webmodel.LatencyPing)
+		if !ok {
+			return nil, currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+		ping.ServerTime = time.Now().UnixMilli()
+		return ping, nil
+	}
+}
+
+/*
+ReplyPong records the round-trip time of a server's application-level ping, identified by its nonce,
+and periodically broadcasts the latency of all players to the room.
+*/
+func ReplyPong(app *server.Application) wsconnection.FuncReplier {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) error {
+		pong, ok := message.Data.(webmodel.LatencyPing)
+		if !ok {
+			return currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+		if pong.Nonce == 0 {
+			return currConnection.WSBadRequest(message, "'nonce' is required in a pong")
+		}
+		// The round-trip time is measured from the send time kept by the server, not from the client's payload
+		if !currConnection.Client.Latency.CompletePing(pong.Nonce) {
+			return currConnection.WSBadRequest(message, "the pong doesn't answer a ping")
+		}
+
+		room := currConnection.Client.Room
+		if room.LatencyReportDue(LATENCY_REPORT_PERIOD) {
+			_, _, err := currConnection.SendMessageToClientRoom(webmodel.RoomLatency, room.GetUsersInRoom())
+			if err != nil {
+				return currConnection.WSError(message, "sending latency to client room failed", err)
+			}
+		}
+		return nil
+	}
+}
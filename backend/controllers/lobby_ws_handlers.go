@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"fmt"
+
+	wsconnection "github.com/Pomog/bomberman/backend/connection"
+	"github.com/Pomog/bomberman/backend/gamerules"
+	"github.com/Pomog/bomberman/backend/mapgen"
+	"github.com/Pomog/bomberman/backend/server"
+	"github.com/Pomog/bomberman/backend/webmodel"
+	"github.com/Pomog/bomberman/backend/websocket_hub"
+)
+
+/*
+ReplySetLobbySettings changes some game rules of the room at the request of its host,
+until the countdown to the start of the game begins. The other rules stay the ones of the preset of the room.
+The map of the room is generated again with the new rules.
+
+The room is told about the rules with a `lobby` message, which is also the reply.
+*/
+func ReplySetLobbySettings(app *server.Application) wsconnection.FuncReplyCreator {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) (any, error) {
+		settings, ok := message.Data.(webmodel.LobbySettings)
+		if !ok {
+			return nil, currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+
+		rules := currConnection.Client.Room.Rules()
+		rules.MapTemplate = settings.MapTemplate
+		rules.Lives = settings.Lives
+		rules.MatchDuration = settings.MatchDuration
+		rules.PowerUpDensity = settings.PowerUpDensity
+		rules.Bots = settings.Bots
+		if settings.BotDifficulty != "" {
+			rules.BotDifficulty = settings.BotDifficulty
+		}
+
+		return setRoomRules(app, currConnection, message, rules)
+	}
+}
+
+/*
+ReplySetGamePreset resets the game rules of the room to a preset of the server at the request of its host,
+until the countdown to the start of the game begins. The map of the room is generated again with the new rules.
+
+The room is told about the rules with a `lobby` message, which is also the reply.
+*/
+func ReplySetGamePreset(app *server.Application) wsconnection.FuncReplyCreator {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) (any, error) {
+		request, ok := message.Data.(webmodel.GamePresetRequest)
+		if !ok {
+			return nil, currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+
+		rules, ok := app.GamePresets.Get(request.Preset)
+		if !ok {
+			return nil, currConnection.WSBadRequest(message, fmt.Sprintf("unknown preset '%s', the presets are %v", request.Preset, app.GamePresets.Names()))
+		}
+		return setRoomRules(app, currConnection, message, rules)
+	}
+}
+
+// setRoomRules checks that the player is the host and the game rules can change, then gives the rules and a new map to the room.
+func setRoomRules(app *server.Application, currConnection *wsconnection.UsersConnection, message webmodel.WSMessage, rules gamerules.GameRules) (webmodel.LobbyState, error) {
+	room := currConnection.Client.Room
+
+	if room.Host() != currConnection.Client {
+		return webmodel.LobbyState{}, currConnection.WSBadRequest(message, "only the room host can change the game rules")
+	}
+	if err := rules.Validate(); err != nil {
+		return webmodel.LobbyState{}, currConnection.WSBadRequest(message, err.Error())
+	}
+	if room.Size() > rules.MaxPlayers {
+		return webmodel.LobbyState{}, currConnection.WSBadRequest(message, fmt.Sprintf("the room has more than %d players", rules.MaxPlayers))
+	}
+
+	gameMap, err := mapgen.GenerateMap(rules.MapTemplate, rules.BlockDensity, rules.PowerUpDensity)
+	if err != nil {
+		return webmodel.LobbyState{}, currConnection.WSBadRequest(message, err.Error())
+	}
+	// The countdown may start while the map is generated, so it is checked when the game changes
+	if !room.SetGame(rules, gameMap) {
+		return webmodel.LobbyState{}, currConnection.WSBadRequest(message, "the game rules can't change once the countdown started")
+	}
+	app.InfoLog.Printf("Game rules of room '%s' changed by '%s': %+v", room, currConnection.Client.UserName, rules)
+
+	return BroadcastLobby(app, room), nil
+}
+
+/*
+SendLobby sends the host and the game rules of the room to a player who just joined it.
+If the player is the new host of the room, e.g. the first player who joined, the whole room is told.
+*/
+func SendLobby(app *server.Application, currConnection *wsconnection.UsersConnection) error {
+	room := currConnection.Client.Room
+	if _, changed := room.ElectHost(); changed {
+		BroadcastLobby(app, room)
+		return nil
+	}
+	_, err := currConnection.SendSuccessMessage(webmodel.Lobby, lobby(app, room))
+	return err
+}
+
+// BroadcastLobby sends the host and the game rules of the room to the room as a `lobby` message, and returns them.
+func BroadcastLobby(app *server.Application, room *websocket_hub.Room) webmodel.LobbyState {
+	state := lobby(app, room)
+	wsMessage, err := webmodel.CreateJSONMessage(webmodel.Lobby, webmodel.SUCCESS_RESULT, state)
+	if err != nil {
+		app.ErrLog.Printf("cannot create lobby of room '%s': %v", room, err)
+		return state
+	}
+	app.Hub.BroadcastMessageInRoom(wsMessage, room)
+	return state
+}
+
+// lobby returns the host and the game rules of the room, and the presets the host can choose.
+func lobby(app *server.Application, room *websocket_hub.Room) webmodel.LobbyState {
+	state := webmodel.LobbyState{Rules: room.Rules(), Presets: app.GamePresets.Names()}
+	if host := room.Host(); host != nil {
+		state.Host = host.UserName
+	}
+	return state
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	wsconnection "github.com/Pomog/bomberman/backend/connection"
+	"github.com/Pomog/bomberman/backend/moderation"
+	"github.com/Pomog/bomberman/backend/server"
+	"github.com/Pomog/bomberman/backend/webmodel"
+	"github.com/Pomog/bomberman/backend/websocket_hub"
+)
+
+// KICK_NOTICE_WAIT Time allowed to send the notice of a kick to the room before the connection of the kicked player is closed
+const KICK_NOTICE_WAIT = time.Second
+
+/*
+ReplyMutePlayer mutes or unmutes a player of the room at the request of the room host.
+A muted player's chat messages are rejected until the mute ends.
+The room is told about the action with a `moderation` message, which is also the reply.
+*/
+func ReplyMutePlayer(app *server.Application) wsconnection.FuncReplyCreator {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) (any, error) {
+		request, ok := message.Data.(webmodel.MuteRequest)
+		if !ok {
+			return nil, currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+
+		target, errMessage := moderationTarget(currConnection, request.UserName)
+		if errMessage != "" {
+			return nil, currConnection.WSBadRequest(message, errMessage)
+		}
+
+		room := currConnection.Client.Room
+		event := webmodel.ModerationEvent{UserName: target.UserName, By: currConnection.Client.UserName}
+		if request.Unmute {
+			if !app.Moderator.Unmute(room.ID, target.UserName) {
+				return nil, currConnection.WSBadRequest(message, fmt.Sprintf("player '%s' is not muted", target.UserName))
+			}
+			event.Action = moderation.ACTION_UNMUTE
+			app.Moderator.Record(event.Action, room.ID, event.By, event.UserName, "")
+		} else {
+			duration := time.Duration(request.Duration) * time.Second
+			if duration == 0 {
+				duration = moderation.DEFAULT_MUTE_DURATION
+			}
+			until := time.Now().Add(min(duration, moderation.MAX_MUTE_DURATION))
+			app.Moderator.Mute(room.ID, target.UserName, until)
+
+			event.Action = moderation.ACTION_MUTE
+			event.Until = &until
+			app.Moderator.Record(event.Action, room.ID, event.By, event.UserName, "for="+duration.String())
+		}
+
+		_, _, err := currConnection.SendMessageToClientRoom(webmodel.Moderation, event)
+		if err != nil {
+			return nil, currConnection.WSError(message, "sending moderation to client room failed", err)
+		}
+		return event, nil
+	}
+}
+
+/*
+ReplyKickPlayer kicks a player out of the room at the request of the room host.
+The room is told about the action with a `moderation` message, which is also the reply,
+then the connection of the player is closed with the CLOSE_KICKED code. The player can't join the room again.
+*/
+func ReplyKickPlayer(app *server.Application) wsconnection.FuncReplyCreator {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) (any, error) {
+		request, ok := message.Data.(webmodel.KickRequest)
+		if !ok {
+			return nil, currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+
+		event, err := kickPlayer(app, currConnection, request.UserName, request.Reason)
+		var refusal chatRefusal
+		if errors.As(err, &refusal) {
+			return nil, currConnection.WSBadRequest(message, refusal.Error())
+		}
+		if err != nil {
+			return nil, currConnection.WSError(message, "sending moderation to client room failed", err)
+		}
+		return event, nil
+	}
+}
+
+// kickPlayer kicks a player out of the room of the host, for ReplyKickPlayer and the `/kick` chat command.
+// It returns a chatRefusal if the player can't be kicked.
+func kickPlayer(app *server.Application, currConnection *wsconnection.UsersConnection, userName, reason string) (webmodel.ModerationEvent, error) {
+	target, errMessage := moderationTarget(currConnection, userName)
+	if errMessage != "" {
+		return webmodel.ModerationEvent{}, chatRefusal(errMessage)
+	}
+	if target.Bot {
+		return webmodel.ModerationEvent{}, chatRefusal("bots can't be kicked")
+	}
+
+	room := currConnection.Client.Room
+	event := webmodel.ModerationEvent{
+		Action:   moderation.ACTION_KICK,
+		UserName: target.UserName,
+		By:       currConnection.Client.UserName,
+		Reason:   reason,
+	}
+	app.Moderator.Kick(room.ID, target.UserName)
+	app.Moderator.Record(event.Action, room.ID, event.By, event.UserName, fmt.Sprintf("reason=%q", event.Reason))
+
+	// The kicked player gets the notice too, before the connection is closed
+	_, sentMarks, err := currConnection.SendMessageToClientRoom(webmodel.Moderation, event)
+	if err != nil {
+		return event, err
+	}
+	if _, ok := websocket_hub.WaitSentTo(sentMarks, KICK_NOTICE_WAIT); !ok {
+		app.ErrLog.Printf("the kick notice of '%s' was not sent in time", target.UserName)
+	}
+
+	closeReason := "kicked by the room host"
+	if reason != "" {
+		closeReason += ": " + reason
+	}
+	target.Close(moderation.CLOSE_KICKED, closeReason)
+	return event, nil
+}
+
+/*
+moderationTarget checks that the sender is the host of the room and returns the player of the room
+the moderation action is about, who must be another player.
+
+Returns:
+  - the client of the target player;
+  - an error message if the checks fail, otherwise an empty string.
+*/
+func moderationTarget(currConnection *wsconnection.UsersConnection, userName string) (*websocket_hub.Client, string) {
+	room := currConnection.Client.Room
+	if room.Host() != currConnection.Client {
+		return nil, "only the room host can moderate the room"
+	}
+	if userName == currConnection.Client.UserName {
+		return nil, "you can't moderate yourself"
+	}
+	target, ok := room.Clients.Get(userName)
+	if !ok {
+		return nil, fmt.Sprintf("player '%s' is not in your room", userName)
+	}
+	return target, ""
+}
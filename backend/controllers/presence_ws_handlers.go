@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"time"
+
+	wsconnection "github.com/Pomog/bomberman/backend/connection"
+	"github.com/Pomog/bomberman/backend/server"
+	"github.com/Pomog/bomberman/backend/webmodel"
+	"github.com/Pomog/bomberman/backend/websocket_hub"
+)
+
+// TYPING_REPORT_PERIOD is the minimal period between two broadcasts of a player's typing indicator.
+const TYPING_REPORT_PERIOD = 2 * time.Second
+
+/*
+ReplySetPresence changes the presence of the player to online or idle, as the player's page tells,
+and notifies the room if it changed. The player's page is not asked during a game, where the presence is set by the server.
+*/
+func ReplySetPresence(app *server.Application) wsconnection.FuncReplier {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) error {
+		request, ok := message.Data.(webmodel.PresenceRequest)
+		if !ok {
+			return currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+
+		current := currConnection.Client.Presence()
+		if current != webmodel.PRESENCE_ONLINE && current != webmodel.PRESENCE_IDLE {
+			return nil
+		}
+		return updatePresence(currConnection, request.Presence)
+	}
+}
+
+/*
+ReplyTyping broadcasts the typing indicator of the player to the room.
+The indicator is broadcast at most once per TYPING_REPORT_PERIOD while the player types; the end of the typing is always broadcast.
+The typing of a muted player is not broadcast.
+*/
+func ReplyTyping(app *server.Application) wsconnection.FuncReplier {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) error {
+		indicator, ok := message.Data.(webmodel.TypingIndicator)
+		if !ok {
+			return currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+		client := currConnection.Client
+
+		if _, muted := app.Moderator.MutedUntil(client.Room.ID, client.UserName); muted {
+			return nil
+		}
+		if indicator.Typing && !client.TypingReportDue(TYPING_REPORT_PERIOD) {
+			return nil
+		}
+		if !indicator.Typing {
+			client.ResetTypingReport()
+		}
+
+		indicator.UserName = client.UserName
+		_, _, err := currConnection.SendMessageToClientRoom(webmodel.Typing, indicator)
+		if err != nil {
+			return currConnection.WSError(message, "sending typing indicator to client room failed", err)
+		}
+		return nil
+	}
+}
+
+// updatePresence changes the presence of the player and notifies the room with a `presence` message if it changed.
+func updatePresence(currConnection *wsconnection.UsersConnection, presence string) error {
+	if !currConnection.Client.SetPresence(presence) {
+		return nil
+	}
+	return SendUserToRoomMembers(webmodel.Presence)(currConnection, webmodel.WSMessage{})
+}
+
+// setClientPresence changes the presence of a player of the room without a request of theirs, e.g. at the start
+// or at the end of a match, and notifies the room with a `presence` message if it changed.
+func setClientPresence(app *server.Application, client *websocket_hub.Client, presence string) {
+	if !client.SetPresence(presence) {
+		return
+	}
+	wsMessage, err := webmodel.CreateJSONMessage(webmodel.Presence, webmodel.SUCCESS_RESULT, client.User())
+	if err != nil {
+		app.ErrLog.Printf("cannot create presence of '%s': %v", client.UserName, err)
+		return
+	}
+	app.Hub.BroadcastMessageInRoom(wsMessage, client.Room)
+}
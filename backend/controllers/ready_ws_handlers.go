@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	wsconnection "github.com/Pomog/bomberman/backend/connection"
+	"github.com/Pomog/bomberman/backend/server"
+	"github.com/Pomog/bomberman/backend/webmodel"
+	"github.com/Pomog/bomberman/backend/websocket_hub"
+)
+
+// Constants of the ready check.
+const (
+	READY_COUNTDOWN      = 10 * time.Second // The countdown to the start of the game, once all the players are ready.
+	MIN_PLAYERS_TO_START = 2                // The minimal number of players in the room, bots included, to start the countdown.
+)
+
+/*
+ReplySetReady marks the player as ready or not ready to start the game, and notifies the room with a `readyState` message.
+The player can change their mind until the countdown to the start of the game ends.
+
+The reply is the ready check of the room, which the room gets as a `readyCheck` message too.
+*/
+func ReplySetReady(app *server.Application) wsconnection.FuncReplyCreator {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) (any, error) {
+		request, ok := message.Data.(webmodel.ReadyRequest)
+		if !ok {
+			return nil, currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+
+		check, err := setPlayerReady(app, currConnection, request.Ready)
+		var refusal chatRefusal
+		if errors.As(err, &refusal) {
+			return nil, currConnection.WSBadRequest(message, refusal.Error())
+		}
+		if err != nil {
+			return nil, currConnection.WSError(message, "sending ready state to client room failed", err)
+		}
+		return check, nil
+	}
+}
+
+/*
+setPlayerReady marks the player as ready or not ready to start the game, for ReplySetReady, ReadyToStart
+and the `/ready` and `/unready` chat commands, and updates the ready check of the room.
+
+It returns a chatRefusal if the countdown to the start of the game ended.
+*/
+func setPlayerReady(app *server.Application, currConnection *wsconnection.UsersConnection, ready bool) (webmodel.ReadyCheckStatus, error) {
+	room := currConnection.Client.Room
+	if room.Starting() {
+		return webmodel.ReadyCheckStatus{}, chatRefusal("the game is already starting")
+	}
+
+	if currConnection.Client.SetReadyToStart(ready) {
+		err := SendUserToRoomMembers(webmodel.ReadyState)(currConnection, webmodel.WSMessage{})
+		if err != nil {
+			return webmodel.ReadyCheckStatus{}, err
+		}
+	}
+	return UpdateReadyCheck(app, room), nil
+}
+
+/*
+UpdateReadyCheck starts the countdown to the start of the game when all the human players of the room are ready,
+and cancels it when one of them is not ready anymore, e.g. a player who just joined.
+The room gets the ready check as a `readyCheck` message.
+
+It is called when a player changes their mind, joins or leaves the waiting room.
+When the countdown ends, the server starts the game (see startGame).
+
+Returns the ready check of the room.
+*/
+func UpdateReadyCheck(app *server.Application, room *websocket_hub.Room) webmodel.ReadyCheckStatus {
+	ready, humans := room.ReadyPlayers()
+	if humans > 0 && ready == humans && room.Size() >= MIN_PLAYERS_TO_START {
+		room.StartCountdown(READY_COUNTDOWN, func() {
+			app.InfoLog.Printf("Countdown of room '%s' ended", room)
+			startGame(app, room)
+		})
+	} else if room.CancelCountdown() {
+		app.InfoLog.Printf("Countdown of room '%s' cancelled", room)
+	}
+
+	check := webmodel.ReadyCheckStatus{Ready: ready, Players: humans}
+	if startsAt, ok := room.CountdownEnd(); ok {
+		check.StartsAt = &startsAt
+		check.Seconds = max(0, int(math.Ceil(time.Until(startsAt).Seconds())))
+	}
+
+	wsMessage, err := webmodel.CreateJSONMessage(webmodel.ReadyCheck, webmodel.SUCCESS_RESULT, check)
+	if err != nil {
+		app.ErrLog.Printf("cannot create ready check of room '%s': %v", room, err)
+		return check
+	}
+	app.Hub.BroadcastMessageInRoom(wsMessage, room)
+	return check
+}
+
+/*
+startGame starts the game of the room when the ready countdown ends: the room is closed to new players,
+the human players join the game, and the room gets a `gameStarted` message with the map and the game rules,
+so every player starts at the same time; the bots join on their own.
+The clients older than the `gameStarted` message request `startGame` at the end of their own countdown.
+*/
+func startGame(app *server.Application, room *websocket_hub.Room) {
+	// Nobody joins the room once the game starts, or between its start and the `gameStarted` message
+	app.WaitingRoomMutex.Lock()
+	defer app.WaitingRoomMutex.Unlock()
+
+	if app.WaitingRoom == room {
+		app.WaitingRoom = nil
+	}
+	// The room is destroyed if all the humans left
+	if !room.HasHumans() {
+		return
+	}
+
+	rules := room.Rules()
+	wsMessage, err := webmodel.CreateJSONMessage(webmodel.GameStarted, webmodel.SUCCESS_RESULT, webmodel.GameStart{GameMap: room.GameMap(), Rules: rules})
+	if err != nil {
+		app.ErrLog.Printf("cannot create game start of room '%s': %v", room, err)
+		return
+	}
+	// The presences are broadcast to the room, so the clients are not ranged over with the lock of the map
+	for _, client := range room.Clients.Values() {
+		if client.Bot {
+			continue
+		}
+		// Every player starts with the lives of the game rules
+		room.State.Join(client.UserName, rules.Lives)
+		setClientPresence(app, client, webmodel.PRESENCE_IN_GAME)
+	}
+	app.Hub.BroadcastMessageInRoom(wsMessage, room)
+	startStateUpdates(app, room)
+	app.InfoLog.Printf("Game of room '%s' started", room)
+}
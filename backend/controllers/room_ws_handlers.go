@@ -16,7 +16,7 @@ func SendListOfUsersInRoom(app *server.Application, currConnection *wsconnection
 	// Send the list of current users in the room to the new user
 	err := sendListOfUsersInRoomToCurrentUser(app, currConnection)
 	if err != nil && !errors.Is(err, webmodel.ErrWarning) {
-		return currConnection.WSError(fmt.Sprintf(
+		return currConnection.WSError(webmodel.WSMessage{}, fmt.Sprintf(
 			"sending list of users in the room '%s' to the user %s failed",
 			currConnection.Client.Room.ID, currConnection.Client.UserName), err)
 	}
@@ -43,6 +43,26 @@ func sendListOfUsersInRoomToCurrentUser(app *server.Application, currConnection
 	return err
 }
 
+/*
+SendUserQuit notifies all users in the room that the user left, and updates the ready check of the room,
+since the players left may all be ready now. If the user was the host of the room, the host role goes to the next player.
+The room is destroyed when the last human leaves it.
+*/
+func SendUserQuit(app *server.Application) wsconnection.FuncReplier {
+	return func(currConnection *wsconnection.UsersConnection, wsMessage webmodel.WSMessage) error {
+		err := SendUserToRoomMembers(webmodel.UserQuitChat)(currConnection, wsMessage)
+		room := currConnection.Client.Room
+		if app.DestroyRoom(room) {
+			return err
+		}
+		if _, changed := room.ElectHost(); changed {
+			BroadcastLobby(app, room)
+		}
+		UpdateReadyCheck(app, room)
+		return err
+	}
+}
+
 /*
 SendUserToRoomMembers notifies all users in the chat room about a change in user status.
 It can be used for both joining and leaving events.
@@ -50,7 +70,7 @@ It can be used for both joining and leaving events.
 func SendUserToRoomMembers(statusType string) wsconnection.FuncReplier {
 	return func(currConnection *wsconnection.UsersConnection, wsMessage webmodel.WSMessage) error {
 		// Broadcast the user status update to all members in the chat room
-		_, _, err := currConnection.SendMessageToClientRoom(statusType, currConnection.Client.ClientUser)
+		_, _, err := currConnection.SendMessageToClientRoom(statusType, currConnection.Client.User())
 		return err
 	}
 }
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"sort"
+	"time"
+
+	wsconnection "github.com/Pomog/bomberman/backend/connection"
+	"github.com/Pomog/bomberman/backend/gamestate"
+	"github.com/Pomog/bomberman/backend/server"
+	"github.com/Pomog/bomberman/backend/webmodel"
+	"github.com/Pomog/bomberman/backend/websocket_hub"
+)
+
+/*
+startStateUpdates starts sending the state of the room to its clients,
+if it is not being sent already. The updates stop when the room becomes empty.
+*/
+func startStateUpdates(app *server.Application, room *websocket_hub.Room) {
+	if !room.State.Start() {
+		return
+	}
+	go runStateUpdates(app, room)
+}
+
+/*
+runStateUpdates advances the room state every tick and sends every client
+a delta against the last tick it has acknowledged, or a keyframe.
+The match is over when the match duration of the game rules of the room is over.
+*/
+func runStateUpdates(app *server.Application, room *websocket_hub.Room) {
+	ticker := time.NewTicker(gamestate.TICK_INTERVAL)
+	defer func() {
+		ticker.Stop()
+		room.State.Stop()
+		app.InfoLog.Printf("State updates of room '%s' stopped", room)
+	}()
+
+	matchEnd := time.Now().Add(time.Duration(room.Rules().MatchDuration) * time.Second)
+	app.InfoLog.Printf("State updates of room '%s' started", room)
+	for range ticker.C {
+		if room.Size() == 0 {
+			return
+		}
+		if time.Now().After(matchEnd) {
+			endMatch(app, room)
+			return
+		}
+
+		room.State.Advance()
+		room.Clients.RRange(func(userName string, client *websocket_hub.Client) {
+			update, ok := room.State.UpdateFor(userName)
+			if !ok {
+				return // nothing changed since the acknowledged tick
+			}
+
+			wsMessage, err := encodeStateUpdate(client, update)
+			if err != nil {
+				app.ErrLog.Printf("cannot create state update for '%s': %v", userName, err)
+				return
+			}
+			// If the client is lagging, the update replaces the older ones waiting in its queue.
+			client.WriteMessage(wsMessage)
+		})
+	}
+}
+
+/*
+endMatch stops the game of the room and sends the room a `matchOver` message
+with the players who still have lives. The players, humans and bots, are online again.
+*/
+func endMatch(app *server.Application, room *websocket_hub.Room) {
+	room.State.End()
+
+	result := webmodel.MatchResult{Survivors: []string{}}
+	for _, player := range room.State.Players() {
+		result.Survivors = append(result.Survivors, player.UserName)
+	}
+	sort.Strings(result.Survivors)
+
+	wsMessage, err := webmodel.CreateJSONMessage(webmodel.MatchOver, webmodel.SUCCESS_RESULT, result)
+	if err != nil {
+		app.ErrLog.Printf("cannot create match result of room '%s': %v", room, err)
+		return
+	}
+	app.Hub.BroadcastMessageInRoom(wsMessage, room)
+	app.InfoLog.Printf("Match of room '%s' is over, survivors: %v", room, result.Survivors)
+
+	resetPresences(app, room)
+}
+
+// resetPresences sets the presence of every player of the room back to online after a match.
+// The presences are broadcast to the room, so the clients are not ranged over with the lock of the map.
+func resetPresences(app *server.Application, room *websocket_hub.Room) {
+	for _, client := range room.Clients.Values() {
+		setClientPresence(app, client, webmodel.PRESENCE_ONLINE)
+	}
+}
+
+/*
+encodeStateUpdate encodes the state update in the binary format if the client negotiated it,
+otherwise as a JSON message.
+*/
+func encodeStateUpdate(client *websocket_hub.Client, update webmodel.RoomStateUpdate) ([]byte, error) {
+	if client.Binary {
+		return webmodel.EncodeBinaryStateUpdate(update)
+	}
+	return webmodel.CreateJSONMessage(webmodel.StateUpdate, webmodel.SUCCESS_RESULT, update)
+}
+
+/*
+ReplyStateAck records the tick of the last state update received by the client,
+so the next updates are computed as deltas against it.
+*/
+func ReplyStateAck(app *server.Application) wsconnection.FuncReplier {
+	return func(currConnection *wsconnection.UsersConnection, message webmodel.WSMessage) error {
+		tick, ok := message.Data.(uint64)
+		if !ok {
+			return currConnection.WSBadRequest(message, webmodel.ErrInvalidPayload.Error())
+		}
+		currConnection.Client.Room.State.Ack(currConnection.Client.UserName, tick)
+		return nil
+	}
+}
@@ -0,0 +1,180 @@
+package gamerules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/Pomog/bomberman/backend/mapgen"
+)
+
+// GAME_RULES_FILE is the file of the presets of the game rules, relative to the working directory of the server:
+// a JSON object of GameRules by preset name. The presets of the file are added to DefaultPresets,
+// or replace the ones with the same name. Without the file, DefaultPresets are used.
+const GAME_RULES_FILE = "game_rules.json"
+
+// MAX_PLAYERS is the maximal number of players of a room: the maps have 4 spawn corners.
+const MAX_PLAYERS = 4
+
+// The difficulty levels of the bots, see the bots package.
+const (
+	BOT_EASY   = "easy"
+	BOT_NORMAL = "normal"
+	BOT_HARD   = "hard"
+)
+
+// BOT_DIFFICULTIES are the difficulty levels the bots of a room can play with.
+var BOT_DIFFICULTIES = []string{BOT_EASY, BOT_NORMAL, BOT_HARD}
+
+// GameRules are the rules of the game of a room. They come from a preset, and the host of the room
+// can change some of them in the lobby. They are sent to the players with the map when the game starts.
+type GameRules struct {
+	Preset         string `json:"preset"`         // The name of the preset the rules come from.
+	MaxPlayers     int    `json:"maxPlayers"`     // The number of players of a full room, bots included, from 2 to MAX_PLAYERS.
+	Lives          int    `json:"lives"`          // The lives of every player, from 1 to 9.
+	MatchDuration  int    `json:"matchDuration"`  // The duration of a match in seconds, from 60 to 600.
+	MapTemplate    string `json:"mapTemplate"`    // The template of the map, one of mapgen.Templates.
+	BlockDensity   int    `json:"blockDensity"`   // The percentage of the free tiles with a destroyable block.
+	PowerUpDensity int    `json:"powerUpDensity"` // The percentage of the destroyable blocks hiding a power-up.
+	Bots           int    `json:"bots"`           // The number of bots added when the room is filled.
+	BotDifficulty  string `json:"botDifficulty"`  // The difficulty level of the bots, one of BOT_DIFFICULTIES.
+}
+
+// The built-in presets.
+var (
+	CLASSIC = GameRules{
+		Preset:         "classic",
+		MaxPlayers:     MAX_PLAYERS,
+		Lives:          3,
+		MatchDuration:  180,
+		MapTemplate:    mapgen.MAP_TEMPLATE_CLASSIC,
+		BlockDensity:   mapgen.DEFAULT_BLOCK_DENSITY,
+		PowerUpDensity: mapgen.DEFAULT_POWER_UP_DENSITY,
+		Bots:           MAX_PLAYERS - 1,
+		BotDifficulty:  BOT_NORMAL,
+	}
+	SUDDEN_DEATH = GameRules{
+		Preset:         "suddenDeath",
+		MaxPlayers:     MAX_PLAYERS,
+		Lives:          1,
+		MatchDuration:  90,
+		MapTemplate:    mapgen.MAP_TEMPLATE_CLASSIC,
+		BlockDensity:   50,
+		PowerUpDensity: mapgen.DEFAULT_POWER_UP_DENSITY,
+		Bots:           MAX_PLAYERS - 1,
+		BotDifficulty:  BOT_NORMAL,
+	}
+	HIGH_POWERUPS = GameRules{
+		Preset:         "highPowerups",
+		MaxPlayers:     MAX_PLAYERS,
+		Lives:          3,
+		MatchDuration:  180,
+		MapTemplate:    mapgen.MAP_TEMPLATE_OPEN,
+		BlockDensity:   mapgen.DEFAULT_BLOCK_DENSITY,
+		PowerUpDensity: 80,
+		Bots:           MAX_PLAYERS - 1,
+		BotDifficulty:  BOT_NORMAL,
+	}
+)
+
+// DefaultPresets maps the names of the built-in presets to their rules.
+var DefaultPresets = map[string]GameRules{
+	CLASSIC.Preset:       CLASSIC,
+	SUDDEN_DEATH.Preset:  SUDDEN_DEATH,
+	HIGH_POWERUPS.Preset: HIGH_POWERUPS,
+}
+
+// Validate returns an error if a rule is out of its bounds.
+func (r GameRules) Validate() error {
+	switch {
+	case r.MaxPlayers < 2 || r.MaxPlayers > MAX_PLAYERS:
+		return fmt.Errorf("maxPlayers must be from 2 to %d", MAX_PLAYERS)
+	case r.Lives < 1 || r.Lives > 9:
+		return fmt.Errorf("lives must be from 1 to 9")
+	case r.MatchDuration < 60 || r.MatchDuration > 600:
+		return fmt.Errorf("matchDuration must be from 60 to 600 seconds")
+	case !mapgen.HasTemplate(r.MapTemplate):
+		return fmt.Errorf("mapTemplate must be one of %v", mapgen.Templates())
+	case r.BlockDensity < 0 || r.BlockDensity > 100:
+		return fmt.Errorf("blockDensity must be from 0 to 100")
+	case r.PowerUpDensity < 0 || r.PowerUpDensity > 100:
+		return fmt.Errorf("powerUpDensity must be from 0 to 100")
+	case r.Bots < 0 || r.Bots >= r.MaxPlayers:
+		return fmt.Errorf("bots must be from 0 to maxPlayers-1")
+	case !slices.Contains(BOT_DIFFICULTIES, r.BotDifficulty):
+		return fmt.Errorf("botDifficulty must be one of %v", BOT_DIFFICULTIES)
+	}
+	return nil
+}
+
+// Presets are the presets of the game rules a room can be played with, and the preset of the new rooms.
+type Presets struct {
+	presets       map[string]GameRules
+	defaultPreset string
+}
+
+/*
+LoadPresets loads the presets of `file` (see GAME_RULES_FILE) on top of DefaultPresets.
+The new rooms are played with the `defaultPreset`.
+
+It returns DefaultPresets with the CLASSIC default, and an error, if the file can't be read,
+a preset is invalid or `defaultPreset` doesn't exist.
+*/
+func LoadPresets(file string, defaultPreset string) (*Presets, error) {
+	fallback := &Presets{presets: DefaultPresets, defaultPreset: CLASSIC.Preset}
+
+	presets := make(map[string]GameRules, len(DefaultPresets))
+	for name, rules := range DefaultPresets {
+		presets[name] = rules
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return fallback, err
+	}
+	if err == nil {
+		var filePresets map[string]GameRules
+		if err := json.Unmarshal(content, &filePresets); err != nil {
+			return fallback, fmt.Errorf("%s: %v", file, err)
+		}
+		for name, rules := range filePresets {
+			rules.Preset = name
+			// The files written before the difficulty of the bots was a rule play with the normal bots
+			if rules.BotDifficulty == "" {
+				rules.BotDifficulty = BOT_NORMAL
+			}
+			if err := rules.Validate(); err != nil {
+				return fallback, fmt.Errorf("preset '%s' of %s: %v", name, file, err)
+			}
+			presets[name] = rules
+		}
+	}
+
+	if _, ok := presets[defaultPreset]; !ok {
+		return fallback, fmt.Errorf("unknown preset '%s'", defaultPreset)
+	}
+	return &Presets{presets: presets, defaultPreset: defaultPreset}, nil
+}
+
+// Get returns the rules of the preset with the given name, and false if there is none.
+func (p *Presets) Get(name string) (GameRules, bool) {
+	rules, ok := p.presets[name]
+	return rules, ok
+}
+
+// Default returns the rules of the preset of the new rooms.
+func (p *Presets) Default() GameRules {
+	return p.presets[p.defaultPreset]
+}
+
+// Names returns the names of the presets, sorted.
+func (p *Presets) Names() []string {
+	names := make([]string, 0, len(p.presets))
+	for name := range p.presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,187 @@
+package gamestate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/mapgen"
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// Constants of the game simulation, the same as in the frontend file `consts.js`.
+const (
+	TILE_SIZE           = 32              // Size of a map tile in pixels.
+	BOMB_EXPLOSION_TIME = 3 * time.Second // Time between placing a bomb and its explosion.
+	EXPLOSION_DURATION  = 2 * time.Second // How long the explosion lasts.
+	MAX_BOMB_POWER      = 10              // Maximal range of an explosion in tiles.
+)
+
+// MAX_REWIND_TICKS is the maximal number of ticks the simulation is rewound to validate
+// a player's action, so players with a very high latency can't act too far in the past.
+const MAX_REWIND_TICKS = 10
+
+// ErrRejectedAction is returned when a player's action is not consistent with the room state.
+var ErrRejectedAction = errors.New("action rejected")
+
+// bomb is a bomb placed in the room, kept while its explosion can still hit a player.
+type bomb struct {
+	owner    string              // The player who placed the bomb.
+	coords   webmodel.BombCoords // The position and the power of the bomb.
+	tick     uint64              // The tick the bomb was placed at.
+	exploded bool                // True once the explosion has destroyed the blocks around the bomb.
+	blast    []int               // The tiles reached by the explosion, recorded when it exploded.
+}
+
+// durationToTicks converts a duration to a number of ticks.
+func durationToTicks(d time.Duration) uint64 {
+	return uint64(d / TICK_INTERVAL)
+}
+
+// rewindTick returns the tick the simulation is rewound to when validating a player's action.
+// `reportedTick` is the last tick the player had received; if it is unknown (0), it is estimated
+// from the round-trip time of the player. The result is bounded by MAX_REWIND_TICKS.
+// It must be called with the state locked.
+func (s *State) rewindTick(reportedTick uint64, rtt time.Duration) uint64 {
+	if reportedTick == 0 {
+		// The state the player saw is about half of the round trip old.
+		lag := uint64(math.Ceil(float64(rtt/2) / float64(TICK_INTERVAL)))
+		if lag < s.tick {
+			reportedTick = s.tick - lag
+		}
+	}
+
+	oldest := uint64(0)
+	if s.tick > MAX_REWIND_TICKS {
+		oldest = s.tick - MAX_REWIND_TICKS
+	}
+	return max(oldest, min(reportedTick, s.tick))
+}
+
+// PlaceBomb validates a bomb placement against the room state rewound to the player's tick
+// and records the bomb. The bomb must be on the map and next to the player's position at that tick,
+// or to the current position if the player is not in the snapshot of that tick.
+// The players who are not in the game can't place bombs.
+func (s *State) PlaceBomb(userName string, coords webmodel.BombCoords, reportedTick uint64, rtt time.Duration) error {
+	if coords.Row < 0 || coords.Row >= mapgen.MAP_ROWS || coords.Column < 0 || coords.Column >= mapgen.MAP_COLUMNS {
+		return fmt.Errorf("%w: the bomb is out of the map", ErrRejectedAction)
+	}
+	if coords.Power < 1 || coords.Power > MAX_BOMB_POWER {
+		return fmt.Errorf("%w: invalid bomb power %d", ErrRejectedAction, coords.Power)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	tick := s.rewindTick(reportedTick, rtt)
+	player, ok := s.playerAt(userName, tick)
+	if !ok {
+		// The player is not in the snapshot of that tick (e.g. they joined after it):
+		// the bomb is validated against the current position.
+		if player, ok = s.players[userName]; !ok {
+			return fmt.Errorf("%w: the player is not in the game", ErrRejectedAction)
+		}
+	}
+	row, column := tileOf(player.Coords)
+	if abs(row-coords.Row) > 1 || abs(column-coords.Column) > 1 {
+		return fmt.Errorf("%w: the bomb is too far from the player", ErrRejectedAction)
+	}
+
+	s.bombs = append(s.bombs, bomb{owner: userName, coords: coords, tick: tick})
+	return nil
+}
+
+// ValidateDeath checks that the player was hit by an explosion in the room state
+// rewound to the player's tick. The explosion is stopped by the blocks as on the map (see BlastTiles),
+// and it lasts MAX_REWIND_TICKS longer on both sides, as the players see it with different delays.
+func (s *State) ValidateDeath(userName string, reportedTick uint64, rtt time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.tick == 0 {
+		return nil // the simulation is not running, there is nothing to validate against
+	}
+
+	tick := s.rewindTick(reportedTick, rtt)
+	player, ok := s.playerAt(userName, tick)
+	if !ok {
+		return nil // the position of the player is unknown
+	}
+
+	// The player can stand on two tiles while moving between them.
+	rows := []int{int(math.Floor(player.Coords[1] / TILE_SIZE)), int(math.Ceil(player.Coords[1] / TILE_SIZE))}
+	columns := []int{int(math.Floor(player.Coords[0] / TILE_SIZE)), int(math.Ceil(player.Coords[0] / TILE_SIZE))}
+
+	for _, b := range s.bombs {
+		if !b.explodingAt(tick) {
+			continue
+		}
+		blast := b.blastTiles(s.tiles)
+		for _, row := range rows {
+			for _, column := range columns {
+				if slices.Contains(blast, TileIndex(row, column)) {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%w: no explosion reached the player", ErrRejectedAction)
+}
+
+// playerAt returns the state of the player at the given tick, or the current state if the tick
+// is no longer in the history.
+func (s *State) playerAt(userName string, tick uint64) (webmodel.PlayerState, bool) {
+	if past := s.history[tick%HISTORY_SIZE]; past.tick == tick && past.players != nil {
+		player, ok := past.players[userName]
+		return player, ok
+	}
+	player, ok := s.players[userName]
+	return player, ok
+}
+
+// pruneBombs removes the bombs whose explosion ended before the oldest tick that can be rewound to.
+// It must be called with the state locked.
+func (s *State) pruneBombs() {
+	lifetime := durationToTicks(BOMB_EXPLOSION_TIME+EXPLOSION_DURATION) + 2*MAX_REWIND_TICKS
+	kept := s.bombs[:0]
+	for _, b := range s.bombs {
+		if b.tick+lifetime >= s.tick {
+			kept = append(kept, b)
+		}
+	}
+	s.bombs = kept
+}
+
+// explodingAt reports whether the explosion of the bomb lasts at the given tick.
+// The players see the bomb with different delays, so the explosion is extended
+// by MAX_REWIND_TICKS on both sides.
+func (b bomb) explodingAt(tick uint64) bool {
+	start := b.tick + durationToTicks(BOMB_EXPLOSION_TIME)
+	end := start + durationToTicks(EXPLOSION_DURATION)
+	return tick+MAX_REWIND_TICKS >= start && tick <= end+MAX_REWIND_TICKS
+}
+
+// blastTiles returns the indexes of the tiles reached by the explosion of the bomb: the tiles recorded
+// when it exploded, or the tiles it would reach on the current map if it didn't explode yet.
+func (b bomb) blastTiles(tiles []byte) []int {
+	if b.exploded {
+		return b.blast
+	}
+	return BlastTiles(tiles, b.coords)
+}
+
+// tileOf returns the map tile the position belongs to, rounding to the nearest tile
+// the same way the frontend does when it places a bomb.
+func tileOf(coords [2]float64) (row, column int) {
+	return int(math.Round(coords[1] / TILE_SIZE)), int(math.Round(coords[0] / TILE_SIZE))
+}
+
+// abs returns the absolute value of an integer.
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,252 @@
+package gamestate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Pomog/bomberman/backend/mapgen"
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// testMap returns a map like the classic template without destroyable blocks:
+// solid blocks on the boundary and on the tiles with an even row and an even column.
+// The `blocks` are destroyable blocks, given as [row, column].
+func testMap(blocks ...[2]int) string {
+	tiles := make([]byte, mapgen.MAP_ROWS*mapgen.MAP_COLUMNS)
+	for row := 0; row < mapgen.MAP_ROWS; row++ {
+		for column := 0; column < mapgen.MAP_COLUMNS; column++ {
+			tile := TILE_GRASS
+			if row == 0 || column == 0 || row == mapgen.MAP_ROWS-1 || column == mapgen.MAP_COLUMNS-1 || (row%2 == 0 && column%2 == 0) {
+				tile = TILE_SOLID
+			}
+			tiles[TileIndex(row, column)] = tile
+		}
+	}
+	for _, block := range blocks {
+		tiles[TileIndex(block[0], block[1])] = TILE_BLOCK
+	}
+	return string(tiles)
+}
+
+// tileCoords returns the position in pixels of a player standing on the tile.
+func tileCoords(row, column float64) [2]float64 {
+	return [2]float64{column * TILE_SIZE, row * TILE_SIZE}
+}
+
+func TestValidateDeath(t *testing.T) {
+	explosionStart := durationToTicks(BOMB_EXPLOSION_TIME)
+	explosionEnd := explosionStart + durationToTicks(EXPLOSION_DURATION)
+
+	tests := []struct {
+		name    string
+		blocks  [][2]int            // Destroyable blocks of the map.
+		bomb    webmodel.BombCoords // The bomb, placed at tick 1.
+		player  [2]float64          // The position of the dying player.
+		ticks   uint64              // The number of ticks simulated after placing the bomb.
+		running bool                // False if the simulation didn't start.
+		wantErr bool
+	}{
+		{
+			name:    "hit in the row of the bomb",
+			bomb:    webmodel.BombCoords{Row: 1, Column: 1, Power: 2},
+			player:  tileCoords(1, 3),
+			ticks:   explosionStart + 1,
+			running: true,
+		},
+		{
+			name:    "hit in the column of the bomb",
+			bomb:    webmodel.BombCoords{Row: 1, Column: 3, Power: 2},
+			player:  tileCoords(3, 3),
+			ticks:   explosionStart + 1,
+			running: true,
+		},
+		{
+			name:    "out of the range of the bomb",
+			bomb:    webmodel.BombCoords{Row: 1, Column: 1, Power: 2},
+			player:  tileCoords(1, 5),
+			ticks:   explosionStart + 1,
+			running: true,
+			wantErr: true,
+		},
+		{
+			name:    "not in the row nor in the column of the bomb",
+			bomb:    webmodel.BombCoords{Row: 1, Column: 1, Power: 2},
+			player:  tileCoords(3, 3),
+			ticks:   explosionStart + 1,
+			running: true,
+			wantErr: true,
+		},
+		{
+			name:    "behind a solid block",
+			bomb:    webmodel.BombCoords{Row: 1, Column: 2, Power: 3},
+			player:  tileCoords(3, 2),
+			ticks:   explosionStart + 1,
+			running: true,
+			wantErr: true,
+		},
+		{
+			name:    "behind a destroyable block",
+			blocks:  [][2]int{{1, 4}},
+			bomb:    webmodel.BombCoords{Row: 1, Column: 2, Power: 3},
+			player:  tileCoords(1, 5),
+			ticks:   explosionStart + 1,
+			running: true,
+			wantErr: true,
+		},
+		{
+			name:    "between two tiles, one of them in the blast",
+			bomb:    webmodel.BombCoords{Row: 1, Column: 1, Power: 2},
+			player:  tileCoords(1, 3.5),
+			ticks:   explosionStart + 1,
+			running: true,
+		},
+		{
+			name:    "before the explosion",
+			bomb:    webmodel.BombCoords{Row: 1, Column: 1, Power: 2},
+			player:  tileCoords(1, 2),
+			ticks:   explosionStart - MAX_REWIND_TICKS - 2,
+			running: true,
+			wantErr: true,
+		},
+		{
+			name:    "just before the explosion, within the tolerance",
+			bomb:    webmodel.BombCoords{Row: 1, Column: 1, Power: 2},
+			player:  tileCoords(1, 2),
+			ticks:   explosionStart - MAX_REWIND_TICKS/2,
+			running: true,
+		},
+		{
+			name:    "just after the explosion, within the tolerance",
+			bomb:    webmodel.BombCoords{Row: 1, Column: 1, Power: 2},
+			player:  tileCoords(1, 2),
+			ticks:   explosionEnd + MAX_REWIND_TICKS/2,
+			running: true,
+		},
+		{
+			name:    "long after the explosion",
+			bomb:    webmodel.BombCoords{Row: 1, Column: 1, Power: 2},
+			player:  tileCoords(1, 2),
+			ticks:   explosionEnd + 3*MAX_REWIND_TICKS,
+			running: true,
+			wantErr: true,
+		},
+		{
+			name:   "the simulation didn't start",
+			bomb:   webmodel.BombCoords{Row: 1, Column: 1, Power: 2},
+			player: tileCoords(9, 15),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := New()
+			s.SetMap(testMap(test.blocks...))
+			s.Join("alice", 3)
+			s.MovePlayer("alice", test.player, nil)
+
+			if test.running {
+				s.Advance()
+				s.bombs = append(s.bombs, bomb{owner: "bob", coords: test.bomb, tick: s.Tick()})
+				for i := uint64(0); i < test.ticks; i++ {
+					s.Advance()
+				}
+			}
+
+			err := s.ValidateDeath("alice", s.Tick(), 0)
+			if test.wantErr && !errors.Is(err, ErrRejectedAction) {
+				t.Errorf("got error %v, want ErrRejectedAction", err)
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("got error %v, want the death to be accepted", err)
+			}
+		})
+	}
+}
+
+func TestValidateDeathUsesTheBlastOfTheExplosion(t *testing.T) {
+	// The explosion destroys the block at (1, 4): the tile behind it was not reached,
+	// even though the block is gone when the death is validated.
+	s := New()
+	s.SetMap(testMap([2]int{1, 4}))
+	s.Join("alice", 3)
+	s.MovePlayer("alice", tileCoords(1, 5), nil)
+	s.Advance()
+	s.bombs = append(s.bombs, bomb{owner: "bob", coords: webmodel.BombCoords{Row: 1, Column: 2, Power: 3}, tick: s.Tick()})
+	for i := uint64(0); i < durationToTicks(BOMB_EXPLOSION_TIME)+2; i++ {
+		s.Advance()
+	}
+
+	if tile := s.Tiles()[TileIndex(1, 4)]; tile != TILE_GRASS {
+		t.Fatalf("the block was not destroyed by the explosion: tile %q", tile)
+	}
+	if err := s.ValidateDeath("alice", s.Tick(), 0); !errors.Is(err, ErrRejectedAction) {
+		t.Errorf("got error %v, want ErrRejectedAction", err)
+	}
+}
+
+func TestPlaceBomb(t *testing.T) {
+	tests := []struct {
+		name    string
+		joined  bool       // False if the player didn't join the game.
+		before  [2]float64 // The position of the player at the rewound tick.
+		after   [2]float64 // The current position of the player.
+		late    bool       // True if the player joined after the rewound tick.
+		wantErr bool
+	}{
+		{
+			name:   "next to the player at the rewound tick",
+			joined: true,
+			before: tileCoords(1, 1),
+			after:  tileCoords(1, 5),
+		},
+		{
+			name:    "far from the player at the rewound tick",
+			joined:  true,
+			before:  tileCoords(1, 5),
+			after:   tileCoords(1, 1),
+			wantErr: true,
+		},
+		{
+			name:   "not in the snapshot, next to the current position",
+			joined: true,
+			after:  tileCoords(1, 1),
+			late:   true,
+		},
+		{
+			name:    "not in the snapshot, far from the current position",
+			joined:  true,
+			after:   tileCoords(1, 5),
+			late:    true,
+			wantErr: true,
+		},
+		{
+			name:    "not in the game",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := New()
+			s.SetMap(testMap())
+			if test.joined && !test.late {
+				s.Join("alice", 3)
+				s.MovePlayer("alice", test.before, nil)
+			}
+			rewound := s.Advance()
+			if test.joined && test.late {
+				s.Join("alice", 3)
+			}
+			s.MovePlayer("alice", test.after, nil)
+			s.Advance()
+
+			err := s.PlaceBomb("alice", webmodel.BombCoords{Row: 1, Column: 1, Power: 1}, rewound, 0)
+			if test.wantErr && !errors.Is(err, ErrRejectedAction) {
+				t.Errorf("got error %v, want ErrRejectedAction", err)
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("got error %v, want the bomb to be accepted", err)
+			}
+		})
+	}
+}
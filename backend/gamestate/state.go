@@ -0,0 +1,261 @@
+package gamestate
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// Constants controlling how often the room state is sent to the clients.
+const (
+	TICK_INTERVAL     = 50 * time.Millisecond // The state is advanced and sent 20 times per second.
+	KEYFRAME_INTERVAL = 40                    // Every 40th tick (2 seconds) a full keyframe is sent to everybody.
+	KEYFRAME_RETRY    = 10                    // A client without a usable acknowledged tick gets a keyframe at most every 10 ticks.
+	HISTORY_SIZE      = 64                    // Number of past snapshots kept as possible delta bases.
+)
+
+// snapshot is a copy of the players' state at a given tick.
+type snapshot struct {
+	tick    uint64
+	players map[string]webmodel.PlayerState
+}
+
+// State holds the authoritative state of a room that is sent to the clients as delta snapshots.
+// It is safe for concurrent use.
+type State struct {
+	sync.Mutex
+
+	tick    uint64                          // The current server tick.
+	players map[string]webmodel.PlayerState // The current state of every player.
+
+	// history is a ring buffer of past snapshots, indexed by tick % HISTORY_SIZE.
+	history [HISTORY_SIZE]snapshot
+
+	// joined stores the players who joined the game, so a player who left it can't join again.
+	joined map[string]bool
+
+	// acks stores the last tick acknowledged by every client.
+	acks map[string]uint64
+
+	// keyframes stores the tick of the last keyframe sent to every client which did not acknowledge it yet.
+	keyframes map[string]uint64
+
+	// bombs placed in the room whose explosion can still be rewound to.
+	bombs []bomb
+
+	// tiles is the game map with the destroyed blocks and the revealed power-ups.
+	tiles []byte
+
+	running atomic.Bool // True while a goroutine sends state updates of this room.
+	ended   atomic.Bool // True once the match of this room is over, see End.
+}
+
+// New creates an empty room state.
+func New() *State {
+	return &State{
+		players:   make(map[string]webmodel.PlayerState),
+		joined:    make(map[string]bool),
+		acks:      make(map[string]uint64),
+		keyframes: make(map[string]uint64),
+	}
+}
+
+// Start marks the state as running. It returns false if the state was already started,
+// so only one goroutine sends the updates of a room, or if the match is over.
+func (s *State) Start() bool {
+	if s.ended.Load() {
+		return false
+	}
+	return s.running.CompareAndSwap(false, true)
+}
+
+// End marks the match as over, the state can't be started again.
+func (s *State) End() {
+	s.ended.Store(true)
+}
+
+// Ended reports whether the match is over.
+func (s *State) Ended() bool {
+	return s.ended.Load()
+}
+
+// Stop marks the state as not running, so it can be started again.
+func (s *State) Stop() {
+	s.running.Store(false)
+}
+
+// Tick returns the current server tick.
+func (s *State) Tick() uint64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.tick
+}
+
+// MovePlayer updates the position of the player. If `spriteInfo` is nil, the previous animation state is kept.
+// The players who are not in the game (see Join) are ignored.
+func (s *State) MovePlayer(userName string, coords [2]float64, spriteInfo *webmodel.SpriteInfo) {
+	s.Lock()
+	defer s.Unlock()
+
+	player, ok := s.players[userName]
+	if !ok {
+		return
+	}
+	player.Coords = coords
+	if spriteInfo != nil {
+		sprite := *spriteInfo
+		player.SpriteInfo = &sprite
+	}
+	s.players[userName] = player
+}
+
+// SetLives updates the number of lives of the player. The players who are not in the game are ignored.
+func (s *State) SetLives(userName string, lives int) {
+	s.Lock()
+	defer s.Unlock()
+
+	player, ok := s.players[userName]
+	if !ok {
+		return
+	}
+	player.Lives = lives
+	s.players[userName] = player
+}
+
+// Join adds the player to the game with the given lives. It returns false if the player
+// already joined the game, even if the player left it since.
+func (s *State) Join(userName string, lives int) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.joined[userName] {
+		return false
+	}
+	s.joined[userName] = true
+	s.players[userName] = webmodel.PlayerState{UserName: userName, Lives: lives}
+	return true
+}
+
+// Errors of AcceptInput.
+var (
+	ErrOutOfOrderInput = errors.New("duplicate or out-of-order input")
+	ErrNotInGame       = errors.New("the player is not in the game")
+)
+
+// AcceptInput checks the sequence number of a player's input and records it as the last processed one.
+// It returns ErrOutOfOrderInput for duplicate or out-of-order inputs, which must be dropped,
+// and ErrNotInGame for the players who didn't start the game or left it.
+// Inputs without a sequence number (0) of the players in the game are always accepted.
+func (s *State) AcceptInput(userName string, seq uint64) error {
+	s.Lock()
+	defer s.Unlock()
+
+	player, ok := s.players[userName]
+	if !ok {
+		return ErrNotInGame
+	}
+	if seq == 0 {
+		return nil
+	}
+	if seq <= player.LastSeq {
+		return ErrOutOfOrderInput
+	}
+	player.LastSeq = seq
+	s.players[userName] = player
+	return nil
+}
+
+// RemovePlayer deletes the player and their acknowledgements from the state.
+func (s *State) RemovePlayer(userName string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.players, userName)
+	delete(s.acks, userName)
+	delete(s.keyframes, userName)
+}
+
+// Advance increments the tick and stores a copy of the current state in the history.
+// It returns the new tick.
+func (s *State) Advance() uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	s.tick++
+	players := make(map[string]webmodel.PlayerState, len(s.players))
+	for name, player := range s.players {
+		players[name] = player
+	}
+	s.history[s.tick%HISTORY_SIZE] = snapshot{tick: s.tick, players: players}
+	s.explodeBombs()
+	s.pruneBombs()
+	return s.tick
+}
+
+// Ack records that the client `userName` received the update of the given tick.
+// Acknowledgements older than the previous one or from the future are ignored.
+func (s *State) Ack(userName string, tick uint64) {
+	s.Lock()
+	defer s.Unlock()
+
+	if tick > s.acks[userName] && tick <= s.tick {
+		s.acks[userName] = tick
+	}
+}
+
+// UpdateFor creates the state update for the client `userName`.
+// A keyframe is created every KEYFRAME_INTERVAL ticks, and if the client has not acknowledged any tick yet
+// or its acknowledged snapshot is no longer in the history; such a client gets a keyframe at most every
+// KEYFRAME_RETRY ticks, until it acknowledges one.
+// Otherwise, a delta against the acknowledged snapshot is created.
+// The second value is false if nothing has changed and there is nothing to send.
+func (s *State) UpdateFor(userName string) (webmodel.RoomStateUpdate, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	current := s.history[s.tick%HISTORY_SIZE]
+	baseTick := s.acks[userName]
+	base := s.history[baseTick%HISTORY_SIZE]
+
+	noBase := baseTick == 0 || base.tick != baseTick
+	if noBase || s.tick%KEYFRAME_INTERVAL == 0 {
+		if lastKeyframe, sent := s.keyframes[userName]; noBase && sent && s.tick-lastKeyframe < KEYFRAME_RETRY && s.tick%KEYFRAME_INTERVAL != 0 {
+			return webmodel.RoomStateUpdate{}, false // the last keyframe may still be on its way
+		}
+		s.keyframes[userName] = s.tick
+		update := webmodel.RoomStateUpdate{Tick: current.tick, Keyframe: true}
+		for _, player := range current.players {
+			update.Players = append(update.Players, player)
+		}
+		return update, true
+	}
+
+	update := webmodel.RoomStateUpdate{Tick: current.tick, BaseTick: baseTick}
+	for name, player := range current.players {
+		basePlayer, ok := base.players[name]
+		if !ok || !samePlayerState(basePlayer, player) {
+			update.Players = append(update.Players, player)
+		}
+	}
+	for name := range base.players {
+		if _, ok := current.players[name]; !ok {
+			update.Removed = append(update.Removed, name)
+		}
+	}
+
+	return update, len(update.Players) != 0 || len(update.Removed) != 0
+}
+
+// samePlayerState reports whether two player states are equal.
+func samePlayerState(a, b webmodel.PlayerState) bool {
+	if a.UserName != b.UserName || a.Coords != b.Coords || a.Lives != b.Lives || a.LastSeq != b.LastSeq {
+		return false
+	}
+	if a.SpriteInfo == nil || b.SpriteInfo == nil {
+		return a.SpriteInfo == b.SpriteInfo
+	}
+	return *a.SpriteInfo == *b.SpriteInfo
+}
@@ -0,0 +1,177 @@
+package gamestate
+
+import (
+	"github.com/Pomog/bomberman/backend/mapgen"
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// Tile types of the game map. The blocks are generated by mapgen,
+// the power-ups appear when the blocks hiding them are destroyed.
+const (
+	TILE_SOLID         byte = 'B' // Indestructible block.
+	TILE_GRASS         byte = 'G' // Free tile.
+	TILE_BLOCK         byte = 'D' // Destroyable block.
+	TILE_BLOCK_BOMB    byte = 'O' // Destroyable block hiding a bomb power-up.
+	TILE_BLOCK_FLAME   byte = 'F' // Destroyable block hiding a flame power-up.
+	TILE_BLOCK_SPEED   byte = 'M' // Destroyable block hiding a speed power-up.
+	TILE_POWERUP_BOMB  byte = 'o' // Bomb power-up lying on the grass.
+	TILE_POWERUP_FLAME byte = 'f' // Flame power-up lying on the grass.
+	TILE_POWERUP_SPEED byte = 'm' // Speed power-up lying on the grass.
+)
+
+// revealedPowerUps maps the blocks hiding a power-up to the power-up revealed when they are destroyed.
+var revealedPowerUps = map[byte]byte{
+	TILE_BLOCK_BOMB:  TILE_POWERUP_BOMB,
+	TILE_BLOCK_FLAME: TILE_POWERUP_FLAME,
+	TILE_BLOCK_SPEED: TILE_POWERUP_SPEED,
+}
+
+// BombInfo is the public information about a bomb placed in the room.
+type BombInfo struct {
+	Owner      string              // The player who placed the bomb.
+	Coords     webmodel.BombCoords // The position and the power of the bomb.
+	ExplodesAt uint64              // The tick the explosion starts.
+	EndsAt     uint64              // The tick the explosion ends.
+}
+
+// IsBlock reports whether the tile is a destroyable block.
+func IsBlock(tile byte) bool {
+	return tile == TILE_BLOCK || revealedPowerUps[tile] != 0
+}
+
+// IsPowerUp reports whether the tile is a power-up lying on the grass.
+func IsPowerUp(tile byte) bool {
+	return tile == TILE_POWERUP_BOMB || tile == TILE_POWERUP_FLAME || tile == TILE_POWERUP_SPEED
+}
+
+// TileIndex returns the index of the tile in the map string.
+func TileIndex(row, column int) int {
+	return row*mapgen.MAP_COLUMNS + column
+}
+
+// SetMap sets the game map the room state is simulated on.
+func (s *State) SetMap(gameMap string) {
+	s.Lock()
+	defer s.Unlock()
+	s.tiles = []byte(gameMap)
+}
+
+// Tiles returns a copy of the current game map, with the destroyed blocks and the revealed power-ups.
+func (s *State) Tiles() []byte {
+	s.Lock()
+	defer s.Unlock()
+	return append([]byte(nil), s.tiles...)
+}
+
+// PickPowerUp removes the power-up lying on the tile. It returns the type of the power-up,
+// or 0 if there was no power-up.
+func (s *State) PickPowerUp(row, column int) byte {
+	s.Lock()
+	defer s.Unlock()
+
+	index := TileIndex(row, column)
+	if row < 0 || column < 0 || column >= mapgen.MAP_COLUMNS || index >= len(s.tiles) || !IsPowerUp(s.tiles[index]) {
+		return 0
+	}
+	powerUp := s.tiles[index]
+	s.tiles[index] = TILE_GRASS
+	return powerUp
+}
+
+// Bombs returns the bombs of the room whose explosion has not ended yet.
+func (s *State) Bombs() []BombInfo {
+	s.Lock()
+	defer s.Unlock()
+
+	bombs := make([]BombInfo, 0, len(s.bombs))
+	for _, b := range s.bombs {
+		info := b.info()
+		if info.EndsAt >= s.tick {
+			bombs = append(bombs, info)
+		}
+	}
+	return bombs
+}
+
+// Player returns the current state of the player.
+func (s *State) Player(userName string) (webmodel.PlayerState, bool) {
+	s.Lock()
+	defer s.Unlock()
+	player, ok := s.players[userName]
+	return player, ok
+}
+
+// Players returns the current state of all players.
+func (s *State) Players() []webmodel.PlayerState {
+	s.Lock()
+	defer s.Unlock()
+
+	players := make([]webmodel.PlayerState, 0, len(s.players))
+	for _, player := range s.players {
+		players = append(players, player)
+	}
+	return players
+}
+
+// Running reports whether the state updates of the room are being sent, i.e. the game is on.
+func (s *State) Running() bool {
+	return s.running.Load()
+}
+
+// BlastTiles returns the indexes of the tiles reached by the explosion of a bomb on the given map.
+// The explosion spreads from the bomb in four directions up to its power; it is stopped by
+// the solid blocks and destroys the first destroyable block on its way.
+func BlastTiles(tiles []byte, coords webmodel.BombCoords) []int {
+	blast := []int{TileIndex(coords.Row, coords.Column)}
+	directions := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+	for _, direction := range directions {
+		for step := 1; step <= coords.Power; step++ {
+			row, column := coords.Row+direction[0]*step, coords.Column+direction[1]*step
+			if row < 0 || row >= mapgen.MAP_ROWS || column < 0 || column >= mapgen.MAP_COLUMNS {
+				break
+			}
+			index := TileIndex(row, column)
+			if index >= len(tiles) || tiles[index] == TILE_SOLID {
+				break
+			}
+			blast = append(blast, index)
+			if IsBlock(tiles[index]) {
+				break
+			}
+		}
+	}
+	return blast
+}
+
+// explodeBombs destroys the blocks reached by the bombs whose explosion starts at the current tick.
+// It must be called with the state locked.
+func (s *State) explodeBombs() {
+	for i := range s.bombs {
+		b := &s.bombs[i]
+		if b.exploded || s.tick < b.info().ExplodesAt {
+			continue
+		}
+		b.exploded = true
+		b.blast = BlastTiles(s.tiles, b.coords)
+
+		for _, index := range b.blast {
+			tile := s.tiles[index]
+			if powerUp, ok := revealedPowerUps[tile]; ok {
+				s.tiles[index] = powerUp
+			} else if tile == TILE_BLOCK {
+				s.tiles[index] = TILE_GRASS
+			}
+		}
+	}
+}
+
+// info returns the public information about the bomb.
+func (b bomb) info() BombInfo {
+	explodesAt := b.tick + durationToTicks(BOMB_EXPLOSION_TIME)
+	return BombInfo{
+		Owner:      b.owner,
+		Coords:     b.coords,
+		ExplodesAt: explodesAt,
+		EndsAt:     explodesAt + durationToTicks(EXPLOSION_DURATION),
+	}
+}
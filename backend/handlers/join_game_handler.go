@@ -3,9 +3,11 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"github.com/Pomog/bomberman/backend/bots"
 	wsconnection "github.com/Pomog/bomberman/backend/connection"
 	"github.com/Pomog/bomberman/backend/controllers"
 	"github.com/Pomog/bomberman/backend/errorhandle"
+	"github.com/Pomog/bomberman/backend/gamerules"
 	"github.com/Pomog/bomberman/backend/helpers"
 	"github.com/Pomog/bomberman/backend/mapgen"
 	"github.com/Pomog/bomberman/backend/server"
@@ -14,6 +16,7 @@ import (
 	"github.com/gorilla/websocket"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 // JOIN_GAME_URL URL path for joining the game
@@ -21,12 +24,15 @@ const (
 	JOIN_GAME_URL = "/joinGame"
 )
 
-// MAX_ROOM_SIZE Maximum number of players allowed in a room
-const MAX_ROOM_SIZE = 4
+// BOT_FILL_TIMEOUT Time after the waiting room creation when the empty slots are filled with bots
+const BOT_FILL_TIMEOUT = 15 * time.Second
 
 // Err_Duplicate_User Error message for duplicate usernames
 var Err_Duplicate_User = errors.New("duplicate user name")
 
+// Err_Kicked_User Error message for a user kicked from the waiting room by its host
+var Err_Kicked_User = errors.New("kicked from the room")
+
 // Context key type to store user session
 type contestKey string
 
@@ -73,15 +79,8 @@ func JoinGame(app *server.Application, wsReplyersSet wsconnection.WSmux) http.Ha
 			return
 		}
 
-		// Create a waiting room if none exists
-		if app.WaitingRoom == nil {
-			app.WaitingRoom, err = createRoom(app.Hub)
-			if err != nil {
-				errorhandle.BadRequestError(app, w, r, err.Error())
-				return
-			}
-			app.InfoLog.Printf("WaitingRoom created, id: %s", app.WaitingRoom)
-		}
+		// The protocol version is checked after the upgrade, so the client can be told why it is rejected
+		protocolVersion, versionErr := webmodel.ParseProtocolVersion(r.URL.Query().Get(webmodel.VERSION_PARAM))
 
 		// Upgrade HTTP connection to WebSocket
 		conn, err := app.Upgrader.Upgrade(w, r, nil)
@@ -92,10 +91,15 @@ func JoinGame(app *server.Application, wsReplyersSet wsconnection.WSmux) http.Ha
 
 		app.InfoLog.Printf("Connection %p to '%s' upgraded to WebSocket protocol", conn, r.URL.Path)
 
+		if versionErr != nil {
+			rejectProtocolVersion(app, conn, versionErr)
+			return
+		}
+
 		// Create a user connection and validate uniqueness
-		currentConnection, err := createClient(app, userName, conn, wsReplyersSet)
-		if err == Err_Duplicate_User {
-			// Send error message to the client if username is duplicate
+		currentConnection, err := createClient(app, userName, protocolVersion, conn, wsReplyersSet)
+		if err == Err_Duplicate_User || err == Err_Kicked_User {
+			// Send error message to the client if username is duplicate or was kicked
 			wsMessage, err1 := webmodel.CreateJSONMessage(webmodel.UsersInRoom, webmodel.ERROR_RESULT, err.Error())
 			if err1 != nil {
 				conn.Close()
@@ -125,10 +129,45 @@ func JoinGame(app *server.Application, wsReplyersSet wsconnection.WSmux) http.Ha
 			return
 		}
 
+		// Backfill the chat with the last messages of the room and global channels
+		err = controllers.SendChatHistory(app, currentConnection)
+		if err != nil {
+			logErrorAndCloseConn(app, conn, "Sending chat history failed", err)
+			return
+		}
+
+		// The first player who joined is the host of the room
+		err = controllers.SendLobby(app, currentConnection)
+		if err != nil {
+			logErrorAndCloseConn(app, conn, "Sending lobby settings failed", err)
+			return
+		}
+
+		// The new player is not ready, the countdown to the start of the game stops if it was running
+		controllers.UpdateReadyCheck(app, currentConnection.Client.Room)
+
 		app.InfoLog.Printf("User '%s' joined room '%s'", userName, currentConnection.Client.Room)
 	}
 }
 
+/*
+rejectProtocolVersion tells a client with an unsupported protocol version which versions the server supports,
+then closes the connection with the CLOSE_UNSUPPORTED_PROTOCOL code.
+The client doesn't join any room.
+*/
+func rejectProtocolVersion(app *server.Application, conn *websocket.Conn, versionErr error) {
+	app.InfoLog.Printf("Connection %p is rejected: %v", conn, versionErr)
+
+	hello, err := webmodel.CreateJSONMessage(webmodel.Hello, webmodel.ERROR_RESULT, webmodel.NewHello(0, false))
+	if err == nil {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		conn.WriteMessage(websocket.TextMessage, hello)
+	}
+	closeMessage := websocket.FormatCloseMessage(webmodel.CLOSE_UNSUPPORTED_PROTOCOL, versionErr.Error())
+	conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+	conn.Close()
+}
+
 /*
 getChatParams extracts the username from the request URL.
 
@@ -147,13 +186,13 @@ func getChatParams(url *url.URL) (userName string, err error) {
 }
 
 /*
-createRoom initializes a new game room in the hub.
+createRoom initializes a new game room in the hub, played with the given game rules.
 
 Returns:
 - *wshub.Room: Pointer to the created room
 - error: Error if room creation fails
 */
-func createRoom(hub *websocket_hub.Hub) (*websocket_hub.Room, error) {
+func createRoom(hub *websocket_hub.Hub, rules gamerules.GameRules) (*websocket_hub.Room, error) {
 	var roomID string
 
 	// Generate a unique ID for the room
@@ -168,41 +207,117 @@ func createRoom(hub *websocket_hub.Hub) (*websocket_hub.Room, error) {
 		return nil, fmt.Errorf("Room with ID '%s' was already created, try again", roomID)
 	}
 
-	// Assign a randomly generated game map
-	waitingRoom.GameMap = mapgen.DefaultRandomMapGenerator()
+	// Assign a randomly generated game map, with the template and the densities of the rules
+	gameMap, err := mapgen.GenerateMap(rules.MapTemplate, rules.BlockDensity, rules.PowerUpDensity)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot generate the map of room '%s': %v", roomID, err)
+	}
+	waitingRoom.SetGame(rules, gameMap)
 
 	return waitingRoom, nil
 }
 
 /*
-createClient creates a new user connection and assigns them to the waiting room.
+scheduleBotFill fills the empty slots of the waiting room with bots after BOT_FILL_TIMEOUT.
+Nothing happens if the room was closed for new players or left by all humans before the timeout.
+
+Params:
+- app: Application instance holding the waiting room
+- room: The waiting room to fill
+*/
+func scheduleBotFill(app *server.Application, room *websocket_hub.Room) {
+	time.AfterFunc(BOT_FILL_TIMEOUT, func() {
+		// No player joins the room while it is filled
+		app.WaitingRoomMutex.Lock()
+		defer app.WaitingRoomMutex.Unlock()
+
+		if app.WaitingRoom != room || !room.HasHumans() {
+			return
+		}
+
+		// The game rules, chosen by the host, tell how many bots join the room and how well they play
+		rules := room.Rules()
+		size := min(rules.MaxPlayers, room.Size()+rules.Bots)
+		difficulty, ok := bots.Difficulties[rules.BotDifficulty]
+		if !ok {
+			difficulty = bots.NORMAL
+		}
+		_, err := bots.FillRoom(app.Hub, room, size, difficulty, app.InfoLog)
+		if err != nil {
+			app.ErrLog.Printf("Cannot fill room '%s' with bots: %v", room, err)
+		}
+		// The bots are ready, the countdown starts if the humans are ready too
+		controllers.UpdateReadyCheck(app, room)
+
+		// The room is full now, the next players go to a new room
+		if room.Size() >= rules.MaxPlayers {
+			app.WaitingRoom = nil
+		}
+	})
+}
+
+/*
+createClient creates a new user connection and assigns them to the waiting room,
+which is created if there is none.
 
 Returns:
 - *wsconnection.UsersConnection: Created WebSocket connection
 - error: Error if user already exists or creation fails
 */
-func createClient(app *server.Application, userName string, conn *websocket.Conn, wsReplyersSet wsconnection.WSmux) (*wsconnection.UsersConnection, error) {
+func createClient(app *server.Application, userName string, protocolVersion int, conn *websocket.Conn, wsReplyersSet wsconnection.WSmux) (*wsconnection.UsersConnection, error) {
+	app.WaitingRoomMutex.Lock()
+	defer app.WaitingRoomMutex.Unlock()
+
+	// Create a waiting room if none exists
+	if app.WaitingRoom == nil {
+		room, err := createRoom(app.Hub, app.GamePresets.Default())
+		if err != nil {
+			return nil, err
+		}
+		app.WaitingRoom = room
+		app.InfoLog.Printf("WaitingRoom created, id: %s", room)
+		scheduleBotFill(app, room)
+	}
+	room := app.WaitingRoom
+
 	// Check if user already exists in the room
-	if app.WaitingRoom.ContainsUser(userName) {
+	if room.ContainsUser(userName) {
 		return nil, Err_Duplicate_User
 	}
+	// A kicked user can't join the room again
+	if app.Moderator.IsKicked(room.ID, userName) {
+		return nil, Err_Kicked_User
+	}
 
-	// Create a new client in the WebSocket hub
-	client, err := websocket_hub.NewClient(app.Hub, userName, app.WaitingRoom, conn, nil, nil)
-	if err != nil {
-		return nil, fmt.Errorf("createClient:: NewClient failed: %v", err)
+	// Create a new client, and its connection
+	client := websocket_hub.CreateClient(userName, room, conn, nil)
+	currentConnection := &wsconnection.UsersConnection{
+		Client:          client,
+		WsServer:        wsReplyersSet,
+		ProtocolVersion: protocolVersion,
+	}
+
+	// From version 2, the client learns the negotiated version and the features of the server first,
+	// before any message of the room
+	if protocolVersion >= webmodel.HELLO_PROTOCOL_VERSION {
+		_, err := currentConnection.SendSuccessMessage(webmodel.Hello, webmodel.NewHello(protocolVersion, client.Binary))
+		if err != nil {
+			return nil, fmt.Errorf("createClient:: sending hello failed: %v", err)
+		}
+	}
+
+	// Register the client in the WebSocket hub
+	if err := client.Register(app.Hub); err != nil {
+		return nil, fmt.Errorf("createClient:: Register failed: %v", err)
 	}
 
-	// Reset the waiting room if it reaches the maximum size
-	if app.WaitingRoom.Size() == MAX_ROOM_SIZE {
+	// Reset the waiting room if it reaches the maximum size of its game rules
+	if room.Size() >= room.Rules().MaxPlayers {
 		app.WaitingRoom = nil
 	}
 
-	app.InfoLog.Printf("New client in room '%s' is created: %s", app.WaitingRoom, client)
+	app.InfoLog.Printf("New client in room '%s' is created: %s", room, client)
 
 	// Return the WebSocket user connection
-	return &wsconnection.UsersConnection{
-		Client:   client,
-		WsServer: wsReplyersSet,
-	}, nil
+	return currentConnection, nil
 }
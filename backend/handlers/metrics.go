@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+
+	wsconnection "github.com/Pomog/bomberman/backend/connection"
+	"github.com/Pomog/bomberman/backend/server"
+)
+
+// METRICS_URL URL path of the server metrics
+const METRICS_URL = "/metrics"
+
+// MetricsResponse is the structure of the metrics response
+type MetricsResponse struct {
+	Rooms      int                                    `json:"rooms"`      // Number of registered rooms
+	Goroutines int                                    `json:"goroutines"` // Number of running goroutines
+	Messages   map[string]wsconnection.MessageMetrics `json:"messages"`   // Statistics of the handled WebSocket messages by type
+}
+
+// Metrics handler returns the statistics of the server as JSON
+func Metrics(app *server.Application, metrics *wsconnection.Metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Access-Control-Allow-Origin", "*")
+
+		response := MetricsResponse{
+			Rooms:      app.Hub.Rooms.Len(),
+			Goroutines: runtime.NumGoroutine(),
+			Messages:   metrics.Snapshot(),
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -37,6 +37,18 @@ func CreateLoggers() (errLog, infoLog *log.Logger) {
 	return
 }
 
+// CreateAuditLogger initializes the logger of the moderation actions
+// - The actions are written to `audit.log`, or stdout if the file cannot be opened
+func CreateAuditLogger(errLog *log.Logger) *log.Logger {
+	auditLogFile, err := os.OpenFile("audit.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o664)
+	if err != nil {
+		errLog.Printf("Cannot open audit log file: %s\nUsing stdout for the audit log instead.", err)
+		auditLogFile = os.Stdout
+	}
+
+	return log.New(auditLogFile, "AUDIT - App: ", log.Ldate|log.Ltime|log.Lmicroseconds)
+}
+
 // GetFunctionName returns the function name of a given function reference
 func GetFunctionName(i interface{}) string {
 	return runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
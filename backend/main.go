@@ -1,7 +1,9 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"github.com/Pomog/bomberman/backend/gamerules"
 	"github.com/Pomog/bomberman/backend/routes"
 	"github.com/Pomog/bomberman/backend/server"
 	"log"
@@ -16,9 +18,13 @@ func main() {
 	// Configure logging to include timestamp and source file details
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
+	// The preset of the game rules of the new rooms, e.g. `go run . -rules suddenDeath`
+	gamePreset := flag.String("rules", gamerules.CLASSIC.Preset, "preset of the game rules of the new rooms")
+	flag.Parse()
+
 	// Create the application instance with the given address (localhost:8000)
 	addr := fmt.Sprintf(":%s", port)
-	app := server.New(addr)
+	app := server.New(addr, *gamePreset)
 
 	// Error handling: If app creation fails, terminate the program and log the error
 	if app == nil {
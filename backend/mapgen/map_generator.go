@@ -1,18 +1,88 @@
 package mapgen
 
 import (
+	"fmt"
 	"math/rand"
-	"time"
+	"sort"
 )
 
-// DefaultRandomMapGenerator is the main function used to generate a randomized game map.
-// It uses a predefined `baseMap` as the template and `charSet` to determine which tiles
-// will replace certain elements in the base map. This function acts as a wrapper around
-// `randomMapGenerator`, providing default values.
-func DefaultRandomMapGenerator() string {
-	return randomMapGenerator(baseMap, charSet)
+// Names of the map templates, chosen by the host of the room.
+const (
+	MAP_TEMPLATE_CLASSIC = "classic" // The `baseMap`, with a solid block every second tile.
+	MAP_TEMPLATE_OPEN    = "open"    // The `openMap`, without solid blocks inside the boundary.
+)
+
+// Default densities of the blocks of GenerateMap.
+const (
+	DEFAULT_BLOCK_DENSITY    = 73 // The percentage of the grass tiles replaced by a destroyable block.
+	DEFAULT_POWER_UP_DENSITY = 37 // The percentage of the destroyable blocks hiding a power-up.
+)
+
+// templates maps the names of the map templates to the templates.
+var templates = map[string]string{
+	MAP_TEMPLATE_CLASSIC: baseMap,
+	MAP_TEMPLATE_OPEN:    openMap,
+}
+
+// Templates returns the names of the map templates, sorted.
+func Templates() []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasTemplate returns true if there is a map template with this name.
+func HasTemplate(template string) bool {
+	_, ok := templates[template]
+	return ok
+}
+
+/*
+GenerateMap generates a randomized game map from the named template, whose spawn areas ('S') remain grass ('G'),
+with `blockDensity` percent of the grass tiles replaced by a destroyable block
+and `powerUpDensity` percent of the destroyable blocks hiding a power-up.
+It uses the random source of math/rand, seeded at startup and safe for concurrent use,
+as the maps of several rooms can be generated at the same time.
+
+Returns an error if there is no template with this name.
+*/
+func GenerateMap(template string, blockDensity, powerUpDensity int) (string, error) {
+	templateMap, ok := templates[template]
+	if !ok {
+		return "", fmt.Errorf("unknown map template '%s'", template)
+	}
+
+	randomMap := []byte(templateMap)
+	for i, tile := range randomMap {
+		if tile == 'S' {
+			// Spawn areas must remain grass ('G')
+			randomMap[i] = 'G'
+			continue
+		}
+		if tile != 'G' {
+			continue
+		}
+		// The grass becomes a block with the chosen density, and the block hides a power-up with the chosen density
+		if rand.Intn(100) >= blockDensity {
+			continue
+		}
+		randomMap[i] = 'D'
+		if rand.Intn(100) < powerUpDensity {
+			randomMap[i] = powerUps[rand.Intn(len(powerUps))]
+		}
+	}
+	return string(randomMap), nil
 }
 
+// Size of the game map in tiles, the same as MAP_ROWS and MAP_COLUMNS in the frontend.
+const (
+	MAP_ROWS    = 11
+	MAP_COLUMNS = 17
+)
+
 // baseMap represents the initial structure of the game map.
 // The map is 11 rows by 17 columns, using specific characters to define different tiles:
 //
@@ -31,50 +101,22 @@ const baseMap = ("BBBBBBBBBBBBBBBBB" +
 	"BSSGGGGGGGGGGGSSB" +
 	"BBBBBBBBBBBBBBBBB")
 
-// charSet defines the possible replacement tiles for grass ('G') blocks in the `baseMap`.
-// It includes the following tiles:
-//
-// - 'G' (GRASS): The default grass tile, which remains unchanged.
-// - 'D' (DBLOCK): A destroyable block that can be broken during gameplay.
-// - 'O' (DBLOCKBOMB): A destroyable block that drops a bomb powerup when destroyed.
-// - 'F' (DBLOCKFLAME): A destroyable block that drops a flame powerup when destroyed.
-// - 'M' (DBLOCKSPEED): A destroyable block that drops a movement speed powerup when destroyed.
-//
-// Adjusting the frequency of characters in `charSet` will influence the probability of different blocks appearing.
-const charSet = "GGGDDDDDOFM"
-
-// randomMapGenerator takes a `baseMap` template and replaces certain tiles ('G') with randomly chosen elements
-// from `charSet`. It ensures that spawn areas ('S') always remain grass ('G').
-func randomMapGenerator(baseMap string, charSet string) (randomMap string) {
-	randomMap = ""
-	for i := 0; i < len(baseMap); i++ {
-		currentChar := string(baseMap[i])
-		switch currentChar {
-		case "G":
-			// Replace 'G' (grass) with a randomly selected character from charSet
-			randomMap += stringWithCharset(1, charSet)
-		case "S":
-			// Spawn areas must remain grass ('G')
-			randomMap += "G"
-		default:
-			// Keep other characters (e.g., 'B') unchanged
-			randomMap += currentChar
-		}
-	}
-	return randomMap
-}
-
-// seededRand is a global random number generator seeded with the current time.
-// This ensures that each map generation produces different results.
-var seededRand *rand.Rand = rand.New(
-	rand.NewSource(time.Now().UnixNano()))
+// openMap is the template of an open map: the same as `baseMap` without the solid blocks inside the boundary.
+const openMap = ("BBBBBBBBBBBBBBBBB" +
+	"BSSGGGGGGGGGGGSSB" +
+	"BSGGGGGGGGGGGGGSB" +
+	"BGGGGGSGGGGGGGGGB" +
+	"BGGGGGGGGGGGGGGGB" +
+	"BGGGGGGGGSGGGGGGB" +
+	"BGGGGGGGGGGGGGGGB" +
+	"BGGGSSGGGGSGGGGGB" +
+	"BSGGGGGGGGGGGGGSB" +
+	"BSSGGGGGGGGGGGSSB" +
+	"BBBBBBBBBBBBBBBBB")
 
-// stringWithCharset generates a random string of the specified length using characters from `charset`.
-// In this case, it is used to randomly replace 'G' tiles in the base map with elements from `charSet`.
-func stringWithCharset(length int, charset string) string {
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))] // Select a random character from `charset`
-	}
-	return string(b)
-}
+// powerUps are the destroyable blocks which drop a power-up when destroyed:
+//
+// - 'O' (DBLOCKBOMB): a bomb power-up.
+// - 'F' (DBLOCKFLAME): a flame power-up.
+// - 'M' (DBLOCKSPEED): a movement speed power-up.
+const powerUps = "OFM"
@@ -0,0 +1,132 @@
+package moderation
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants of the moderation.
+const (
+	CLOSE_KICKED = 4004 // WebSocket close code sent to the players kicked by the room host.
+
+	DEFAULT_MUTE_DURATION = 5 * time.Minute // The duration of a mute without a duration.
+	MAX_MUTE_DURATION     = time.Hour       // The maximal duration of a mute.
+)
+
+// Constants representing the moderation actions, in the audit log and in the `moderation` messages.
+const (
+	ACTION_MUTE   = "mute"
+	ACTION_UNMUTE = "unmute"
+	ACTION_KICK   = "kick"
+	ACTION_DELETE = "delete" // The room host deleted a chat message of another player.
+	ACTION_FILTER = "filter" // A chat message had filtered words, the actor is the server.
+)
+
+// Moderator keeps the moderation state of the rooms: the muted players, the kicked players who can't rejoin,
+// and writes every moderation action to the audit log.
+// The players are identified by the ID of their room and their name, which is unique in a room.
+// The state of a room is kept until the room is forgotten.
+type Moderator struct {
+	Filter *WordFilter // Masks the filtered words of the chat messages
+	Audit  *log.Logger // The audit log of the moderation actions
+
+	mutex  sync.Mutex
+	mutes  map[string]map[string]time.Time // The end of the mutes, by room ID and player name
+	kicked map[string]map[string]bool      // The kicked players, by room ID and player name
+}
+
+// NewModerator creates a moderator with the given word filter and audit log.
+func NewModerator(filter *WordFilter, audit *log.Logger) *Moderator {
+	return &Moderator{
+		Filter: filter,
+		Audit:  audit,
+		mutes:  make(map[string]map[string]time.Time),
+		kicked: make(map[string]map[string]bool),
+	}
+}
+
+// Mute mutes a player of a room until `until`.
+func (m *Moderator) Mute(roomID, userName string, until time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.mutes[roomID] == nil {
+		m.mutes[roomID] = make(map[string]time.Time)
+	}
+	m.mutes[roomID][userName] = until
+}
+
+// Unmute lifts the mute of a player. It reports whether the player was muted.
+func (m *Moderator) Unmute(roomID, userName string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	until, ok := m.mutes[roomID][userName]
+	delete(m.mutes[roomID], userName)
+	return ok && time.Now().Before(until)
+}
+
+// MutedUntil returns the end of the mute of a player, and false if the player is not muted.
+func (m *Moderator) MutedUntil(roomID, userName string) (time.Time, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	until, ok := m.mutes[roomID][userName]
+	if ok && !time.Now().Before(until) {
+		// The mute is over
+		delete(m.mutes[roomID], userName)
+		return time.Time{}, false
+	}
+	return until, ok
+}
+
+// Kick records that a player was kicked from a room, so the player can't join it again.
+func (m *Moderator) Kick(roomID, userName string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.kicked[roomID] == nil {
+		m.kicked[roomID] = make(map[string]bool)
+	}
+	m.kicked[roomID][userName] = true
+}
+
+// IsKicked reports whether a player was kicked from a room.
+func (m *Moderator) IsKicked(roomID, userName string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.kicked[roomID][userName]
+}
+
+// Forget drops the mutes and the kicks of a room, once the room is destroyed and can't be joined anymore.
+func (m *Moderator) Forget(roomID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.mutes, roomID)
+	delete(m.kicked, roomID)
+}
+
+/*
+Record writes a moderation action to the audit log.
+
+Params:
+  - action: one of the ACTION_ constants;
+  - roomID: the room of the players;
+  - by: the player who did the action, empty for the server;
+  - userName: the player the action is about;
+  - details: optional details, e.g. the duration of a mute or the reason of a kick.
+*/
+func (m *Moderator) Record(action, roomID, by, userName, details string) {
+	if by == "" {
+		by = "server"
+	}
+	entry := fmt.Sprintf("%s room=%s by=%q user=%q", action, roomID, by, userName)
+	if details != "" {
+		entry += " " + strings.TrimSpace(details)
+	}
+	m.Audit.Println(entry)
+}
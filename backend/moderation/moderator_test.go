@@ -0,0 +1,81 @@
+package moderation
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+)
+
+// newTestModerator returns a moderator without filtered words, writing its audit log to `audit`.
+func newTestModerator(audit *bytes.Buffer) *Moderator {
+	return NewModerator(NewWordFilter(nil), log.New(audit, "", 0))
+}
+
+func TestMuteExpires(t *testing.T) {
+	m := newTestModerator(&bytes.Buffer{})
+	until := time.Now().Add(time.Hour)
+	m.Mute("room", "alice", until)
+	m.Mute("room", "bob", time.Now().Add(-time.Second))
+
+	if got, ok := m.MutedUntil("room", "alice"); !ok || !got.Equal(until) {
+		t.Errorf("got %v, %v, want alice muted until %v", got, ok, until)
+	}
+	if _, ok := m.MutedUntil("room", "bob"); ok {
+		t.Error("bob is still muted after the end of the mute")
+	}
+	if _, ok := m.MutedUntil("other room", "alice"); ok {
+		t.Error("alice is muted in another room")
+	}
+}
+
+func TestUnmute(t *testing.T) {
+	m := newTestModerator(&bytes.Buffer{})
+	m.Mute("room", "alice", time.Now().Add(time.Hour))
+	m.Mute("room", "bob", time.Now().Add(-time.Second))
+
+	if !m.Unmute("room", "alice") {
+		t.Error("alice was not reported muted")
+	}
+	if _, ok := m.MutedUntil("room", "alice"); ok {
+		t.Error("alice is still muted after the unmute")
+	}
+	if m.Unmute("room", "bob") {
+		t.Error("bob was reported muted after the end of the mute")
+	}
+}
+
+func TestForget(t *testing.T) {
+	m := newTestModerator(&bytes.Buffer{})
+	m.Mute("room", "alice", time.Now().Add(time.Hour))
+	m.Kick("room", "bob")
+	m.Mute("other room", "alice", time.Now().Add(time.Hour))
+	m.Kick("other room", "bob")
+
+	m.Forget("room")
+
+	if _, ok := m.MutedUntil("room", "alice"); ok {
+		t.Error("the mute of a forgotten room is kept")
+	}
+	if m.IsKicked("room", "bob") {
+		t.Error("the kick of a forgotten room is kept")
+	}
+	if _, ok := m.MutedUntil("other room", "alice"); !ok {
+		t.Error("the mute of another room was forgotten")
+	}
+	if !m.IsKicked("other room", "bob") {
+		t.Error("the kick of another room was forgotten")
+	}
+}
+
+func TestRecord(t *testing.T) {
+	var audit bytes.Buffer
+	m := newTestModerator(&audit)
+	m.Record(ACTION_MUTE, "room", "alice", "bob", " duration=5m0s ")
+	m.Record(ACTION_FILTER, "room", "", "bob", "")
+
+	want := "mute room=room by=\"alice\" user=\"bob\" duration=5m0s\nfilter room=room by=\"server\" user=\"bob\"\n"
+	if got := audit.String(); got != want {
+		t.Errorf("got audit log %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+package moderation
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// WORD_FILTER_FILE is the file of the filtered words, one per line, relative to the working directory of the server.
+// Empty lines and lines starting with '#' are ignored. Without the file, DEFAULT_FILTERED_WORDS are filtered.
+const WORD_FILTER_FILE = "chat_filter.txt"
+
+// DEFAULT_FILTERED_WORDS are the words filtered when there is no WORD_FILTER_FILE.
+var DEFAULT_FILTERED_WORDS = []string{"fuck", "fucking", "shit", "bitch", "asshole", "bastard", "cunt", "dick"}
+
+// WordFilter masks the filtered words of the chat messages.
+// The words are matched as whole words, ignoring the case.
+type WordFilter struct {
+	pattern *regexp.Regexp // nil if no word is filtered
+}
+
+// NewWordFilter creates a filter of the given words.
+func NewWordFilter(words []string) *WordFilter {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return &WordFilter{}
+	}
+	return &WordFilter{pattern: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+// LoadWordFilter creates a filter of the words of `file`, or of DEFAULT_FILTERED_WORDS if the file doesn't exist.
+func LoadWordFilter(file string) (*WordFilter, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return NewWordFilter(DEFAULT_FILTERED_WORDS), nil
+	}
+	if err != nil {
+		return NewWordFilter(DEFAULT_FILTERED_WORDS), err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return NewWordFilter(DEFAULT_FILTERED_WORDS), err
+	}
+	return NewWordFilter(words), nil
+}
+
+// Censor replaces every letter of the filtered words of `text` with '*'.
+// It also reports whether a word was filtered.
+func (f *WordFilter) Censor(text string) (string, bool) {
+	if f.pattern == nil || !f.pattern.MatchString(text) {
+		return text, false
+	}
+	return f.pattern.ReplaceAllStringFunc(text, func(word string) string {
+		return strings.Repeat("*", len([]rune(word)))
+	}), true
+}
@@ -0,0 +1,67 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWordFilterCensor(t *testing.T) {
+	filter := NewWordFilter([]string{"dick", " shit ", ""})
+
+	tests := []struct {
+		name         string
+		text         string
+		want         string
+		wantFiltered bool
+	}{
+		{name: "filtered word", text: "oh shit", want: "oh ****", wantFiltered: true},
+		{name: "ignoring the case", text: "SHIT happens, Dick", want: "**** happens, ****", wantFiltered: true},
+		{name: "next to punctuation", text: "shit!dick?", want: "****!****?", wantFiltered: true},
+		{name: "part of a longer word", text: "I read Dickens", want: "I read Dickens"},
+		{name: "clean text", text: "good game", want: "good game"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, filtered := filter.Censor(test.text)
+			if got != test.want || filtered != test.wantFiltered {
+				t.Errorf("got %q, %v, want %q, %v", got, filtered, test.want, test.wantFiltered)
+			}
+		})
+	}
+}
+
+func TestWordFilterWithoutWords(t *testing.T) {
+	filter := NewWordFilter(nil)
+	if got, filtered := filter.Censor("shit"); got != "shit" || filtered {
+		t.Errorf("got %q, %v, want the text unchanged", got, filtered)
+	}
+}
+
+func TestLoadWordFilter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), WORD_FILTER_FILE)
+	content := "# the filtered words\n\n  darn  \n#heck\nfrak\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := LoadWordFilter(file)
+	if err != nil {
+		t.Fatalf("LoadWordFilter: %v", err)
+	}
+	got, _ := filter.Censor("darn it, frak, heck, # the filtered words")
+	if want := "**** it, ****, heck, # the filtered words"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLoadWordFilterWithoutFile(t *testing.T) {
+	filter, err := LoadWordFilter(filepath.Join(t.TempDir(), WORD_FILTER_FILE))
+	if err != nil {
+		t.Fatalf("LoadWordFilter: %v", err)
+	}
+	if _, filtered := filter.Censor(DEFAULT_FILTERED_WORDS[0]); !filtered {
+		t.Errorf("the default word '%s' is not filtered", DEFAULT_FILTERED_WORDS[0])
+	}
+}
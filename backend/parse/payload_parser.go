@@ -2,7 +2,6 @@ package parse
 
 import (
 	"encoding/json"
-	"github.com/Pomog/bomberman/backend/webmodel"
 )
 
 // PayloadToInt converts a JSON payload into an integer.
@@ -26,19 +25,3 @@ func PayloadToString(payload json.RawMessage) (string, error) {
 	}
 	return str, nil
 }
-
-// PayloadToChatMessage converts a JSON payload into a ChatMessage struct.
-// Returns the parsed ChatMessage object or an error if conversion fails.
-func PayloadToChatMessage(payload json.RawMessage) (webmodel.ChatMessage, error) {
-	var message webmodel.ChatMessage
-	err := json.Unmarshal(payload, &message) // Attempt to parse JSON into a ChatMessage struct
-	return message, err
-}
-
-// PayloadToAction converts a JSON payload into a PlrAction struct.
-// Returns the parsed PlrAction object or an error if conversion fails.
-func PayloadToAction(payload json.RawMessage) (webmodel.PlrAction, error) {
-	var action webmodel.PlrAction
-	err := json.Unmarshal(payload, &action) // Attempt to parse JSON into a PlrAction struct
-	return action, err
-}
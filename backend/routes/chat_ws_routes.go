@@ -16,17 +16,50 @@ func CreateChatWsRoutes(app *server.Application) wsconnection.WSmux {
 		InfoLog: app.InfoLog, // Logger for informational messages
 		ErrLog:  app.ErrLog,  // Logger for errors
 		Hub:     app.Hub,     // WebSocket hub managing connected clients
+		Metrics: wsconnection.NewMetrics(),
 	}
 
-	// WShandlers maps WebSocket event types (from `webmodel`) to their corresponding handler functions.
-	// Each handler is responsible for processing a specific type of WebSocket message.
-	wsServer.WShandlers = map[string]wsconnection.Replier{
-		webmodel.SendMessageToChat: controllers.ReplySendMessageToChat(app),                  // Handles chat messages between players
-		webmodel.PlayerAction:      controllers.ReplyPlayerAction(app),                       // Processes player movement or game-related actions
-		webmodel.StartGame:         controllers.ReplyStartGame(app),                          // Handles game start requests
-		webmodel.ReadyToStart:      controllers.ReadyToStart(app),                            // Marks a player as ready to begin
-		webmodel.UserQuitChat:      controllers.SendUserToRoomMembers(webmodel.UserQuitChat), // Handles user disconnection from the chat
+	// Global middlewares apply to every message type, so a new route is protected from panics,
+	// measured, logged, rate-limited and gets its payload validated by default.
+	// The payload of a new message type must be registered in webmodel (see webmodel.DecodeMessage).
+	wsServer.Use(wsconnection.Recovering, wsconnection.Measuring, wsconnection.Logging, wsconnection.RateLimiting, wsconnection.Decoding)
+
+	// The chat commands, e.g. "/roll 2d6"; a new command is registered here with chatCommands.Register
+	chatCommands := controllers.DefaultChatCommands()
+
+	// Handle maps WebSocket event types (from `webmodel`) to their corresponding handler functions,
+	// with the middlewares of the route. Each handler is responsible for processing a specific type of WebSocket message.
+	wsServer.Handle(webmodel.SendMessageToChat, controllers.ReplySendMessageToChat(app, chatCommands))  // Handles chat messages and commands between players
+	wsServer.Handle(webmodel.PlayerAction, controllers.ReplyPlayerAction(app), wsconnection.DuringGame) // Processes player movement or game-related actions
+	wsServer.Handle(webmodel.StartGame, controllers.ReplyStartGame(app))                                // Handles game start requests
+	wsServer.Handle(webmodel.ReadyToStart, controllers.ReadyToStart(app))                               // Marks a player as ready to begin
+	wsServer.Handle(webmodel.SetReady, controllers.ReplySetReady(app))                                  // Marks a player as ready or not ready to begin
+	wsServer.Handle(webmodel.UserQuitChat, controllers.SendUserQuit(app))                               // Handles user disconnection from the chat
+	wsServer.Handle(webmodel.StateAck, controllers.ReplyStateAck(app))                                  // Records the last state update received by the player
+	wsServer.Handle(webmodel.Ping, controllers.ReplyPing(app))                                          // Replies to the player's latency measurement
+	wsServer.Handle(webmodel.Pong, controllers.ReplyPong(app))                                          // Records the round-trip time of the server's ping
+	wsServer.Handle(webmodel.ChatHistory, controllers.ReplyChatHistory(app))                            // Sends older messages of a chat channel
+	wsServer.Handle(webmodel.EditChatMessage, controllers.ReplyEditChatMessage(app))                    // Edits a chat message of the sender
+	wsServer.Handle(webmodel.DeleteChatMessage, controllers.ReplyDeleteChatMessage(app))                // Deletes a chat message of the sender, or any of the room by the host
+	wsServer.Handle(webmodel.SetPresence, controllers.ReplySetPresence(app))                            // Sets the player online or idle
+	wsServer.Handle(webmodel.Typing, controllers.ReplyTyping(app))                                      // Broadcasts the typing indicator of the player
+	wsServer.Handle(webmodel.MutePlayer, controllers.ReplyMutePlayer(app))                              // Mutes or unmutes a player, by the room host
+	wsServer.Handle(webmodel.KickPlayer, controllers.ReplyKickPlayer(app))                              // Kicks a player out of the room, by the room host
+	wsServer.Handle(webmodel.SetLobbySettings, controllers.ReplySetLobbySettings(app))                  // Changes some game rules of the room, by the room host
+	wsServer.Handle(webmodel.SetGamePreset, controllers.ReplySetGamePreset(app))                        // Resets the game rules of the room to a preset, by the room host
+
+	// RateLimits protect the room from a client flooding the server with messages.
+	// Movements are sent every animation frame and state updates are acknowledged 20 times per second.
+	wsServer.RateLimits = map[string]wsconnection.RateLimit{
+		webmodel.SendMessageToChat: {Rate: 2, Burst: 5},
+		webmodel.EditChatMessage:   {Rate: 2, Burst: 5},
+		webmodel.PlayerAction:      {Rate: 80, Burst: 160},
+		webmodel.StateAck:          {Rate: 40, Burst: 80},
+		webmodel.StartGame:         {Rate: 1, Burst: 5},
+		webmodel.ReadyToStart:      {Rate: 1, Burst: 5},
+		webmodel.SetReady:          {Rate: 1, Burst: 5},
 	}
+	wsServer.DefaultRateLimit = wsconnection.RateLimit{Rate: 10, Burst: 20}
 
 	// TODO: Implement handling for "gameOver" WebSocket message.
 	// The frontend should send a "gameOver" event when a match ends.
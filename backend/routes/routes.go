@@ -13,6 +13,9 @@ func CreateAPIroutes(mux *http.ServeMux, app *server.Application, wsHandlers wsc
 	// Register the health check route
 	mux.Handle("/health", handlers.HealthCheck(app))
 
+	// Register the route of the server metrics
+	mux.Handle(handlers.METRICS_URL, handlers.Metrics(app, wsHandlers.Metrics))
+
 	// Register a route for joining a game, where the JoinGame handler
 	// manages WebSocket connections for the game
 	mux.Handle(handlers.JOIN_GAME_URL, handlers.JoinGame(app, wsHandlers))
@@ -1,10 +1,15 @@
 package server
 
 import (
+	"github.com/Pomog/bomberman/backend/chathistory"
+	"github.com/Pomog/bomberman/backend/gamerules"
 	"github.com/Pomog/bomberman/backend/logger"
+	"github.com/Pomog/bomberman/backend/moderation"
+	"github.com/Pomog/bomberman/backend/webmodel"
 	"github.com/Pomog/bomberman/backend/websocket_hub"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -13,17 +18,22 @@ import (
 // Application represents the main backend server structure
 // It manages logging, WebSocket hub, HTTP server, and connection upgrades.
 type Application struct {
-	ErrLog      *log.Logger         // Logger for errors
-	InfoLog     *log.Logger         // Logger for general info
-	Hub         *websocket_hub.Hub  // Manages WebSocket connections
-	WaitingRoom *websocket_hub.Room // A temporary room for waiting players
-	Upgrader    websocket.Upgrader  // Handles WebSocket upgrades
-	Server      *http.Server        // HTTP server instance
+	ErrLog           *log.Logger           // Logger for errors
+	InfoLog          *log.Logger           // Logger for general info
+	Hub              *websocket_hub.Hub    // Manages WebSocket connections
+	WaitingRoom      *websocket_hub.Room   // A temporary room for waiting players, guarded by WaitingRoomMutex
+	WaitingRoomMutex sync.Mutex            // Held to read or change WaitingRoom, by the join handlers and the timers of the room
+	ChatHistory      *chathistory.Store    // Past messages of the room and global chat channels
+	Moderator        *moderation.Moderator // Word filter, mutes and kicks of the chat
+	GamePresets      *gamerules.Presets    // Presets of the game rules of the rooms
+	Upgrader         websocket.Upgrader    // Handles WebSocket upgrades
+	Server           *http.Server          // HTTP server instance
 }
 
 // New initializes and returns a new Application instance.
 // It sets up logging, WebSocket handling, and the HTTP server.
-func New(serverAddress string) *Application {
+// The new rooms are played with the game rules of `gamePreset`.
+func New(serverAddress string, gamePreset string) *Application {
 	application := &Application{}
 
 	// Create loggers for error and info messages
@@ -32,10 +42,33 @@ func New(serverAddress string) *Application {
 	// Initialize WebSocket hub
 	application.Hub = websocket_hub.NewHub()
 
+	// Open the chat history; the rooms don't outlive the server, only the global channel is persisted.
+	// Without its directory the history is kept in memory only
+	var err error
+	application.ChatHistory, err = chathistory.NewStore(chathistory.DEFAULT_DIR, websocket_hub.UNIVERSAL_ROOM_ID)
+	if err != nil {
+		application.ErrLog.Printf("Chat history is not persisted: %v", err)
+	}
+
+	// Load the filtered words of the chat; without the file the default words are filtered
+	filter, err := moderation.LoadWordFilter(moderation.WORD_FILTER_FILE)
+	if err != nil {
+		application.ErrLog.Printf("Cannot load the chat word filter, using the default words: %v", err)
+	}
+	application.Moderator = moderation.NewModerator(filter, logger.CreateAuditLogger(application.ErrLog))
+
+	// Load the presets of the game rules; without the file the built-in presets are used
+	application.GamePresets, err = gamerules.LoadPresets(gamerules.GAME_RULES_FILE, gamePreset)
+	if err != nil {
+		application.ErrLog.Printf("Cannot load the game rules presets, using the classic rules: %v", err)
+	}
+
 	// Configure WebSocket upgrader
 	application.Upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
+		// Subprotocols in the order of preference; a client that requests none of them uses JSON
+		Subprotocols: []string{webmodel.BINARY_SUBPROTOCOL, webmodel.JSON_SUBPROTOCOL},
 		CheckOrigin: func(r *http.Request) bool {
 			// Allow WebSocket connections only from localhost
 			origin := r.Header.Get("Origin")
@@ -58,3 +91,37 @@ func New(serverAddress string) *Application {
 
 	return application
 }
+
+// CloseWaitingRoom sends the next players to a new room, if `room` is the waiting room.
+func (app *Application) CloseWaitingRoom(room *websocket_hub.Room) {
+	app.WaitingRoomMutex.Lock()
+	defer app.WaitingRoomMutex.Unlock()
+
+	if app.WaitingRoom == room {
+		app.WaitingRoom = nil
+	}
+}
+
+// DestroyRoom removes the room from the hub once no human is left in it, with the history of its chat
+// and its moderation state, and returns true.
+// The room can't be joined anymore; its bots leave it on their own.
+// It returns false if a human is still in the room.
+func (app *Application) DestroyRoom(room *websocket_hub.Room) bool {
+	// No player joins the room while it is destroyed
+	app.WaitingRoomMutex.Lock()
+	defer app.WaitingRoomMutex.Unlock()
+
+	if room.HasHumans() {
+		return false
+	}
+	if app.WaitingRoom == room {
+		app.WaitingRoom = nil
+	}
+	app.Hub.UnRegisterRoomFromHub(room)
+	if err := app.ChatHistory.Remove(room.ID); err != nil {
+		app.ErrLog.Printf("Removing the chat history of room '%s' failed: %v", room, err)
+	}
+	app.Moderator.Forget(room.ID)
+	app.InfoLog.Printf("Room '%s' is destroyed", room)
+	return true
+}
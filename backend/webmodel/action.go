@@ -0,0 +1,142 @@
+package webmodel
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Constants representing the player action types sent inside a `playerAction` message.
+// They mirror the values in the frontend file `playerActionTypes.js`.
+const (
+	ACTION_MOVE         = "movePlayer"  // The player moved (or respawned) to new coordinates.
+	ACTION_PLACE_BOMB   = "placeBomb"   // The player placed a bomb.
+	ACTION_DIE          = "die"         // The player lost a life.
+	ACTION_POWER_PICKED = "powerPicked" // The player picked up a power-up.
+)
+
+// ActionHeader is the common part of every player action, used to find out the action type.
+type ActionHeader struct {
+	Type string `json:"type" validate:"required"` // The action type, one of the ACTION_* constants.
+	Seq  uint64 `json:"seq,omitempty"`            // Optional: monotonically increasing input sequence number of the player.
+	Tick uint64 `json:"tick,omitempty"`           // Optional: the last server tick the player had received when acting.
+}
+
+// Header returns the common part of the action; every action embeds the ActionHeader.
+func (h ActionHeader) Header() ActionHeader {
+	return h
+}
+
+// Action is a player action decoded from a `playerAction` message: MoveAction, PlaceBombAction,
+// PowerPickedAction or DieAction.
+type Action interface {
+	Header() ActionHeader
+}
+
+// SpriteInfo describes the animation state of a player: the direction and the current frame.
+// On the wire it is encoded as a two element array, e.g. `["moveLeft", 2]`.
+type SpriteInfo struct {
+	Direction string // The direction of the movement, e.g. "moveLeft".
+	Frame     int    // The current frame of the walking animation.
+}
+
+// MarshalJSON encodes the SpriteInfo as a `[direction, frame]` array.
+func (s SpriteInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{s.Direction, s.Frame})
+}
+
+// Validate checks the direction and the frame of the SpriteInfo.
+// Returns an error message if validation fails, otherwise returns an empty string.
+func (s *SpriteInfo) Validate() string {
+	if _, ok := directionCodes[s.Direction]; !ok {
+		return fmt.Sprintf("has an unknown direction '%s'", s.Direction)
+	}
+	if s.Frame < 0 {
+		return "has a negative frame"
+	}
+	return ""
+}
+
+// JSONSchema describes the `[direction, frame]` array of the SpriteInfo.
+func (s SpriteInfo) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "array",
+		"prefixItems": []any{
+			map[string]any{"enum": sortedKeys(directionCodes)},
+			map[string]any{"type": "integer", "minimum": 0},
+		},
+		"items":    false,
+		"minItems": 2,
+	}
+}
+
+// UnmarshalJSON decodes the SpriteInfo from a `[direction, frame]` array.
+func (s *SpriteInfo) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 2 {
+		return fmt.Errorf("spriteInfo must have 2 elements, got %d", len(raw))
+	}
+	if err := json.Unmarshal(raw[0], &s.Direction); err != nil {
+		return err
+	}
+	return json.Unmarshal(raw[1], &s.Frame)
+}
+
+// MoveAction is sent by the frontend when the player moves or respawns.
+type MoveAction struct {
+	ActionHeader
+	Coords     [2]float64  `json:"coords"`               // The new [x, y] position of the player in pixels.
+	SpriteInfo *SpriteInfo `json:"spriteInfo,omitempty"` // Optional: the animation state (missing on respawn).
+}
+
+// BombCoords is the position of a bomb on the map grid and the range of its explosion.
+type BombCoords struct {
+	Row    int `json:"row" validate:"min=0"`    // The row of the bomb on the map grid.
+	Column int `json:"column" validate:"min=0"` // The column of the bomb on the map grid.
+	Power  int `json:"power" validate:"min=1"`  // The number of tiles the explosion reaches in each direction.
+}
+
+// PlaceBombAction is sent by the frontend when the player places a bomb.
+type PlaceBombAction struct {
+	ActionHeader
+	Coords BombCoords `json:"coords"` // The position and the power of the bomb.
+}
+
+// MapCoords is the position of a tile on the map grid.
+type MapCoords struct {
+	Row    int `json:"row" validate:"min=0"`    // The row of the tile.
+	Column int `json:"column" validate:"min=0"` // The column of the tile.
+}
+
+// PowerPickedAction is sent by the frontend when the player picks up a power-up.
+type PowerPickedAction struct {
+	ActionHeader
+	Coords MapCoords `json:"coords"` // The tile of the power-up.
+}
+
+// DieAction is sent by the frontend when the player loses a life.
+type DieAction struct {
+	ActionHeader
+	Lives int `json:"lives" validate:"min=0"` // The number of lives left.
+}
+
+// PlayerState is the state of one player entity as it is sent in a state update.
+type PlayerState struct {
+	UserName   string      `json:"playerName"`           // The name of the player.
+	Coords     [2]float64  `json:"coords"`               // The [x, y] position of the player in pixels.
+	SpriteInfo *SpriteInfo `json:"spriteInfo,omitempty"` // The animation state of the player.
+	Lives      int         `json:"lives"`                // The number of lives left.
+	LastSeq    uint64      `json:"lastSeq,omitempty"`    // The sequence number of the last input processed for the player.
+}
+
+// RoomStateUpdate is a snapshot of the room state sent to a client.
+// A keyframe contains every player; a delta contains only the players changed since `BaseTick`.
+type RoomStateUpdate struct {
+	Tick     uint64        `json:"tick"`              // The server tick of this snapshot.
+	BaseTick uint64        `json:"baseTick"`          // The acknowledged tick the delta is computed against (0 for keyframes).
+	Keyframe bool          `json:"keyframe"`          // True if the update contains the full state.
+	Players  []PlayerState `json:"players,omitempty"` // The changed (or all) players.
+	Removed  []string      `json:"removed,omitempty"` // The players that left since `BaseTick`.
+}
@@ -0,0 +1,270 @@
+package webmodel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Constants representing the WebSocket subprotocols the server can negotiate.
+// A client requesting BINARY_SUBPROTOCOL sends and receives the high-frequency game messages
+// (moves, bombs, state acknowledgements and state updates) in the compact binary format below.
+// Every other message (chat, room, control) stays JSON.
+const (
+	BINARY_SUBPROTOCOL = "bomberman.binary.v1" // Binary encoding for game messages, JSON for the rest.
+	JSON_SUBPROTOCOL   = "bomberman.json.v1"   // JSON encoding for every message (the default).
+)
+
+// Opcodes are the first byte of every binary message. They are all below 0x20,
+// so a binary message can never be confused with a JSON text.
+//
+// Client to server:
+//   - BINARY_MOVE:       seq uint32 | x float32 | y float32 | direction uint8 | frame uint8
+//   - BINARY_PLACE_BOMB: seq uint32 | tick uint32 | row uint8 | column uint8 | power uint8
+//   - BINARY_STATE_ACK:  tick uint32
+//
+// Server to client:
+//   - BINARY_STATE_UPDATE: tick uint32 | baseTick uint32 | flags uint8 | players count uint8 |
+//     players (name | x float32 | y float32 | direction uint8 | frame uint8 | lives uint8 | lastSeq uint32) |
+//     removed count uint8 | removed names
+//
+// Strings (names) are encoded as length uint8 followed by the bytes. Numbers are big endian.
+// Direction 0 means the sprite info is unknown.
+const (
+	BINARY_MOVE         byte = 0x01
+	BINARY_PLACE_BOMB   byte = 0x02
+	BINARY_STATE_ACK    byte = 0x03
+	BINARY_STATE_UPDATE byte = 0x10
+)
+
+// binaryKeyframeFlag marks a keyframe in the flags byte of a state update.
+const binaryKeyframeFlag byte = 1
+
+// directionCodes maps movement directions to their binary codes.
+var directionCodes = map[string]byte{
+	"moveLeft":  1,
+	"moveRight": 2,
+	"moveUp":    3,
+	"moveDown":  4,
+}
+
+// ErrBinaryMessage is returned when a binary message cannot be decoded or encoded.
+var ErrBinaryMessage = errors.New("invalid binary message")
+
+// IsBinaryMessage reports whether an outgoing message is in the binary format
+// and therefore has to be sent in its own binary WebSocket frame.
+func IsBinaryMessage(message []byte) bool {
+	return len(message) > 0 && message[0] < 0x20
+}
+
+// DecodeBinaryMessage converts a binary message received from a client into a WSMessage
+// with a JSON payload, so it can be handled by the same handlers as the JSON messages.
+func DecodeBinaryMessage(data []byte) (WSMessage, error) {
+	if len(data) == 0 {
+		return WSMessage{}, fmt.Errorf("%w: empty message", ErrBinaryMessage)
+	}
+	reader := bytes.NewReader(data[1:])
+
+	var payload any
+	var messageType string
+	switch data[0] {
+	case BINARY_MOVE:
+		var move struct {
+			Seq              uint32
+			X, Y             float32
+			Direction, Frame uint8
+		}
+		if err := binary.Read(reader, binary.BigEndian, &move); err != nil {
+			return WSMessage{}, fmt.Errorf("%w: move: %v", ErrBinaryMessage, err)
+		}
+		action := MoveAction{
+			ActionHeader: ActionHeader{Type: ACTION_MOVE, Seq: uint64(move.Seq)},
+			Coords:       [2]float64{float64(move.X), float64(move.Y)},
+			SpriteInfo:   decodeSpriteInfo(move.Direction, move.Frame),
+		}
+		messageType, payload = PlayerAction, action
+
+	case BINARY_PLACE_BOMB:
+		var bomb struct {
+			Seq, Tick          uint32
+			Row, Column, Power uint8
+		}
+		if err := binary.Read(reader, binary.BigEndian, &bomb); err != nil {
+			return WSMessage{}, fmt.Errorf("%w: place bomb: %v", ErrBinaryMessage, err)
+		}
+		action := PlaceBombAction{
+			ActionHeader: ActionHeader{Type: ACTION_PLACE_BOMB, Seq: uint64(bomb.Seq), Tick: uint64(bomb.Tick)},
+			Coords:       BombCoords{Row: int(bomb.Row), Column: int(bomb.Column), Power: int(bomb.Power)},
+		}
+		messageType, payload = PlayerAction, action
+
+	case BINARY_STATE_ACK:
+		var tick uint32
+		if err := binary.Read(reader, binary.BigEndian, &tick); err != nil {
+			return WSMessage{}, fmt.Errorf("%w: state ack: %v", ErrBinaryMessage, err)
+		}
+		messageType, payload = StateAck, tick
+
+	default:
+		return WSMessage{}, fmt.Errorf("%w: unknown opcode 0x%02x", ErrBinaryMessage, data[0])
+	}
+
+	if reader.Len() != 0 {
+		return WSMessage{}, fmt.Errorf("%w: %d unexpected trailing bytes", ErrBinaryMessage, reader.Len())
+	}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return WSMessage{}, fmt.Errorf("DecodeBinaryMessage failed: %v", err)
+	}
+	return WSMessage{Type: messageType, Payload: jsonPayload}, nil
+}
+
+// EncodeBinaryStateUpdate encodes a state update in the binary format.
+func EncodeBinaryStateUpdate(update RoomStateUpdate) ([]byte, error) {
+	if len(update.Players) > math.MaxUint8 || len(update.Removed) > math.MaxUint8 {
+		return nil, fmt.Errorf("%w: too many players in the state update", ErrBinaryMessage)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(BINARY_STATE_UPDATE)
+
+	var flags byte
+	if update.Keyframe {
+		flags |= binaryKeyframeFlag
+	}
+	binary.Write(&buf, binary.BigEndian, uint32(update.Tick))
+	binary.Write(&buf, binary.BigEndian, uint32(update.BaseTick))
+	buf.WriteByte(flags)
+
+	buf.WriteByte(byte(len(update.Players)))
+	for _, player := range update.Players {
+		if err := writeBinaryString(&buf, player.UserName); err != nil {
+			return nil, err
+		}
+		direction, frame := encodeSpriteInfo(player.SpriteInfo)
+		binary.Write(&buf, binary.BigEndian, float32(player.Coords[0]))
+		binary.Write(&buf, binary.BigEndian, float32(player.Coords[1]))
+		buf.WriteByte(direction)
+		buf.WriteByte(frame)
+		if player.Lives < 0 || player.Lives > math.MaxUint8 {
+			return nil, fmt.Errorf("%w: %d lives of '%s' don't fit in a byte", ErrBinaryMessage, player.Lives, player.UserName)
+		}
+		buf.WriteByte(byte(player.Lives))
+		binary.Write(&buf, binary.BigEndian, uint32(player.LastSeq))
+	}
+
+	buf.WriteByte(byte(len(update.Removed)))
+	for _, userName := range update.Removed {
+		if err := writeBinaryString(&buf, userName); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecodeBinaryStateUpdate decodes a state update encoded by EncodeBinaryStateUpdate, as a client does.
+func DecodeBinaryStateUpdate(data []byte) (RoomStateUpdate, error) {
+	if len(data) == 0 || data[0] != BINARY_STATE_UPDATE {
+		return RoomStateUpdate{}, fmt.Errorf("%w: not a state update", ErrBinaryMessage)
+	}
+	reader := bytes.NewReader(data[1:])
+
+	var header struct {
+		Tick, BaseTick uint32
+		Flags, Count   uint8
+	}
+	if err := binary.Read(reader, binary.BigEndian, &header); err != nil {
+		return RoomStateUpdate{}, fmt.Errorf("%w: state update: %v", ErrBinaryMessage, err)
+	}
+	update := RoomStateUpdate{
+		Tick:     uint64(header.Tick),
+		BaseTick: uint64(header.BaseTick),
+		Keyframe: header.Flags&binaryKeyframeFlag != 0,
+	}
+
+	for i := 0; i < int(header.Count); i++ {
+		userName, err := readBinaryString(reader)
+		if err != nil {
+			return RoomStateUpdate{}, err
+		}
+		var player struct {
+			X, Y                    float32
+			Direction, Frame, Lives uint8
+			LastSeq                 uint32
+		}
+		if err := binary.Read(reader, binary.BigEndian, &player); err != nil {
+			return RoomStateUpdate{}, fmt.Errorf("%w: player '%s': %v", ErrBinaryMessage, userName, err)
+		}
+		update.Players = append(update.Players, PlayerState{
+			UserName:   userName,
+			Coords:     [2]float64{float64(player.X), float64(player.Y)},
+			SpriteInfo: decodeSpriteInfo(player.Direction, player.Frame),
+			Lives:      int(player.Lives),
+			LastSeq:    uint64(player.LastSeq),
+		})
+	}
+
+	removed, err := reader.ReadByte()
+	if err != nil {
+		return RoomStateUpdate{}, fmt.Errorf("%w: removed players: %v", ErrBinaryMessage, err)
+	}
+	for i := 0; i < int(removed); i++ {
+		userName, err := readBinaryString(reader)
+		if err != nil {
+			return RoomStateUpdate{}, err
+		}
+		update.Removed = append(update.Removed, userName)
+	}
+
+	if reader.Len() != 0 {
+		return RoomStateUpdate{}, fmt.Errorf("%w: %d unexpected trailing bytes", ErrBinaryMessage, reader.Len())
+	}
+	return update, nil
+}
+
+// readBinaryString reads a string written by writeBinaryString.
+func readBinaryString(reader *bytes.Reader) (string, error) {
+	length, err := reader.ReadByte()
+	if err != nil {
+		return "", fmt.Errorf("%w: string length: %v", ErrBinaryMessage, err)
+	}
+	str := make([]byte, length)
+	if _, err := io.ReadFull(reader, str); err != nil {
+		return "", fmt.Errorf("%w: string: %v", ErrBinaryMessage, err)
+	}
+	return string(str), nil
+}
+
+// writeBinaryString writes a string as its length followed by its bytes.
+func writeBinaryString(buf *bytes.Buffer, str string) error {
+	if len(str) > math.MaxUint8 {
+		return fmt.Errorf("%w: string '%s...' is too long", ErrBinaryMessage, str[:16])
+	}
+	buf.WriteByte(byte(len(str)))
+	buf.WriteString(str)
+	return nil
+}
+
+// encodeSpriteInfo returns the binary codes of the sprite info; unknown directions are encoded as 0.
+func encodeSpriteInfo(spriteInfo *SpriteInfo) (direction, frame byte) {
+	if spriteInfo == nil {
+		return 0, 0
+	}
+	return directionCodes[spriteInfo.Direction], byte(spriteInfo.Frame)
+}
+
+// decodeSpriteInfo converts the binary codes to the sprite info, or nil if the direction is unknown.
+func decodeSpriteInfo(direction, frame byte) *SpriteInfo {
+	for name, code := range directionCodes {
+		if code == direction {
+			return &SpriteInfo{Direction: name, Frame: int(frame)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package webmodel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBinaryStateUpdateRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		update RoomStateUpdate
+	}{
+		{
+			name:   "empty keyframe",
+			update: RoomStateUpdate{Tick: 40, Keyframe: true},
+		},
+		{
+			name: "keyframe with players",
+			update: RoomStateUpdate{Tick: 80, Keyframe: true, Players: []PlayerState{
+				{UserName: "alice", Coords: [2]float64{32, 64.5}, SpriteInfo: &SpriteInfo{Direction: "moveLeft", Frame: 2}, Lives: 3, LastSeq: 17},
+				{UserName: "bob", Coords: [2]float64{0, 0}, Lives: 0},
+			}},
+		},
+		{
+			name: "delta with removed players",
+			update: RoomStateUpdate{Tick: 12, BaseTick: 10, Players: []PlayerState{
+				{UserName: "alice", Coords: [2]float64{100.25, 8}, SpriteInfo: &SpriteInfo{Direction: "moveDown", Frame: 1}, Lives: 255, LastSeq: 1 << 20},
+			}, Removed: []string{"bob", "carol"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := EncodeBinaryStateUpdate(test.update)
+			if err != nil {
+				t.Fatalf("EncodeBinaryStateUpdate: %v", err)
+			}
+			if !IsBinaryMessage(data) {
+				t.Fatalf("encoded update %v is not a binary message", data[:1])
+			}
+			decoded, err := DecodeBinaryStateUpdate(data)
+			if err != nil {
+				t.Fatalf("DecodeBinaryStateUpdate: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, test.update) {
+				t.Errorf("round trip changed the update:\n got %+v\nwant %+v", decoded, test.update)
+			}
+		})
+	}
+}
+
+func TestEncodeBinaryStateUpdateRejectsLivesOutOfByte(t *testing.T) {
+	for _, lives := range []int{-1, 256} {
+		update := RoomStateUpdate{Tick: 1, Players: []PlayerState{{UserName: "alice", Lives: lives}}}
+		if _, err := EncodeBinaryStateUpdate(update); !errors.Is(err, ErrBinaryMessage) {
+			t.Errorf("lives %d: got error %v, want ErrBinaryMessage", lives, err)
+		}
+	}
+}
+
+func TestDecodeBinaryStateUpdateRejectsTruncatedData(t *testing.T) {
+	data, err := EncodeBinaryStateUpdate(RoomStateUpdate{Tick: 5, Players: []PlayerState{{UserName: "alice", Lives: 1}}})
+	if err != nil {
+		t.Fatalf("EncodeBinaryStateUpdate: %v", err)
+	}
+	for length := 0; length < len(data); length++ {
+		if _, err := DecodeBinaryStateUpdate(data[:length]); !errors.Is(err, ErrBinaryMessage) {
+			t.Errorf("%d of %d bytes: got error %v, want ErrBinaryMessage", length, len(data), err)
+		}
+	}
+}
+
+// binaryMessage builds a client message from its opcode and big endian fields.
+func binaryMessage(t *testing.T, opcode byte, fields ...any) []byte {
+	t.Helper()
+	buf := bytes.NewBuffer([]byte{opcode})
+	for _, field := range fields {
+		if err := binary.Write(buf, binary.BigEndian, field); err != nil {
+			t.Fatalf("binary.Write: %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeBinaryMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantType string
+		want     any
+	}{
+		{
+			name:     "move",
+			data:     binaryMessage(t, BINARY_MOVE, uint32(7), float32(32), float32(48.5), uint8(3), uint8(1)),
+			wantType: PlayerAction,
+			want: MoveAction{
+				ActionHeader: ActionHeader{Type: ACTION_MOVE, Seq: 7},
+				Coords:       [2]float64{32, 48.5},
+				SpriteInfo:   &SpriteInfo{Direction: "moveUp", Frame: 1},
+			},
+		},
+		{
+			name:     "move without sprite info",
+			data:     binaryMessage(t, BINARY_MOVE, uint32(8), float32(1), float32(2), uint8(0), uint8(0)),
+			wantType: PlayerAction,
+			want: MoveAction{
+				ActionHeader: ActionHeader{Type: ACTION_MOVE, Seq: 8},
+				Coords:       [2]float64{1, 2},
+			},
+		},
+		{
+			name:     "place bomb",
+			data:     binaryMessage(t, BINARY_PLACE_BOMB, uint32(9), uint32(120), uint8(3), uint8(5), uint8(2)),
+			wantType: PlayerAction,
+			want: PlaceBombAction{
+				ActionHeader: ActionHeader{Type: ACTION_PLACE_BOMB, Seq: 9, Tick: 120},
+				Coords:       BombCoords{Row: 3, Column: 5, Power: 2},
+			},
+		},
+		{
+			name:     "state ack",
+			data:     binaryMessage(t, BINARY_STATE_ACK, uint32(42)),
+			wantType: StateAck,
+			want:     uint32(42),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, err := DecodeBinaryMessage(test.data)
+			if err != nil {
+				t.Fatalf("DecodeBinaryMessage: %v", err)
+			}
+			if message.Type != test.wantType {
+				t.Errorf("got type %q, want %q", message.Type, test.wantType)
+			}
+			want, err := json.Marshal(test.want)
+			if err != nil {
+				t.Fatalf("json.Marshal: %v", err)
+			}
+			if !bytes.Equal(message.Payload, want) {
+				t.Errorf("got payload %s, want %s", message.Payload, want)
+			}
+		})
+	}
+}
+
+func TestDecodeBinaryMessageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "unknown opcode", data: []byte{0x1f}},
+		{name: "truncated move", data: binaryMessage(t, BINARY_MOVE, uint32(7), float32(32))},
+		{name: "trailing bytes", data: binaryMessage(t, BINARY_STATE_ACK, uint32(1), uint8(0))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := DecodeBinaryMessage(test.data); !errors.Is(err, ErrBinaryMessage) {
+				t.Errorf("got error %v, want ErrBinaryMessage", err)
+			}
+		})
+	}
+}
@@ -4,25 +4,89 @@ import (
 	"time"
 )
 
+// Constants representing the chat channels a message can be sent to.
+const (
+	CHAT_CHANNEL_ROOM    = "room"    // All players of the sender's room (the default).
+	CHAT_CHANNEL_PRIVATE = "private" // One player of the sender's room.
+	CHAT_CHANNEL_GROUP   = "group"   // Some players of the sender's room, e.g. a team.
+	CHAT_CHANNEL_GLOBAL  = "global"  // The players of all rooms.
+)
+
 // ChatMessage represents a message sent by a user in the chat system.
+// The server stamps the messages with its own time; the time of the sender's clock is only informative.
 type ChatMessage struct {
-	UserName   string    `json:"userName,omitempty"`   // Optional: The name of the user sending the message.
-	Content    string    `json:"content"`              // Required: The message content.
-	DateCreate time.Time `json:"dateCreate,omitempty"` // Optional: Timestamp of when the message was created.
+	MessageID  uint64     `json:"messageId,omitempty"`                                          // Set by the server: the ID of the message in its channel, increasing.
+	UserName   string     `json:"userName,omitempty"`                                           // Set by the server: The name of the user sending the message.
+	Content    string     `json:"content" validate:"required,max=500"`                          // Required: The message content, up to 500 characters.
+	DateCreate time.Time  `json:"dateCreate,omitempty"`                                         // Set by the server: the time the server received the message. Older clients send their time here, kept as ClientDate.
+	ClientDate *time.Time `json:"clientDate,omitempty"`                                         // Optional: the time of the sender's clock when the message was written.
+	EditedAt   *time.Time `json:"editedAt,omitempty"`                                           // Set by the server: the time of the last edit of the message.
+	Channel    string     `json:"channel,omitempty" validate:"oneof=room private group global"` // Optional: The channel of the message, CHAT_CHANNEL_ROOM by default.
+	To         []string   `json:"to,omitempty"`                                                 // The recipients of a private or group message.
 }
 
-// Validate checks the ChatMessage for any invalid data.
+// Validate checks the ChatMessage for any invalid data; the content is checked by its `validate` tag.
 // Returns an error message if validation fails, otherwise returns an empty string.
 func (m *ChatMessage) Validate() string {
-	// Ensure the message date is not before January 1, 2024 (used to prevent outdated messages).
-	if m.DateCreate.Before(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+	// Ensure the client's date is not before January 1, 2024 (used to prevent outdated messages).
+	minDate := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if (!m.DateCreate.IsZero() && m.DateCreate.Before(minDate)) || (m.ClientDate != nil && m.ClientDate.Before(minDate)) {
 		return "Date is too old"
 	}
 
-	// Ensure the message content is not empty.
-	if IsEmpty(m.Content) {
-		return "text is missing"
+	// Ensure the recipients match the channel; they must be in the sender's room, which is checked by the handler.
+	switch m.Channel {
+	case CHAT_CHANNEL_PRIVATE:
+		if len(m.To) != 1 {
+			return "a private message needs exactly one recipient"
+		}
+	case CHAT_CHANNEL_GROUP:
+		if len(m.To) == 0 {
+			return "a group message needs recipients"
+		}
+	default:
+		if len(m.To) != 0 {
+			return "recipients are allowed only in private and group messages"
+		}
 	}
 
 	return "" // No validation errors.
 }
+
+// ChatSystemMessage is the payload of a `systemMessage` message: a line of the chat written by the server,
+// like the reply of a chat command.
+type ChatSystemMessage struct {
+	Content    string    `json:"content"`           // The text of the message.
+	Command    string    `json:"command,omitempty"` // The chat command the message replies to, without the slash.
+	UserName   string    `json:"userName"`          // The player who ran the command.
+	DateCreate time.Time `json:"dateCreate"`        // The time of the server when the message was written.
+}
+
+// EditChatMessageRequest is the payload of an `editChatMessage` request, replacing the content of a message of its sender.
+type EditChatMessageRequest struct {
+	Channel   string `json:"channel,omitempty" validate:"oneof=room private group global"` // Optional: The channel of the message, CHAT_CHANNEL_ROOM by default.
+	MessageID uint64 `json:"messageId" validate:"required"`                                // Required: The ID of the message in its channel.
+	Content   string `json:"content" validate:"required,max=500"`                          // Required: The new content of the message.
+}
+
+// ChatMessageRef identifies a message of a channel: the payload of the `deleteChatMessage` requests
+// and of the `chatMessageDeleted` messages.
+type ChatMessageRef struct {
+	Channel   string `json:"channel,omitempty" validate:"oneof=room private group global"` // Optional: The channel of the message, CHAT_CHANNEL_ROOM by default.
+	MessageID uint64 `json:"messageId" validate:"required"`                                // Required: The ID of the message in its channel.
+}
+
+// ChatHistoryRequest is the payload of a `chatHistory` request, asking for a page of the history of a channel.
+// Only the room and global channels have a history; the private and group messages are not kept.
+type ChatHistoryRequest struct {
+	Channel string    `json:"channel,omitempty" validate:"oneof=room global"` // Optional: The channel, CHAT_CHANNEL_ROOM by default.
+	Before  time.Time `json:"before,omitempty"`                               // Optional: Only the messages created before this date, the latest ones by default.
+	Limit   int       `json:"limit,omitempty" validate:"min=0,max=50"`        // Optional: The maximal number of messages, the backfill size by default.
+}
+
+// ChatHistoryPage is the payload of a `chatHistory` message: some past messages of a channel, the oldest first.
+type ChatHistoryPage struct {
+	Channel  string        `json:"channel"`  // The channel of the messages.
+	Messages []ChatMessage `json:"messages"` // The messages, the oldest first.
+	More     bool          `json:"more"`     // True if the channel has older messages, to request with `before` set to the date of the first message.
+}
@@ -0,0 +1,177 @@
+package webmodel
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSON_SCHEMA_DIALECT is the version of JSON Schema the generated schema conforms to.
+const JSON_SCHEMA_DIALECT = "https://json-schema.org/draft/2020-12/schema"
+
+// SchemaDescriber is implemented by the types with a custom JSON encoding, which describe their JSON Schema themselves.
+type SchemaDescriber interface {
+	JSONSchema() map[string]any
+}
+
+/*
+MessagesJSONSchema generates the JSON Schema of the messages the clients can send, from the registry of the messages
+and the `json` and `validate` tags of the payload types. The frontend requests can be checked against it.
+
+Every message is an object with the `type` of the message, its `payload` and an optional request `id`.
+The fields without `omitempty` are required and unknown fields are not allowed, as DecodeMessage does.
+*/
+func MessagesJSONSchema() map[string]any {
+	messages := make([]any, 0, len(messageSchemas))
+	for _, messageType := range sortedKeys(messageSchemas) {
+		schema := messageSchemas[messageType]
+		message := map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"type":    map[string]any{"const": messageType},
+				"payload": payloadJSONSchema(schema),
+				"id":      map[string]any{"type": "string", "maxLength": MAX_REQUEST_ID_LENGTH},
+			},
+			"required":             []string{"type"},
+			"additionalProperties": false,
+		}
+		if schema.Payload != nil || schema.Variants != nil {
+			message["required"] = []string{"type", "payload"}
+		}
+		messages = append(messages, message)
+	}
+
+	return map[string]any{
+		"$schema":     JSON_SCHEMA_DIALECT,
+		"title":       "Bomberman client messages",
+		"description": "The WebSocket messages the clients send to the server. Generated from the backend webmodel package, do not edit.",
+		"oneOf":       messages,
+	}
+}
+
+// payloadJSONSchema returns the JSON Schema of the payload of a message type.
+func payloadJSONSchema(schema MessageSchema) map[string]any {
+	if schema.Variants == nil {
+		if schema.Payload == nil {
+			// The payload is ignored
+			return map[string]any{}
+		}
+		return typeJSONSchema(schema.Payload)
+	}
+
+	variants := make([]any, 0, len(schema.Variants))
+	for _, variantType := range sortedKeys(schema.Variants) {
+		variant := typeJSONSchema(schema.Variants[variantType])
+		variant["properties"].(map[string]any)["type"] = map[string]any{"const": variantType}
+		variants = append(variants, variant)
+	}
+	return map[string]any{"oneOf": variants}
+}
+
+// typeJSONSchema returns the JSON Schema of the values of a Go type.
+func typeJSONSchema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		return typeJSONSchema(t.Elem())
+	}
+	if describer, ok := reflect.Zero(t).Interface().(SchemaDescriber); ok {
+		return describer.JSONSchema()
+	}
+	if t == reflect.TypeFor[time.Time]() {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	if t == reflect.TypeFor[json.RawMessage]() {
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Array:
+		return map[string]any{"type": "array", "items": typeJSONSchema(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeJSONSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeJSONSchema(t.Elem())}
+	case reflect.Struct:
+		schema := map[string]any{"type": "object", "properties": map[string]any{}, "additionalProperties": false}
+		required := []string{}
+		addStructFields(schema["properties"].(map[string]any), &required, t)
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	// Interfaces can hold any value
+	return map[string]any{}
+}
+
+// addStructFields adds the JSON Schemas of the fields of a struct to `properties`;
+// the fields of the embedded structs belong to the outer struct.
+func addStructFields(properties map[string]any, required *[]string, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, omitEmpty, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addStructFields(properties, required, field.Type)
+			continue
+		}
+
+		fieldSchema := typeJSONSchema(field.Type)
+		rules := parseValidateTag(field.Tag.Get(VALIDATE_TAG))
+		for _, rule := range rules {
+			addRuleToSchema(fieldSchema, rule)
+		}
+		properties[name] = fieldSchema
+		if !omitEmpty || slices.ContainsFunc(rules, func(rule validationRule) bool { return rule.name == "required" }) {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// addRuleToSchema adds a rule of a `validate` tag to the JSON Schema of a field.
+func addRuleToSchema(schema map[string]any, rule validationRule) {
+	isString := schema["type"] == "string"
+	switch rule.name {
+	case "required":
+		if isString {
+			schema["minLength"] = 1
+		}
+	case "min", "max":
+		bound, _ := strconv.ParseFloat(rule.value, 64)
+		keyword := map[string]string{"min": "minimum", "max": "maximum"}[rule.name]
+		if isString {
+			keyword = map[string]string{"min": "minLength", "max": "maxLength"}[rule.name]
+		}
+		schema[keyword] = bound
+	case "oneof":
+		schema["enum"] = strings.Fields(rule.value)
+	}
+}
+
+// sortedKeys returns the keys of a map in order, so the generated schema is stable.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,13 @@
+package webmodel
+
+// LatencyPing is the payload of the application-level `ping` and `pong` messages.
+//
+// The server sends `ping` with a `Nonce` and the client replies `pong` with the same payload,
+// so the server can measure the round-trip time from the send time it kept for the nonce; the `ServerTime`
+// of a pong is ignored. The client can send `ping` with `ClientTime` and gets a reply with both times,
+// so it can measure the round-trip time on its side.
+type LatencyPing struct {
+	Nonce      uint64 `json:"nonce,omitempty"`                       // The identifier of a server's ping, echoed in the pong.
+	ServerTime int64  `json:"serverTime,omitempty" validate:"min=0"` // Unix time in milliseconds when the server sent the ping.
+	ClientTime int64  `json:"clientTime,omitempty" validate:"min=0"` // Unix time in milliseconds when the client sent the ping.
+}
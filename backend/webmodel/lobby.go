@@ -0,0 +1,40 @@
+package webmodel
+
+import "github.com/Pomog/bomberman/backend/gamerules"
+
+// LobbySettings are the game rules of a room the host can change before the start with a `setLobbySettings` request,
+// on top of the preset of the room. The request sets all the settings at once.
+// The settings are validated with the other game rules of the room (see gamerules.GameRules.Validate).
+type LobbySettings struct {
+	MapTemplate    string `json:"mapTemplate"`             // The template of the map, one of the templates of mapgen.
+	Lives          int    `json:"lives"`                   // The lives of every player.
+	MatchDuration  int    `json:"matchDuration"`           // The duration of a match in seconds.
+	PowerUpDensity int    `json:"powerUpDensity"`          // The percentage of the destroyable blocks hiding a power-up.
+	Bots           int    `json:"bots"`                    // The number of bots added when the room is filled.
+	BotDifficulty  string `json:"botDifficulty,omitempty"` // The difficulty level of the bots; the one of the room is kept if empty.
+}
+
+// GamePresetRequest is the payload of the `setGamePreset` requests of the host, which reset the game rules of the room to a preset.
+type GamePresetRequest struct {
+	Preset string `json:"preset" validate:"required,max=50"` // The name of the preset, one of the presets of the server.
+}
+
+// LobbyState is the payload of the `lobby` messages, sent to a player joining a room
+// and to the room when its host or its game rules change.
+type LobbyState struct {
+	Host    string              `json:"host"`    // The name of the host of the room, empty if there is no human in the room.
+	Rules   gamerules.GameRules `json:"rules"`   // The game rules of the room.
+	Presets []string            `json:"presets"` // The names of the presets the host can choose.
+}
+
+// GameStart is the payload of the `gameStarted` message, and the reply to `startGame` from RULES_PROTOCOL_VERSION;
+// the older clients get the map only.
+type GameStart struct {
+	GameMap string              `json:"gameMap"` // The map of the room, see mapgen.
+	Rules   gamerules.GameRules `json:"rules"`   // The game rules of the room.
+}
+
+// MatchResult is the payload of the `matchOver` message, sent to the room when the duration of the match is over.
+type MatchResult struct {
+	Survivors []string `json:"survivors"` // The names of the players still in the game, sorted.
+}
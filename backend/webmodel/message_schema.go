@@ -0,0 +1,184 @@
+package webmodel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//go:generate go run ../cmd/schemagen -o ../../frontend/schema/messages.schema.json
+
+// Errors returned by DecodeMessage; the message of the error says precisely what is wrong.
+var (
+	ErrUnknownMessageType = errors.New("unknown message type")
+	ErrInvalidPayload     = errors.New("invalid payload")
+	ErrInvalidRequestID   = errors.New("invalid request id")
+)
+
+// MessageSchema describes the payload of a message type sent by the clients.
+type MessageSchema struct {
+	Payload reflect.Type // The Go type the payload is decoded into; nil if the payload is ignored.
+
+	// Variants are the Go types of a payload discriminated by its "type" field, like the player actions.
+	// Used instead of Payload.
+	Variants map[string]reflect.Type
+}
+
+// messageSchemas is the registry of the messages the clients can send.
+// A message type missing here is rejected before reaching its handler, so every new route must be registered.
+var messageSchemas = map[string]MessageSchema{
+	SendMessageToChat: {Payload: reflect.TypeFor[ChatMessage]()},
+	PlayerAction: {Variants: map[string]reflect.Type{
+		ACTION_MOVE:         reflect.TypeFor[MoveAction](),
+		ACTION_PLACE_BOMB:   reflect.TypeFor[PlaceBombAction](),
+		ACTION_POWER_PICKED: reflect.TypeFor[PowerPickedAction](),
+		ACTION_DIE:          reflect.TypeFor[DieAction](),
+	}},
+	StartGame:         {Payload: reflect.TypeFor[string]()},
+	ReadyToStart:      {},
+	SetReady:          {Payload: reflect.TypeFor[ReadyRequest]()},
+	UserQuitChat:      {},
+	StateAck:          {Payload: reflect.TypeFor[uint64]()},
+	Ping:              {Payload: reflect.TypeFor[LatencyPing]()},
+	Pong:              {Payload: reflect.TypeFor[LatencyPing]()},
+	ChatHistory:       {Payload: reflect.TypeFor[ChatHistoryRequest]()},
+	EditChatMessage:   {Payload: reflect.TypeFor[EditChatMessageRequest]()},
+	DeleteChatMessage: {Payload: reflect.TypeFor[ChatMessageRef]()},
+	SetPresence:       {Payload: reflect.TypeFor[PresenceRequest]()},
+	Typing:            {Payload: reflect.TypeFor[TypingIndicator]()},
+	MutePlayer:        {Payload: reflect.TypeFor[MuteRequest]()},
+	KickPlayer:        {Payload: reflect.TypeFor[KickRequest]()},
+	SetLobbySettings:  {Payload: reflect.TypeFor[LobbySettings]()},
+	SetGamePreset:     {Payload: reflect.TypeFor[GamePresetRequest]()},
+}
+
+// The `validate` tags of the registry are checked when the package is initialized,
+// so a bad tag stops the server at startup instead of failing the requests of its message type.
+func init() {
+	if err := checkSchemas(messageSchemas); err != nil {
+		panic(fmt.Sprintf("webmodel: %v", err))
+	}
+}
+
+// checkSchemas checks the `validate` tags of the payloads of the message schemas (see checkTags).
+func checkSchemas(schemas map[string]MessageSchema) error {
+	checked := make(map[reflect.Type]bool)
+	for _, messageType := range sortedKeys(schemas) {
+		schema := schemas[messageType]
+		if schema.Payload != nil {
+			if err := checkTags(schema.Payload, "", checked); err != nil {
+				return fmt.Errorf("payload of '%s': %w", messageType, err)
+			}
+		}
+		for _, variant := range sortedKeys(schema.Variants) {
+			if err := checkTags(schema.Variants[variant], "", checked); err != nil {
+				return fmt.Errorf("payload '%s' of '%s': %w", variant, messageType, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validator is implemented by the payloads with rules which can't be expressed with the `validate` tags.
+// Validate returns the error message if the validation fails, otherwise an empty string.
+type Validator interface {
+	Validate() string
+}
+
+/*
+DecodeMessage decodes the payload of a message received from a client into the Go type registered
+for the message type, and validates it with the `validate` tags of the type and its Validate method.
+
+The decoding is strict: unknown fields and trailing data are rejected.
+
+Returns the decoded payload (a value, not a pointer), or nil if the payload of the message type is ignored.
+The error wraps ErrUnknownMessageType, ErrInvalidRequestID or ErrInvalidPayload.
+*/
+func DecodeMessage(message WSMessage) (any, error) {
+	if len(message.ID) > MAX_REQUEST_ID_LENGTH {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalidRequestID, MAX_REQUEST_ID_LENGTH)
+	}
+
+	schema, ok := messageSchemas[message.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownMessageType, message.Type)
+	}
+
+	payloadType := schema.Payload
+	if payloadType == nil && schema.Variants == nil {
+		return nil, nil
+	}
+	if len(message.Payload) == 0 {
+		return nil, fmt.Errorf("%w: the payload is missing", ErrInvalidPayload)
+	}
+
+	if schema.Variants != nil {
+		// Read the discriminator first to find out the type of the payload
+		var header struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(message.Payload, &header); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPayload, describeJSONError(err))
+		}
+		payloadType, ok = schema.Variants[header.Type]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown type '%s'", ErrInvalidPayload, header.Type)
+		}
+	}
+
+	payload := reflect.New(payloadType)
+	decoder := json.NewDecoder(bytes.NewReader(message.Payload))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(payload.Interface()); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPayload, describeJSONError(err))
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("%w: unexpected data after the payload", ErrInvalidPayload)
+	}
+
+	if errMessage := validateValue(payload, ""); errMessage != "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPayload, errMessage)
+	}
+	return payload.Elem().Interface(), nil
+}
+
+// describeJSONError converts a decoding error to a message for the client, naming the wrong field.
+func describeJSONError(err error) string {
+	var typeError *json.UnmarshalTypeError
+	var syntaxError *json.SyntaxError
+	switch {
+	case errors.As(err, &typeError):
+		if typeError.Field == "" {
+			return fmt.Sprintf("must be %s, got %s", jsonTypeName(typeError.Type), typeError.Value)
+		}
+		return fmt.Sprintf("'%s' must be %s, got %s", typeError.Field, jsonTypeName(typeError.Type), typeError.Value)
+	case errors.As(err, &syntaxError):
+		return fmt.Sprintf("malformed JSON at byte %d", syntaxError.Offset)
+	}
+	// Unknown fields and the errors of the custom decoders, e.g. `json: unknown field "x"`
+	return strings.TrimPrefix(err.Error(), "json: ")
+}
+
+// jsonTypeName returns the name of the JSON type a Go type is decoded from, e.g. "an integer".
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a non-negative integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Array, reflect.Slice:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	}
+	return t.String()
+}
@@ -0,0 +1,27 @@
+package webmodel
+
+import (
+	"time"
+)
+
+// MuteRequest is the payload of a `mutePlayer` request of the room host.
+type MuteRequest struct {
+	UserName string `json:"userName" validate:"required"`                 // Required: The player to mute.
+	Duration int    `json:"duration,omitempty" validate:"min=0,max=3600"` // Optional: The duration of the mute in seconds, 5 minutes by default.
+	Unmute   bool   `json:"unmute,omitempty"`                             // Optional: Lift the mute of the player instead.
+}
+
+// KickRequest is the payload of a `kickPlayer` request of the room host.
+type KickRequest struct {
+	UserName string `json:"userName" validate:"required"`        // Required: The player to kick out of the room.
+	Reason   string `json:"reason,omitempty" validate:"max=200"` // Optional: The reason, shown to the room and to the kicked player.
+}
+
+// ModerationEvent is the payload of a `moderation` message, telling the room about a moderation action.
+type ModerationEvent struct {
+	Action   string     `json:"action"`           // The action: "mute", "unmute" or "kick".
+	UserName string     `json:"userName"`         // The player the action is about.
+	By       string     `json:"by"`               // The player who did the action.
+	Until    *time.Time `json:"until,omitempty"`  // The end of a mute.
+	Reason   string     `json:"reason,omitempty"` // The reason of a kick.
+}
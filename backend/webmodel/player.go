@@ -4,8 +4,8 @@ import "encoding/json"
 
 // PlrAction represents an action performed by a player in the game.
 type PlrAction struct {
-	UserName string          `json:"playerName"` // The name of the player performing the action.
-	Action   json.RawMessage `json:"action"`     // The action details in raw JSON format, allowing flexible action structures.
+	UserName string `json:"playerName"` // The name of the player performing the action.
+	Action   Action `json:"action"`     // The validated action details, e.g. a MoveAction.
 }
 
 // PlayerInfo represents basic information about a player.
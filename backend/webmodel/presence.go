@@ -0,0 +1,24 @@
+package webmodel
+
+// Constants representing the presence states of the players, broadcast in the `presence` messages.
+const (
+	PRESENCE_ONLINE     = "online"     // In the room, active (the default).
+	PRESENCE_IDLE       = "idle"       // In the room, the page of the player is hidden or inactive.
+	PRESENCE_IN_GAME    = "inGame"     // Playing the game of the room.
+	PRESENCE_SPECTATING = "spectating" // Watching the game of the room after losing all lives.
+
+	// Reserved for the reconnection of a dropped connection, not sent while FEATURE_RECONNECTION is not supported.
+	PRESENCE_RECONNECTING = "reconnecting"
+)
+
+// PresenceRequest is the payload of a `setPresence` request: the player's page tells whether it is active.
+// The other states are set by the server.
+type PresenceRequest struct {
+	Presence string `json:"presence" validate:"required,oneof=online idle"` // Required: "online" or "idle".
+}
+
+// TypingIndicator is the payload of the `typing` messages: a player started or stopped typing in the chat.
+type TypingIndicator struct {
+	UserName string `json:"playerName,omitempty"` // Set by the server: the player who is typing.
+	Typing   bool   `json:"typing"`               // True while the player is typing.
+}
@@ -0,0 +1,83 @@
+package webmodel
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Constants of the protocol versioning.
+//
+// The client sends its protocol version in the `version` query parameter of `/joinGame`.
+// A client without the parameter is a tab opened before the versioning and speaks version 1.
+// From version 2 the server sends a `hello` message first, with the negotiated version and the features of the server.
+// From version 3 the reply to `startGame` holds the game rules of the room with the map (see GameStart).
+const (
+	PROTOCOL_VERSION        = 3         // The current version of the protocol.
+	LEGACY_PROTOCOL_VERSION = 1         // The version of the clients which don't send a version.
+	HELLO_PROTOCOL_VERSION  = 2         // The first version with the `hello` message.
+	RULES_PROTOCOL_VERSION  = 3         // The first version with the game rules in the reply to `startGame`.
+	VERSION_PARAM           = "version" // The query parameter of `/joinGame` with the client's protocol version.
+
+	CLOSE_UNSUPPORTED_PROTOCOL = 4003 // WebSocket close code sent to the clients with an unsupported protocol version.
+)
+
+// SUPPORTED_PROTOCOL_VERSIONS are the versions the server can speak, the oldest first.
+var SUPPORTED_PROTOCOL_VERSIONS = []int{LEGACY_PROTOCOL_VERSION, HELLO_PROTOCOL_VERSION, RULES_PROTOCOL_VERSION}
+
+// Constants representing the optional features of the server, listed in the `hello` message.
+const (
+	FEATURE_BINARY       = "binary"       // Game messages in the binary encoding (see BINARY_SUBPROTOCOL).
+	FEATURE_RECONNECTION = "reconnection" // Rejoining the room after a dropped connection.
+	FEATURE_SPECTATOR    = "spectator"    // Watching a game without playing.
+)
+
+// ServerFeatures tells which optional features the server supports.
+// The binary encoding is not advertised while the frontend can't decode it;
+// a client requesting BINARY_SUBPROTOCOL still gets it.
+var ServerFeatures = map[string]bool{
+	FEATURE_BINARY:       false,
+	FEATURE_RECONNECTION: false,
+	FEATURE_SPECTATOR:    false,
+}
+
+// ProtocolHello is the payload of the first message the server sends on a connection, and the only one
+// before closing the connection of a client with an unsupported protocol version.
+type ProtocolHello struct {
+	Version           int             `json:"version"`           // The negotiated protocol version, 0 if the client's version is not supported.
+	SupportedVersions []int           `json:"supportedVersions"` // The versions the server can speak.
+	Features          map[string]bool `json:"features"`          // The optional features of the server.
+	Encoding          string          `json:"encoding"`          // The encoding of the game messages on this connection: "json" or "binary".
+}
+
+// ParseProtocolVersion reads the protocol version of the `version` query parameter of a client.
+// An empty parameter means LEGACY_PROTOCOL_VERSION.
+// Returns an error if the version is malformed or not supported.
+func ParseProtocolVersion(param string) (int, error) {
+	if param == "" {
+		return LEGACY_PROTOCOL_VERSION, nil
+	}
+	version, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, errors.New("malformed protocol version")
+	}
+	if !slices.Contains(SUPPORTED_PROTOCOL_VERSIONS, version) {
+		return 0, fmt.Errorf("unsupported protocol version %d, the server supports %v", version, SUPPORTED_PROTOCOL_VERSIONS)
+	}
+	return version, nil
+}
+
+// NewHello creates the payload of the `hello` message of a connection with the negotiated version (0 if none) and encoding.
+func NewHello(version int, binary bool) ProtocolHello {
+	encoding := "json"
+	if binary {
+		encoding = "binary"
+	}
+	return ProtocolHello{
+		Version:           version,
+		SupportedVersions: SUPPORTED_PROTOCOL_VERSIONS,
+		Features:          ServerFeatures,
+		Encoding:          encoding,
+	}
+}
@@ -0,0 +1,18 @@
+package webmodel
+
+import "time"
+
+// ReadyRequest is the payload of a `setReady` request: the player is ready, or not ready anymore, to start the game.
+type ReadyRequest struct {
+	Ready bool `json:"ready"`
+}
+
+// ReadyCheckStatus is the payload of the `readyCheck` messages, broadcast to the room when its ready check changes.
+// The countdown to the start of the game runs while StartsAt is set; when it ends, the server starts the game
+// and sends the room a `gameStarted` message.
+type ReadyCheckStatus struct {
+	Ready    int        `json:"ready"`              // The number of human players ready to start.
+	Players  int        `json:"players"`            // The number of human players in the room.
+	StartsAt *time.Time `json:"startsAt,omitempty"` // The time the game starts at, nil if the countdown is not running.
+	Seconds  int        `json:"seconds,omitempty"`  // The seconds left before the start of the game, for the clients with a skewed clock.
+}
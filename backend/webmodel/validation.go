@@ -0,0 +1,259 @@
+package webmodel
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+The `validate` tag lists the rules of a field, separated by commas:
+  - required: the field must not be empty (zero, or a blank string);
+  - min=N, max=N: the bounds of a number, or of the length of a string;
+  - oneof=a b c: the allowed values of a string; an empty string is allowed unless the field is required.
+
+The rules are checked by DecodeMessage and are written to the generated JSON Schema.
+The tags of the registered messages are checked when the package is initialized (see checkTags).
+*/
+const VALIDATE_TAG = "validate"
+
+// validationRule is one rule of a `validate` tag.
+type validationRule struct {
+	name  string // required, min, max or oneof.
+	value string // The parameter of the rule, e.g. "0" for "min=0".
+}
+
+// parseValidateTag splits a `validate` tag into its rules.
+func parseValidateTag(tag string) []validationRule {
+	var rules []validationRule
+	for _, rule := range strings.Split(tag, ",") {
+		if rule == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(rule, "=")
+		rules = append(rules, validationRule{name: name, value: value})
+	}
+	return rules
+}
+
+/*
+validateValue checks a decoded value against the `validate` tags of its fields and the Validate methods
+of its types, recursively.
+
+`path` is the JSON path of the value, used in the error messages, e.g. "coords.row".
+Returns the error message if the validation fails, otherwise an empty string.
+*/
+func validateValue(value reflect.Value, path string) string {
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type() == reflect.TypeFor[time.Time]() {
+			return ""
+		}
+		if errMessage := validateStruct(value, path); errMessage != "" {
+			return errMessage
+		}
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			if errMessage := validateValue(value.Index(i), fmt.Sprintf("%s[%d]", path, i)); errMessage != "" {
+				return errMessage
+			}
+		}
+	}
+
+	// The Validate method runs after the rules of the fields, it may have a pointer receiver
+	if value.CanAddr() {
+		if validator, ok := value.Addr().Interface().(Validator); ok {
+			return withPath(path, validator.Validate())
+		}
+	}
+	if validator, ok := value.Interface().(Validator); ok {
+		return withPath(path, validator.Validate())
+	}
+	return ""
+}
+
+// validateStruct checks the fields of a struct; the fields of the embedded structs belong to the outer struct.
+func validateStruct(value reflect.Value, path string) string {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+		fieldPath := path
+		if !field.Anonymous {
+			fieldPath = joinPath(path, name)
+		}
+
+		for _, rule := range parseValidateTag(field.Tag.Get(VALIDATE_TAG)) {
+			if errMessage := checkRule(value.Field(i), rule); errMessage != "" {
+				return fmt.Sprintf("'%s' %s", fieldPath, errMessage)
+			}
+		}
+		if errMessage := validateValue(value.Field(i), fieldPath); errMessage != "" {
+			return errMessage
+		}
+	}
+	return ""
+}
+
+// checkRule checks a value against one rule; it returns the error message without the field name.
+// The rule is valid for the type of the value, as checked by checkTags.
+func checkRule(value reflect.Value, rule validationRule) string {
+	switch rule.name {
+	case "required":
+		if value.IsZero() || (value.Kind() == reflect.String && IsEmpty(value.String())) {
+			return "is required"
+		}
+	case "min", "max":
+		bound, _ := strconv.ParseFloat(rule.value, 64)
+		number, isLength := numberToCheck(value)
+		if (rule.name == "min" && number < bound) || (rule.name == "max" && number > bound) {
+			bounds := map[string]string{"min": "at least", "max": "at most"}
+			if isLength {
+				return fmt.Sprintf("must have %s %s characters", bounds[rule.name], rule.value)
+			}
+			return fmt.Sprintf("must be %s %s", bounds[rule.name], rule.value)
+		}
+	case "oneof":
+		allowed := strings.Fields(rule.value)
+		if value.String() != "" && !slices.Contains(allowed, value.String()) {
+			return fmt.Sprintf("must be one of: %s", strings.Join(allowed, ", "))
+		}
+	}
+	return ""
+}
+
+// numberToCheck returns the number the min and max rules apply to: the value of a number,
+// or the length of a string (isLength is true then). The other kinds are 0.
+func numberToCheck(value reflect.Value) (number float64, isLength bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), false
+	case reflect.String:
+		return float64(len([]rune(value.String()))), true
+	}
+	return 0, false
+}
+
+/*
+checkTags checks the `validate` tags of a type and of the types of its fields, recursively, as validateValue
+walks them: the rules must be known and fit the type of their field.
+
+`path` is the JSON path of the type, used in the error messages; `checked` holds the structs already checked.
+Returns an error naming the field with a bad tag.
+*/
+func checkTags(t reflect.Type, path string, checked map[reflect.Type]bool) error {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == reflect.TypeFor[time.Time]() || checked[t] {
+			return nil
+		}
+		checked[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, skip := jsonFieldName(field)
+			if skip {
+				continue
+			}
+			fieldPath := path
+			if !field.Anonymous {
+				fieldPath = joinPath(path, name)
+			}
+
+			for _, rule := range parseValidateTag(field.Tag.Get(VALIDATE_TAG)) {
+				if err := checkTagRule(field.Type, rule); err != nil {
+					return fmt.Errorf("field '%s': %w", fieldPath, err)
+				}
+			}
+			if err := checkTags(field.Type, fieldPath, checked); err != nil {
+				return err
+			}
+		}
+	case reflect.Array, reflect.Slice:
+		return checkTags(t.Elem(), path+"[]", checked)
+	}
+	return nil
+}
+
+// checkTagRule checks that a rule of a `validate` tag is known and can be applied to a field of the type.
+func checkTagRule(t reflect.Type, rule validationRule) error {
+	switch rule.name {
+	case "required":
+	case "min", "max":
+		if _, err := strconv.ParseFloat(rule.value, 64); err != nil {
+			return fmt.Errorf("invalid bound in the validate rule '%s=%s'", rule.name, rule.value)
+		}
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64, reflect.String:
+		default:
+			return fmt.Errorf("the validate rule '%s' can't be applied to %s", rule.name, t)
+		}
+	case "oneof":
+		if t.Kind() != reflect.String {
+			return fmt.Errorf("the validate rule 'oneof' can't be applied to %s", t)
+		}
+		if len(strings.Fields(rule.value)) == 0 {
+			return fmt.Errorf("the validate rule 'oneof' has no values")
+		}
+	default:
+		return fmt.Errorf("unknown validate rule '%s'", rule.name)
+	}
+	return nil
+}
+
+// jsonFieldName returns the name of a struct field in JSON, whether it is omitted when empty,
+// and whether it is skipped by the JSON encoding.
+func jsonFieldName(field reflect.StructField) (name string, omitEmpty bool, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, strings.Contains(options, "omitempty"), false
+}
+
+// joinPath appends a field name to a JSON path.
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// withPath prefixes the error message of a Validate method with the path of the value, if any.
+func withPath(path, errMessage string) string {
+	if path == "" || errMessage == "" {
+		return errMessage
+	}
+	return fmt.Sprintf("'%s' %s", path, errMessage)
+}
@@ -0,0 +1,267 @@
+package webmodel
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Types of the validation tests; the embedded struct is exported, as the embedded structs of the payloads.
+type (
+	EmbeddedHeader struct {
+		Kind string `json:"kind" validate:"required,oneof=a b"`
+	}
+	testItem struct {
+		Count int `json:"count" validate:"min=1,max=3"`
+	}
+	testPayload struct {
+		EmbeddedHeader
+		Name   string     `json:"name" validate:"required,min=2,max=5"`
+		Score  float64    `json:"score,omitempty" validate:"min=-1,max=1"`
+		Color  string     `json:"color,omitempty" validate:"oneof=red green"`
+		Item   testItem   `json:"item"`
+		Items  []testItem `json:"items,omitempty"`
+		Hidden int        `json:"-" validate:"min=100"`
+	}
+)
+
+// validTestPayload returns a payload passing all the rules.
+func validTestPayload() testPayload {
+	return testPayload{
+		EmbeddedHeader: EmbeddedHeader{Kind: "a"},
+		Name:           "alice",
+		Item:           testItem{Count: 1},
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(p *testPayload)
+		want   string // The error message, empty if the payload is valid.
+	}{
+		{
+			name:   "valid",
+			change: func(p *testPayload) {},
+		},
+		{
+			name:   "missing required string",
+			change: func(p *testPayload) { p.Name = "" },
+			want:   "'name' is required",
+		},
+		{
+			name:   "blank required string",
+			change: func(p *testPayload) { p.Name = "   " },
+			want:   "'name' is required",
+		},
+		{
+			name:   "string too short",
+			change: func(p *testPayload) { p.Name = "a" },
+			want:   "'name' must have at least 2 characters",
+		},
+		{
+			name:   "string too long",
+			change: func(p *testPayload) { p.Name = "alice!" },
+			want:   "'name' must have at most 5 characters",
+		},
+		{
+			name:   "length counted in characters",
+			change: func(p *testPayload) { p.Name = "éèàçù" },
+		},
+		{
+			name:   "number under the minimum",
+			change: func(p *testPayload) { p.Score = -1.5 },
+			want:   "'score' must be at least -1",
+		},
+		{
+			name:   "number over the maximum",
+			change: func(p *testPayload) { p.Score = 1.5 },
+			want:   "'score' must be at most 1",
+		},
+		{
+			name:   "value not in oneof",
+			change: func(p *testPayload) { p.Color = "blue" },
+			want:   "'color' must be one of: red, green",
+		},
+		{
+			name:   "empty optional oneof",
+			change: func(p *testPayload) { p.Color = "" },
+		},
+		{
+			name:   "nested struct",
+			change: func(p *testPayload) { p.Item.Count = 0 },
+			want:   "'item.count' must be at least 1",
+		},
+		{
+			name:   "nested slice",
+			change: func(p *testPayload) { p.Items = []testItem{{Count: 2}, {Count: 4}} },
+			want:   "'items[1].count' must be at most 3",
+		},
+		{
+			name:   "embedded struct",
+			change: func(p *testPayload) { p.Kind = "c" },
+			want:   "'kind' must be one of: a, b",
+		},
+		{
+			name:   "field skipped by JSON",
+			change: func(p *testPayload) { p.Hidden = 1 },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := validTestPayload()
+			test.change(&payload)
+			if got := validateValue(reflect.ValueOf(&payload), ""); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckTags(t *testing.T) {
+	type unknownRule struct {
+		Name string `json:"name" validate:"required,unique"`
+	}
+	type invalidBound struct {
+		Count int `json:"count" validate:"max=ten"`
+	}
+	type boundOfBool struct {
+		Flag bool `json:"flag" validate:"min=1"`
+	}
+	type oneofOfNumber struct {
+		Count int `json:"count" validate:"oneof=1 2"`
+	}
+	type emptyOneof struct {
+		Name string `json:"name" validate:"oneof="`
+	}
+	type nestedBadTag struct {
+		Items []unknownRule `json:"items"`
+	}
+	type EmbeddedBadTag struct {
+		Count int `json:"count" validate:"max=ten"`
+	}
+	type embeddingBadTag struct {
+		EmbeddedBadTag
+	}
+
+	tests := []struct {
+		name    string
+		payload reflect.Type
+		want    string // A part of the error, empty if the tags are valid.
+	}{
+		{name: "valid", payload: reflect.TypeFor[testPayload]()},
+		{name: "unknown rule", payload: reflect.TypeFor[unknownRule](), want: "field 'name': unknown validate rule 'unique'"},
+		{name: "invalid bound", payload: reflect.TypeFor[invalidBound](), want: "field 'count': invalid bound"},
+		{name: "bound of a boolean", payload: reflect.TypeFor[boundOfBool](), want: "field 'flag': the validate rule 'min' can't be applied to bool"},
+		{name: "oneof of a number", payload: reflect.TypeFor[oneofOfNumber](), want: "field 'count': the validate rule 'oneof' can't be applied to int"},
+		{name: "oneof without values", payload: reflect.TypeFor[emptyOneof](), want: "field 'name': the validate rule 'oneof' has no values"},
+		{name: "nested", payload: reflect.TypeFor[nestedBadTag](), want: "field 'items[].name': unknown validate rule"},
+		{name: "embedded", payload: reflect.TypeFor[embeddingBadTag](), want: "field 'count': invalid bound"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkSchemas(map[string]MessageSchema{"test": {Payload: test.payload}})
+			if test.want == "" {
+				if err != nil {
+					t.Errorf("got error %v, want the tags to be valid", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestMessageSchemasHaveValidTags(t *testing.T) {
+	if err := checkSchemas(messageSchemas); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecodeMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		messageType string
+		payload     string
+		want        any
+		wantErr     error
+		wantMessage string // A part of the error message.
+	}{
+		{
+			name:        "valid payload",
+			messageType: MutePlayer,
+			payload:     `{"userName": "bob", "duration": 60}`,
+			want:        MuteRequest{UserName: "bob", Duration: 60},
+		},
+		{
+			name:        "rule of the registered type",
+			messageType: MutePlayer,
+			payload:     `{"userName": "bob", "duration": 4000}`,
+			wantErr:     ErrInvalidPayload,
+			wantMessage: "'duration' must be at most 3600",
+		},
+		{
+			name:        "unknown field",
+			messageType: MutePlayer,
+			payload:     `{"userName": "bob", "seconds": 60}`,
+			wantErr:     ErrInvalidPayload,
+			wantMessage: `unknown field "seconds"`,
+		},
+		{
+			name:        "wrong type",
+			messageType: MutePlayer,
+			payload:     `{"userName": 7}`,
+			wantErr:     ErrInvalidPayload,
+			wantMessage: "'userName' must be a string",
+		},
+		{
+			name:        "nested field of a variant",
+			messageType: PlayerAction,
+			payload:     `{"type": "placeBomb", "coords": {"row": 1, "column": -1, "power": 1}}`,
+			wantErr:     ErrInvalidPayload,
+			wantMessage: "'coords.column' must be at least 0",
+		},
+		{
+			name:        "unknown variant",
+			messageType: PlayerAction,
+			payload:     `{"type": "fly"}`,
+			wantErr:     ErrInvalidPayload,
+			wantMessage: "unknown type 'fly'",
+		},
+		{
+			name:        "unknown message type",
+			messageType: "fly",
+			payload:     `{}`,
+			wantErr:     ErrUnknownMessageType,
+		},
+		{
+			name:        "ignored payload",
+			messageType: ReadyToStart,
+			payload:     `{"anything": true}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DecodeMessage(WSMessage{Type: test.messageType, Payload: json.RawMessage(test.payload)})
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) || !strings.Contains(err.Error(), test.wantMessage) {
+					t.Errorf("got error %v, want %v with %q", err, test.wantErr, test.wantMessage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
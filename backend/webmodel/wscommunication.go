@@ -15,17 +15,47 @@ const (
 
 // Constants representing different types of WebSocket messages.
 const (
-	ERROR_TYPE        = "ERROR"             // General error message type.
-	UsersInRoom       = "usersInRoom"       // Message type for retrieving users in a room.
-	RegisterNewPlayer = "registerNewPlayer" // Message type for registering a new player.
-	SendMessageToChat = "sendMessageToChat" // Message type for sending a message to the chat.
-	InputChatMessage  = "inputChatMessage"  // Message type for handling chat input.
-	UserQuitChat      = "userQuitChat"      // Message type for when a user quits the chat.
-	ReadyToStart      = "readyToStart"      // Message type for indicating readiness to start the game.
-	StartGame         = "startGame"         // Message type for starting the game.
-	PlayerAction      = "playerAction"      // Message type for handling player actions.
+	ERROR_TYPE         = "ERROR"              // General error message type.
+	UsersInRoom        = "usersInRoom"        // Message type for retrieving users in a room.
+	RegisterNewPlayer  = "registerNewPlayer"  // Message type for registering a new player.
+	SendMessageToChat  = "sendMessageToChat"  // Message type for sending a message to the chat.
+	InputChatMessage   = "inputChatMessage"   // Message type for handling chat input.
+	UserQuitChat       = "userQuitChat"       // Message type for when a user quits the chat.
+	ReadyToStart       = "readyToStart"       // Message type for indicating readiness to start the game.
+	SetReady           = "setReady"           // Message type for marking the player as ready or not ready to start the game.
+	ReadyState         = "readyState"         // Message type for notifying the room that a player is ready or not ready.
+	ReadyCheck         = "readyCheck"         // Message type for the number of ready players and the countdown to the start of the game.
+	StartGame          = "startGame"          // Message type for starting the game.
+	GameStarted        = "gameStarted"        // Message type for the start of the game, sent to the room when the ready countdown ends.
+	PlayerAction       = "playerAction"       // Message type for handling player actions.
+	StateUpdate        = "stateUpdate"        // Message type for delta/keyframe snapshots of the room state.
+	StateAck           = "stateAck"           // Message type for acknowledging a received state update tick.
+	Ping               = "ping"               // Message type for application-level latency measurement pings.
+	Pong               = "pong"               // Message type for replies to the server's pings.
+	RoomLatency        = "roomLatency"        // Message type for broadcasting the latency of the players in a room.
+	Hello              = "hello"              // Message type for the protocol version and the features negotiated on join.
+	ChatHistory        = "chatHistory"        // Message type for the past messages of a chat channel, sent on join and on request.
+	EditChatMessage    = "editChatMessage"    // Message type for editing a chat message of the sender.
+	DeleteChatMessage  = "deleteChatMessage"  // Message type for deleting a chat message of the sender.
+	ChatMessageEdited  = "chatMessageEdited"  // Message type for notifying the channel of an edited message.
+	ChatMessageDeleted = "chatMessageDeleted" // Message type for notifying the channel of a deleted message.
+	SystemMessage      = "systemMessage"      // Message type for the replies of the chat commands, written by the server.
+	SetPresence        = "setPresence"        // Message type for setting the player's presence to online or idle.
+	Presence           = "presence"           // Message type for notifying the room of a change of a player's presence.
+	Typing             = "typing"             // Message type for the typing indicator of the chat.
+	MutePlayer         = "mutePlayer"         // Message type for muting or unmuting a player of the room, by the room host.
+	KickPlayer         = "kickPlayer"         // Message type for kicking a player out of the room, by the room host.
+	Moderation         = "moderation"         // Message type for notifying the room of a moderation action.
+	SetLobbySettings   = "setLobbySettings"   // Message type for changing some game rules of the room, by the room host.
+	Lobby              = "lobby"              // Message type for the host and the game rules of the room.
+	SetGamePreset      = "setGamePreset"      // Message type for choosing the preset of the game rules, by the room host.
+	MatchOver          = "matchOver"          // Message type for the end of the match when its duration is over.
+	PlayerCorrection   = "playerCorrection"   // Message type for the authoritative state of a player whose action was rejected.
 )
 
+// MAX_REQUEST_ID_LENGTH is the maximal length of the ID of a request.
+const MAX_REQUEST_ID_LENGTH = 64
+
 // ErrWarning represents a custom error that signifies a warning condition.
 var ErrWarning = errors.New("Warning")
 
@@ -40,6 +70,15 @@ type Payload struct {
 type WSMessage struct {
 	Type    string          `json:"type"`    // Type of the message (e.g., success, error).
 	Payload json.RawMessage `json:"payload"` // The data payload of the message.
+
+	// ID is the optional identifier a client gives to its request; the replies to the request echo it.
+	ID string `json:"id,omitempty"`
+	// Reply is true in the replies to a request (including the errors); the messages pushed by the server don't have it.
+	Reply bool `json:"reply,omitempty"`
+
+	// Data is the payload decoded and validated with the schema of the message type (see DecodeMessage).
+	// It is set before the handlers run.
+	Data any `json:"-"`
 }
 
 // String method returns a string representation of the WSMessage, useful for logging and debugging.
@@ -47,13 +86,37 @@ func (m *WSMessage) String() string {
 	if m == nil {
 		return "nil" // Return "nil" if the message is nil.
 	}
-	return fmt.Sprintf("Type: %s | Payload: %s\n", m.Type, m.Payload) // Return formatted message details.
+	return fmt.Sprintf("Type: %s | ID: %s | Payload: %s\n", m.Type, m.ID, m.Payload) // Return formatted message details.
 }
 
 // CreateReplyToRequestMessage creates a reply message to a request with a given result and data.
+// The reply echoes the ID of the request and is marked as a reply, so the client can match it with its request.
 func (m *WSMessage) CreateReplyToRequestMessage(result string, data any) (json.RawMessage, error) {
-	// Call CreateJSONMessage to generate a reply message.
-	return CreateJSONMessage(m.Type, result, data)
+	return m.createReply(m.Type, result, data)
+}
+
+// CreateServerErrorMessage creates an ERROR message telling that the handling of the request failed.
+// For the zero WSMessage, i.e. without a request, the error is a message pushed by the server.
+func (m *WSMessage) CreateServerErrorMessage(errMessage string) (json.RawMessage, error) {
+	return m.createReply(ERROR_TYPE, "serverError", errMessage)
+}
+
+// createReply creates a message of the given type replying to the request `m`, if any.
+func (m *WSMessage) createReply(messageType string, result string, data any) (json.RawMessage, error) {
+	reply, err := createWSMessage(messageType, result, data)
+	if err != nil {
+		return nil, fmt.Errorf("createReply failed: %v", err)
+	}
+	if m.Type != "" {
+		reply.ID = m.ID
+		reply.Reply = true
+	}
+
+	jsonMessage, err := json.Marshal(reply)
+	if err != nil {
+		return nil, fmt.Errorf("createReply failed: %v", err)
+	}
+	return jsonMessage, nil
 }
 
 // CreateJSONMessage creates a full WebSocket message (including type, result, and data),
@@ -2,14 +2,22 @@ package websocket_hub
 
 import (
 	"fmt"
+	"sync/atomic"
+	"time"
 
+	"github.com/Pomog/bomberman/backend/webmodel"
 	"github.com/gorilla/websocket"
 )
 
 // ClientUser represents a player with a name and assigned player number.
 type ClientUser struct {
-	UserName     string `json:"playerName"`   // The username of the player
-	PlayerNumber int    `json:"playerNumber"` // Assigned player number in the game
+	UserName     string `json:"playerName"`       // The username of the player
+	PlayerNumber int    `json:"playerNumber"`     // Assigned player number in the game
+	RTT          int64  `json:"rtt,omitempty"`    // Average round-trip time of the connection in milliseconds
+	Jitter       int64  `json:"jitter,omitempty"` // Average round-trip time variation in milliseconds
+	Bot          bool   `json:"bot,omitempty"`    // True if the player is a server-side bot
+	Presence     string `json:"presence"`         // The presence state of the player, one of the PRESENCE_ constants of webmodel
+	Ready        bool   `json:"ready"`            // True if the player is ready to start the game; the bots are always ready
 }
 
 // Client acts as an intermediary between the WebSocket connection and the Hub.
@@ -19,11 +27,24 @@ type Client struct {
 
 	Room *Room // The room that the client belongs to
 
-	// WebSocket connection for real-time communication
+	// WebSocket connection for real-time communication (nil for bots)
 	Conn *websocket.Conn
 
-	// Buffered channel for storing received messages before processing
-	ReceivedMessages chan []byte
+	// True if the client negotiated the binary subprotocol for the game messages
+	Binary bool
+
+	// Round-trip time statistics of the connection
+	Latency LatencyStats
+
+	// The presence state of the player, read with Presence and changed with SetPresence
+	presence atomic.Value
+	// Unix time (ms) of the last broadcast of the player's typing indicator
+	lastTypingReport atomic.Int64
+	// True if the player is ready to start the game, read with ReadyToStart and changed with SetReadyToStart
+	ready atomic.Bool
+
+	// Messages waiting to be written to the connection, in priority lanes (see WriteMessage and TakeMessages)
+	queue outboundQueue
 
 	// Channel to confirm client registration
 	Registered chan bool
@@ -35,25 +56,35 @@ type Client struct {
 // - hub: The WebSocket hub managing clients and rooms.
 // - userName: The name of the client/player.
 // - room: The room the client is joining.
-// - conn: WebSocket connection instance for communication.
-// - receivedMessages: (optional) Pre-existing channel for received messages.
+// - conn: WebSocket connection instance for communication (nil for bots).
 // - clientRegistered: (optional) Pre-existing channel to confirm registration.
 //
 // Returns:
 // - A pointer to the created Client instance.
 // - An error if registration fails (e.g., the room does not exist).
-func NewClient(hub *Hub, userName string, room *Room, conn *websocket.Conn, receivedMessages chan []byte, clientRegistered chan bool) (*Client, error) {
+func NewClient(hub *Hub, userName string, room *Room, conn *websocket.Conn, clientRegistered chan bool) (*Client, error) {
+	client := CreateClient(userName, room, conn, clientRegistered)
+	if err := client.Register(hub); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// CreateClient creates a client of the room without registering it, see NewClient for the parameters.
+// The messages written to the client before Register are sent before the messages of the room.
+func CreateClient(userName string, room *Room, conn *websocket.Conn, clientRegistered chan bool) *Client {
 	client := &Client{
 		ClientUser: ClientUser{UserName: userName},
 		Room:       room,
 		Conn:       conn,
+		queue:      newOutboundQueue(),
 	}
-
-	// Initialize ReceivedMessages channel if not provided
-	if receivedMessages == nil {
-		client.ReceivedMessages = make(chan []byte, 256) // Buffered channel with a capacity of 256
+	client.presence.Store(webmodel.PRESENCE_ONLINE)
+	if conn != nil {
+		client.Binary = conn.Subprotocol() == webmodel.BINARY_SUBPROTOCOL
 	} else {
-		client.ReceivedMessages = receivedMessages
+		client.Bot = true
+		client.ready.Store(true)
 	}
 
 	// Initialize Registered channel if not provided
@@ -62,28 +93,117 @@ func NewClient(hub *Hub, userName string, room *Room, conn *websocket.Conn, rece
 	} else {
 		client.Registered = clientRegistered
 	}
+	return client
+}
 
+// Register adds the client to its room in the hub; from then on, the client receives the messages of the room.
+// Returns an error if registration fails (e.g., the room does not exist).
+func (c *Client) Register(hub *Hub) error {
 	// Register the client in the hub
-	hub.RegisterClientToHub(client)
+	hub.RegisterClientToHub(c)
 
 	// Wait for registration confirmation
-	ok := <-client.Registered
+	ok := <-c.Registered
 	if !ok {
-		return nil, fmt.Errorf("cannot create a client: room id '%s' does not exist", room.ID)
+		return fmt.Errorf("cannot create a client: room id '%s' does not exist", c.Room.ID)
 	}
 
 	// Assign a player number based on the room size
-	client.PlayerNumber = client.Room.Size()
-	return client, nil
+	c.PlayerNumber = c.Room.Size()
+	return nil
+}
+
+// User returns the public information about the client, including the connection quality.
+func (c *Client) User() ClientUser {
+	user := c.ClientUser
+	user.RTT = c.Latency.RTT().Milliseconds()
+	user.Jitter = c.Latency.Jitter().Milliseconds()
+	user.Presence = c.Presence()
+	user.Ready = c.ReadyToStart()
+	return user
+}
+
+// ReadyToStart reports whether the player is ready to start the game.
+func (c *Client) ReadyToStart() bool {
+	return c.ready.Load()
+}
+
+// SetReadyToStart marks the player as ready or not ready to start the game. It reports whether the state changed.
+func (c *Client) SetReadyToStart(ready bool) bool {
+	return c.ready.Swap(ready) != ready
+}
+
+// Presence returns the presence state of the client, one of the PRESENCE_ constants of webmodel.
+func (c *Client) Presence() string {
+	presence, _ := c.presence.Load().(string)
+	return presence
+}
+
+// SetPresence changes the presence state of the client. It reports whether the state changed.
+func (c *Client) SetPresence(presence string) bool {
+	return c.presence.Swap(presence) != presence
+}
+
+// TypingReportDue reports whether the typing indicator of the player should be broadcast,
+// i.e. it was not broadcast during the last `period`. Only one caller per period gets true.
+func (c *Client) TypingReportDue(period time.Duration) bool {
+	now := time.Now().UnixMilli()
+	last := c.lastTypingReport.Load()
+	if now-last < period.Milliseconds() {
+		return false
+	}
+	return c.lastTypingReport.CompareAndSwap(last, now)
+}
+
+// ResetTypingReport makes the next typing indicator of the player due at once, after the player stopped typing.
+func (c *Client) ResetTypingReport() {
+	c.lastTypingReport.Store(0)
+}
+
+// WriteMessage adds a message to the client's outbound queue without blocking, in the lane of its type.
+// A full queue is handled by the slow-consumer policy (see outboundQueue.push); if the client
+// is too slow, it is closed with CLOSE_SLOW_CONSUMER.
+// It returns false if the message was not queued because the client is closed.
+func (c *Client) WriteMessage(message []byte) bool {
+	return c.queue.push(message)
+}
+
+// Ready returns a channel signalled when messages are queued for the client or the client is closed.
+func (c *Client) Ready() <-chan struct{} {
+	return c.queue.ready
+}
+
+// TakeMessages removes the queued messages of the client and returns them, the control messages first,
+// then the state updates and the chat messages. It also reports whether the client is closed,
+// in which case the connection must be closed after writing the messages.
+func (c *Client) TakeMessages() ([][]byte, bool) {
+	return c.queue.take()
+}
+
+// Close closes the client, which makes the writer close the connection
+// with the given close code and reason. Only the first call has an effect.
+func (c *Client) Close(code int, reason string) {
+	c.queue.Lock()
+	defer c.queue.Unlock()
+	c.queue.close(code, reason)
+}
+
+// Closed reports whether the client is closed.
+func (c *Client) Closed() bool {
+	c.queue.Lock()
+	defer c.queue.Unlock()
+	return c.queue.closed
 }
 
-// WriteMessage sends a message to the client's message queue.
-func (c *Client) WriteMessage(message []byte) {
-	c.ReceivedMessages <- message
+// CloseReason returns the close code and the reason the client was closed with.
+func (c *Client) CloseReason() (int, string) {
+	c.queue.Lock()
+	defer c.queue.Unlock()
+	return c.queue.closeCode, c.queue.closeReason
 }
 
 // String returns a formatted string representation of the client instance.
 func (c *Client) String() string {
-	return fmt.Sprintf("addr: %p || User:'%s' || connection: %p || channels: clientRegistered %p  |  ReceivedMessages %p",
-		c, c.UserName, c.Conn, c.Registered, c.ReceivedMessages)
+	return fmt.Sprintf("addr: %p || User:'%s' || connection: %p || channels: clientRegistered %p  |  ready %p",
+		c, c.UserName, c.Conn, c.Registered, c.queue.ready)
 }
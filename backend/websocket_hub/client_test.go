@@ -0,0 +1,144 @@
+package websocket_hub
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// broadcastAll broadcasts the messages in the room one by one, waiting for the report of each of them.
+// It returns the number of messages that reached every client of `reached`.
+func broadcastAll(t *testing.T, hub *Hub, room *Room, messages [][]byte, reached []*Client) int {
+	t.Helper()
+	delivered := 0
+	for i, message := range messages {
+		sentTo, ok := WaitSentTo(hub.BroadcastMessageInRoom(message, room), REPORT_WAIT)
+		if !ok {
+			t.Fatalf("broadcast %d was not reported", i)
+		}
+		all := true
+		for _, client := range reached {
+			all = all && sentTo[client.UserName]
+		}
+		if all {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// waitRead waits until `read` counts `want` messages, or fails the test.
+func waitRead(t *testing.T, read *atomic.Int64, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(REPORT_WAIT)
+	for read.Load() < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("the client read %d messages, want %d", read.Load(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStalledClientIsDisconnectedWhileTheOthersReceive(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	room, clients := newTestRoom(t, hub, "room", 3)
+	stalled, others := clients[0], clients[1:]
+
+	// The stalled client never reads its messages, the others read them as fast as possible
+	reads := make([]*atomic.Int64, len(others))
+	for i, client := range others {
+		reads[i] = &atomic.Int64{}
+		go drain(client, 0, reads[i])
+		defer client.Close(CLOSE_SLOW_CONSUMER, "end of the test")
+	}
+
+	// The messages are sent in batches the other clients read before the next one,
+	// while the backlog of the stalled client grows
+	batch := laneCapacities[LANE_CHAT] / 4
+	total := 2 * laneCapacities[LANE_CHAT]
+	for sent := 0; sent < total; sent += batch {
+		messages := make([][]byte, batch)
+		for i := range messages {
+			messages[i] = testMessage(t, webmodel.InputChatMessage, sent+i)
+		}
+		if delivered := broadcastAll(t, hub, room, messages, others); delivered != batch {
+			t.Fatalf("%d of %d messages reached the other clients", delivered, batch)
+		}
+		for i := range others {
+			waitRead(t, reads[i], int64(sent+batch))
+		}
+	}
+
+	if !stalled.Closed() {
+		t.Fatal("the stalled client is not disconnected")
+	}
+	if code, _ := stalled.CloseReason(); code != CLOSE_SLOW_CONSUMER {
+		t.Errorf("got close code %d, want CLOSE_SLOW_CONSUMER", code)
+	}
+	for _, client := range others {
+		if client.Closed() {
+			t.Errorf("client '%s' reading its messages is disconnected", client.UserName)
+		}
+	}
+}
+
+func TestStalledClientGetsTheLastStateUpdateOnly(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	room, clients := newTestRoom(t, hub, "room", 2)
+	stalled, other := clients[0], clients[1]
+
+	var read atomic.Int64
+	go drain(other, 0, &read)
+	defer other.Close(CLOSE_SLOW_CONSUMER, "end of the test")
+
+	total := 10 * laneCapacities[LANE_STATE]
+	messages := make([][]byte, total)
+	for i := range messages {
+		messages[i] = testMessage(t, webmodel.StateUpdate, i)
+	}
+	if delivered := broadcastAll(t, hub, room, messages, clients); delivered != total {
+		t.Errorf("%d of %d state updates were queued for both clients", delivered, total)
+	}
+	waitRead(t, &read, 1)
+
+	// The stalled client is downgraded to the latest state instead of being disconnected
+	queued, closed := stalled.TakeMessages()
+	if closed {
+		t.Fatal("the client lagging on state updates is disconnected")
+	}
+	if len(queued) != 1 || string(queued[0]) != string(messages[total-1]) {
+		t.Errorf("got %d queued messages %s, want the last state update only", len(queued), queued)
+	}
+	if other.Closed() {
+		t.Error("the client reading its messages is disconnected")
+	}
+}
+
+func TestMessagesWrittenBeforeRegisterComeFirst(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	room, _ := newTestRoom(t, hub, "room", 1)
+
+	client := CreateClient("player-2", room, nil, nil)
+	hello := testMessage(t, webmodel.Hello, 0)
+	client.WriteMessage(hello)
+	if err := client.Register(hub); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	roster := testMessage(t, webmodel.RegisterNewPlayer, 1)
+	if _, ok := WaitSentTo(hub.BroadcastMessageInRoom(roster, room), REPORT_WAIT); !ok {
+		t.Fatal("the broadcast was not reported")
+	}
+
+	messages, _ := client.TakeMessages()
+	if len(messages) != 2 || string(messages[0]) != string(hello) {
+		t.Errorf("got messages %s, want the hello first", messages)
+	}
+	if client.PlayerNumber != 2 {
+		t.Errorf("got player number %d, want 2", client.PlayerNumber)
+	}
+}
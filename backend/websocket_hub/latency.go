@@ -0,0 +1,94 @@
+package websocket_hub
+
+import (
+	"sync"
+	"time"
+)
+
+// Constants controlling the smoothing of the round-trip time statistics (as in RFC 6298 and RFC 3550).
+const (
+	RTT_SMOOTHING     = 8  // A new sample changes the average round-trip time by 1/8 of the difference.
+	JITTER_SMOOTHING  = 16 // A new sample changes the jitter by 1/16 of the difference.
+	MAX_PENDING_PINGS = 8  // The oldest unanswered ping is forgotten when a new one is sent.
+)
+
+// LatencyStats keeps the round-trip time statistics of a client connection.
+// It is safe for concurrent use.
+type LatencyStats struct {
+	sync.Mutex
+	rtt        time.Duration // Rolling average of the round-trip time.
+	jitter     time.Duration // Rolling average of the variation between consecutive samples.
+	lastSample time.Duration // The previous sample, used to compute the jitter.
+	samples    int           // Number of samples received.
+
+	// The send time of the unanswered pings by nonce, kept on the server so a client can't fake its round-trip time
+	pending   map[uint64]time.Time
+	lastNonce uint64
+}
+
+// StartPing records the send time of a ping and returns the nonce the client must echo in its reply.
+func (l *LatencyStats) StartPing() uint64 {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.pending == nil {
+		l.pending = make(map[uint64]time.Time, MAX_PENDING_PINGS)
+	}
+	l.lastNonce++
+	delete(l.pending, l.lastNonce-MAX_PENDING_PINGS)
+	l.pending[l.lastNonce] = time.Now()
+	return l.lastNonce
+}
+
+// CompletePing adds the round-trip time of the ping with the given nonce to the statistics.
+// It returns false if there is no unanswered ping with this nonce.
+func (l *LatencyStats) CompletePing(nonce uint64) bool {
+	l.Lock()
+	sentAt, ok := l.pending[nonce]
+	delete(l.pending, nonce)
+	l.Unlock()
+
+	if ok {
+		l.AddSample(time.Since(sentAt))
+	}
+	return ok
+}
+
+// AddSample adds a measured round-trip time to the statistics.
+func (l *LatencyStats) AddSample(rtt time.Duration) {
+	if rtt < 0 {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.samples == 0 {
+		// The first sample is taken as is.
+		l.rtt = rtt
+	} else {
+		l.rtt += (rtt - l.rtt) / RTT_SMOOTHING
+
+		variation := rtt - l.lastSample
+		if variation < 0 {
+			variation = -variation
+		}
+		l.jitter += (variation - l.jitter) / JITTER_SMOOTHING
+	}
+	l.lastSample = rtt
+	l.samples++
+}
+
+// RTT returns the rolling average of the round-trip time, or 0 if nothing was measured yet.
+func (l *LatencyStats) RTT() time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	return l.rtt
+}
+
+// Jitter returns the rolling average of the round-trip time variation.
+func (l *LatencyStats) Jitter() time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	return l.jitter
+}
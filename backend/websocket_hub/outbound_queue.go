@@ -0,0 +1,167 @@
+package websocket_hub
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// Close codes sent to the clients disconnected by the server (the 4000-4999 range is for applications).
+const (
+	CLOSE_SLOW_CONSUMER = 4001 // The client did not read its messages fast enough.
+)
+
+// Lane is a priority class of the messages waiting to be written to a client.
+// The lanes are written in their order, so a lane is never delayed by a backlog in the next ones.
+type Lane int
+
+// The priority lanes of the outbound queue.
+const (
+	LANE_CONTROL Lane = iota // Control and game-critical messages (startGame, rosters, bombs, ...): never dropped.
+	LANE_STATE               // State updates and latency reports: superseded by the newer ones, dropped when stale.
+	LANE_CHAT                // Chat messages: never dropped.
+	LANES_COUNT
+)
+
+// laneCapacities are the numbers of messages a lane holds. When a lane other than LANE_STATE
+// is full, the client is too slow and is disconnected (see outboundQueue.push).
+var laneCapacities = [LANES_COUNT]int{
+	LANE_CONTROL: 256,
+	LANE_STATE:   16,
+	LANE_CHAT:    256,
+}
+
+// messageLanes maps the message types to their lanes; the other types go to LANE_CONTROL.
+var messageLanes = map[string]Lane{
+	webmodel.StateUpdate:       LANE_STATE,
+	webmodel.RoomLatency:       LANE_STATE,
+	webmodel.Ping:              LANE_STATE,
+	webmodel.InputChatMessage:  LANE_CHAT,
+	webmodel.SendMessageToChat: LANE_CHAT,
+}
+
+// jsonTypePrefix is the beginning of every JSON message created by webmodel.CreateJSONMessage.
+var jsonTypePrefix = []byte(`{"type":"`)
+
+// messageType returns the type of a queued message without decoding it,
+// or an empty string if the type is unknown.
+func messageType(message []byte) string {
+	if webmodel.IsBinaryMessage(message) {
+		if message[0] == webmodel.BINARY_STATE_UPDATE {
+			return webmodel.StateUpdate
+		}
+		return ""
+	}
+
+	if !bytes.HasPrefix(message, jsonTypePrefix) {
+		return ""
+	}
+	rest := message[len(jsonTypePrefix):]
+	end := bytes.IndexByte(rest, '"')
+	if end < 0 {
+		return ""
+	}
+	return string(rest[:end])
+}
+
+// LaneOf returns the priority lane of a message.
+func LaneOf(message []byte) Lane {
+	return messageLanes[messageType(message)] // LANE_CONTROL is the zero value
+}
+
+// outboundQueue holds the messages waiting to be written to a client, in priority lanes.
+// It is safe for concurrent use; it is closed once, with the close code and reason
+// the connection is closed with.
+type outboundQueue struct {
+	sync.Mutex
+	lanes       [LANES_COUNT][][]byte
+	ready       chan struct{} // Signalled when messages are queued or the queue is closed
+	closed      bool          // True once the queue is closed
+	closeCode   int           // WebSocket close code sent to the client when the connection is closed
+	closeReason string        // Reason sent with the close code
+}
+
+// newOutboundQueue creates an empty queue.
+func newOutboundQueue() outboundQueue {
+	return outboundQueue{ready: make(chan struct{}, 1)}
+}
+
+/*
+push adds a message to its lane, applying the slow-consumer policy:
+  - a state update supersedes the state updates already queued, since it contains all the changes
+    since the tick acknowledged by the client;
+  - when LANE_STATE is full, its oldest message is dropped;
+  - when another lane is full, the queue is closed with CLOSE_SLOW_CONSUMER.
+
+It returns false if the message was not queued because the queue is closed.
+*/
+func (q *outboundQueue) push(message []byte) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.closed {
+		return false
+	}
+
+	lane := LaneOf(message)
+	queued := q.lanes[lane]
+	if messageType(message) == webmodel.StateUpdate {
+		queued = withoutStateUpdates(queued)
+	}
+
+	if len(queued) >= laneCapacities[lane] {
+		if lane != LANE_STATE {
+			q.close(CLOSE_SLOW_CONSUMER, "slow consumer: the message queue is full")
+			return false
+		}
+		queued = queued[1:] // drop the oldest one
+	}
+
+	q.lanes[lane] = append(queued, message)
+	q.signal()
+	return true
+}
+
+// take removes all queued messages and returns them in priority order, and whether the queue is closed.
+func (q *outboundQueue) take() ([][]byte, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	var messages [][]byte
+	for lane := range q.lanes {
+		messages = append(messages, q.lanes[lane]...)
+		q.lanes[lane] = nil
+	}
+	return messages, q.closed
+}
+
+// close closes the queue once. It must be called with the queue locked.
+func (q *outboundQueue) close(code int, reason string) {
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.closeCode = code
+	q.closeReason = reason
+	q.signal()
+}
+
+// signal wakes up the writer of the queue, if it is not woken up already.
+func (q *outboundQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// withoutStateUpdates removes the state updates from the queued messages.
+func withoutStateUpdates(queued [][]byte) [][]byte {
+	kept := queued[:0]
+	for _, m := range queued {
+		if messageType(m) != webmodel.StateUpdate {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
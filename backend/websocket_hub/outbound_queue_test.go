@@ -0,0 +1,108 @@
+package websocket_hub
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// testMessage creates a JSON message of the given type, numbered to tell the messages apart.
+func testMessage(tb testing.TB, messageType string, number int) []byte {
+	tb.Helper()
+	message, err := webmodel.CreateJSONMessage(messageType, webmodel.SUCCESS_RESULT, number)
+	if err != nil {
+		tb.Fatalf("CreateJSONMessage: %v", err)
+	}
+	return message
+}
+
+func TestOutboundQueueWritesLanesInPriorityOrder(t *testing.T) {
+	q := newOutboundQueue()
+	chat := testMessage(t, webmodel.InputChatMessage, 1)
+	state := testMessage(t, webmodel.RoomLatency, 2)
+	control := testMessage(t, webmodel.PlayerAction, 3)
+	for _, message := range [][]byte{chat, state, control} {
+		if !q.push(message) {
+			t.Fatalf("message %s was not queued", message)
+		}
+	}
+
+	messages, closed := q.take()
+	if closed {
+		t.Fatal("the queue is closed")
+	}
+	want := [][]byte{control, state, chat}
+	if fmt.Sprintf("%s", messages) != fmt.Sprintf("%s", want) {
+		t.Errorf("got messages %s, want %s", messages, want)
+	}
+	if messages, _ := q.take(); len(messages) != 0 {
+		t.Errorf("the queue still holds %d messages after take", len(messages))
+	}
+}
+
+func TestOutboundQueueKeepsTheLastStateUpdate(t *testing.T) {
+	q := newOutboundQueue()
+	chat := testMessage(t, webmodel.InputChatMessage, 0)
+	q.push(chat)
+	var last []byte
+	for i := 1; i <= 3*laneCapacities[LANE_STATE]; i++ {
+		last = testMessage(t, webmodel.StateUpdate, i)
+		if !q.push(last) {
+			t.Fatalf("state update %d was not queued", i)
+		}
+	}
+
+	messages, closed := q.take()
+	if closed {
+		t.Fatal("the queue of a client lagging on state updates is closed")
+	}
+	want := [][]byte{last, chat}
+	if fmt.Sprintf("%s", messages) != fmt.Sprintf("%s", want) {
+		t.Errorf("got messages %s, want %s", messages, want)
+	}
+}
+
+func TestOutboundQueueDropsTheOldestMessagesOfTheStateLane(t *testing.T) {
+	q := newOutboundQueue()
+	total := laneCapacities[LANE_STATE] + 5
+	for i := 0; i < total; i++ {
+		if !q.push(testMessage(t, webmodel.RoomLatency, i)) {
+			t.Fatalf("latency report %d was not queued", i)
+		}
+	}
+
+	messages, closed := q.take()
+	if closed {
+		t.Fatal("the queue is closed")
+	}
+	if len(messages) != laneCapacities[LANE_STATE] {
+		t.Fatalf("got %d messages, want %d", len(messages), laneCapacities[LANE_STATE])
+	}
+	if first := testMessage(t, webmodel.RoomLatency, total-laneCapacities[LANE_STATE]); string(messages[0]) != string(first) {
+		t.Errorf("got first message %s, want %s", messages[0], first)
+	}
+}
+
+func TestOutboundQueueClosesWhenALaneIsFull(t *testing.T) {
+	for _, messageType := range []string{webmodel.PlayerAction, webmodel.InputChatMessage} {
+		t.Run(messageType, func(t *testing.T) {
+			q := newOutboundQueue()
+			lane := LaneOf(testMessage(t, messageType, 0))
+			for i := 0; i < laneCapacities[lane]; i++ {
+				if !q.push(testMessage(t, messageType, i)) {
+					t.Fatalf("message %d was not queued", i)
+				}
+			}
+			if q.push(testMessage(t, messageType, laneCapacities[lane])) {
+				t.Error("a message was queued in a full lane")
+			}
+			if !q.closed || q.closeCode != CLOSE_SLOW_CONSUMER {
+				t.Errorf("got closed %t with code %d, want closed with CLOSE_SLOW_CONSUMER", q.closed, q.closeCode)
+			}
+			if q.push(testMessage(t, webmodel.PlayerAction, 0)) {
+				t.Error("a message was queued after the queue was closed")
+			}
+		})
+	}
+}
@@ -3,6 +3,11 @@ package websocket_hub
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/gamerules"
+	"github.com/Pomog/bomberman/backend/gamestate"
 )
 
 // SafeClientsMap is a thread-safe map for storing active clients in a room.
@@ -21,10 +26,25 @@ func NewSafeClientsMap() *SafeClientsMap {
 
 // Room represents a chat or game session where multiple clients (users) interact.
 type Room struct {
-	ID         string          `json:"id"` // Unique room identifier
-	Clients    *SafeClientsMap `json:"-"`  // Connected clients
-	Registered chan bool       // Channel for room registration confirmation
-	GameMap    string          // Random string representing the game map (generated externally)
+	ID         string           `json:"id"` // Unique room identifier
+	Clients    *SafeClientsMap  `json:"-"`  // Connected clients
+	Registered chan bool        // Channel for room registration confirmation
+	State      *gamestate.State `json:"-"` // Authoritative state of the game, sent to clients as delta snapshots
+
+	lastLatencyReport atomic.Int64 // Unix time (ms) of the last broadcast of the players' latency
+
+	lobbyMutex sync.Mutex
+	host       *Client             // The player who changes the lobby settings and moderates the room, see Host
+	rules      gamerules.GameRules // The rules of the game, from a preset changed by the host before the start
+	gameMap    string              // Random string representing the game map (generated externally), see mapgen
+
+	countdownMutex sync.Mutex
+	countdown      *time.Timer // The countdown to the start of the game, nil if it is not running
+	countdownEnd   time.Time   // The time the game starts at, zero if there is no countdown
+
+	broadcast chan *message // Queue of the messages to broadcast to the room members
+	stopped   chan struct{} // Closed when the room is unregistered, to stop the broadcaster
+	stopMutex sync.RWMutex  // Held to close `stopped`, and read to queue a message
 }
 
 // SafeRoomsMap is a thread-safe map for managing multiple rooms.
@@ -70,6 +90,7 @@ func (sm *SafeClientsMap) Delete(key string) {
 }
 
 // RRange iterates over all clients in the room, applying a given function.
+// The map is read-locked during the iteration, so the function must not lock it again (see Values).
 func (sm *SafeClientsMap) RRange(act func(key string, value *Client)) {
 	sm.RLock()
 	defer sm.RUnlock()
@@ -78,6 +99,19 @@ func (sm *SafeClientsMap) RRange(act func(key string, value *Client)) {
 	}
 }
 
+// Values returns the clients of the room at the time of the call. Unlike RRange, it doesn't hold the lock
+// of the map while the clients are handled, so they can be sent to the room (see Hub.BroadcastMessageInRoom),
+// which reads the map again: a nested read lock would deadlock with a pending writer.
+func (sm *SafeClientsMap) Values() []*Client {
+	sm.RLock()
+	defer sm.RUnlock()
+	clients := make([]*Client, 0, len(sm.items))
+	for _, value := range sm.items {
+		clients = append(clients, value)
+	}
+	return clients
+}
+
 // Set adds or updates a room in SafeRoomsMap.
 func (sm *SafeRoomsMap) Set(key string, value *Room) {
 	sm.Lock()
@@ -132,6 +166,10 @@ func createRoom(hub *Hub, ID string) *Room {
 		ID:         ID,
 		Clients:    NewSafeClientsMap(),
 		Registered: make(chan bool),
+		State:      gamestate.New(),
+		rules:      gamerules.CLASSIC,
+		broadcast:  make(chan *message, ROOM_QUEUE_SIZE),
+		stopped:    make(chan struct{}),
 	}
 }
 
@@ -156,7 +194,7 @@ func (r *Room) GetUsersInRoom() []ClientUser {
 	users := make([]ClientUser, len(r.Clients.items))
 	i := 0
 	for _, client := range r.Clients.items {
-		users[i] = client.ClientUser
+		users[i] = client.User()
 		i++
 	}
 	return users
@@ -180,6 +218,166 @@ func (r *Room) ContainsUser(UserName string) bool {
 	return false
 }
 
+// LatencyReportDue reports whether the players' latency should be broadcast in the room,
+// i.e. it was not broadcast during the last `period`. Only one caller per period gets true.
+func (r *Room) LatencyReportDue(period time.Duration) bool {
+	now := time.Now().UnixMilli()
+	last := r.lastLatencyReport.Load()
+	if now-last < period.Milliseconds() {
+		return false
+	}
+	return r.lastLatencyReport.CompareAndSwap(last, now)
+}
+
+// HasHumans reports whether there is at least one player in the room who is not a bot.
+func (r *Room) HasHumans() bool {
+	r.Clients.RLock()
+	defer r.Clients.RUnlock()
+
+	for _, client := range r.Clients.items {
+		if !client.Bot {
+			return true
+		}
+	}
+	return false
+}
+
+// Host returns the host of the room, who changes the lobby settings and moderates the room.
+// The host is elected when a player joins or leaves the room (see ElectHost); reading it never changes it.
+// Returns nil if no host was elected, e.g. there is no human in the room.
+func (r *Room) Host() *Client {
+	r.lobbyMutex.Lock()
+	defer r.lobbyMutex.Unlock()
+	return r.host
+}
+
+/*
+ElectHost makes the first human of the room who joined its host, if the room has no host or the host left:
+the host role is transferred to the human with the lowest player number.
+
+Returns:
+  - the host of the room, nil if there is no human in the room;
+  - true if the host changed.
+*/
+func (r *Room) ElectHost() (*Client, bool) {
+	r.lobbyMutex.Lock()
+	defer r.lobbyMutex.Unlock()
+
+	if r.host != nil {
+		if client, ok := r.Clients.Get(r.host.UserName); ok && client == r.host {
+			return r.host, false
+		}
+	}
+
+	r.Clients.RLock()
+	var host *Client
+	for _, client := range r.Clients.items {
+		if !client.Bot && (host == nil || client.PlayerNumber < host.PlayerNumber) {
+			host = client
+		}
+	}
+	r.Clients.RUnlock()
+
+	changed := host != r.host
+	r.host = host
+	return host, changed
+}
+
+// Rules returns the game rules of the room, gamerules.CLASSIC until they are set.
+func (r *Room) Rules() gamerules.GameRules {
+	r.lobbyMutex.Lock()
+	defer r.lobbyMutex.Unlock()
+	return r.rules
+}
+
+// GameMap returns the map of the room, empty until it is set.
+func (r *Room) GameMap() string {
+	r.lobbyMutex.Lock()
+	defer r.lobbyMutex.Unlock()
+	return r.gameMap
+}
+
+/*
+SetGame gives the room new game rules, which must be validated already, and the map generated with them,
+unless the countdown to the start of the game started or the game runs.
+The check and the change are done under the lock of the countdown, so the countdown can't start in between.
+
+Returns false if the game of the room can't change anymore.
+*/
+func (r *Room) SetGame(rules gamerules.GameRules, gameMap string) bool {
+	r.countdownMutex.Lock()
+	defer r.countdownMutex.Unlock()
+
+	if !r.countdownEnd.IsZero() || r.State.Running() {
+		return false
+	}
+	r.lobbyMutex.Lock()
+	r.rules = rules
+	r.gameMap = gameMap
+	r.lobbyMutex.Unlock()
+	r.State.SetMap(gameMap)
+	return true
+}
+
+// ReadyPlayers returns the number of the players ready to start the game and the number of the human players.
+func (r *Room) ReadyPlayers() (ready int, humans int) {
+	r.Clients.RLock()
+	defer r.Clients.RUnlock()
+
+	for _, client := range r.Clients.items {
+		if client.Bot {
+			continue
+		}
+		humans++
+		if client.ReadyToStart() {
+			ready++
+		}
+	}
+	return ready, humans
+}
+
+// StartCountdown starts the countdown to the start of the game; `onEnd` is called when it ends.
+// It returns the time the game starts at, and false if the countdown is already running or ended.
+func (r *Room) StartCountdown(duration time.Duration, onEnd func()) (time.Time, bool) {
+	r.countdownMutex.Lock()
+	defer r.countdownMutex.Unlock()
+
+	if !r.countdownEnd.IsZero() {
+		return r.countdownEnd, false
+	}
+	r.countdownEnd = time.Now().Add(duration)
+	r.countdown = time.AfterFunc(duration, onEnd)
+	return r.countdownEnd, true
+}
+
+// CancelCountdown stops the countdown to the start of the game.
+// It returns false if the countdown is not running, or if it ended already.
+func (r *Room) CancelCountdown() bool {
+	r.countdownMutex.Lock()
+	defer r.countdownMutex.Unlock()
+
+	if r.countdown == nil || !r.countdown.Stop() {
+		return false
+	}
+	r.countdown = nil
+	r.countdownEnd = time.Time{}
+	return true
+}
+
+// CountdownEnd returns the time the game starts at, and false if the countdown is not running and didn't end.
+func (r *Room) CountdownEnd() (time.Time, bool) {
+	r.countdownMutex.Lock()
+	defer r.countdownMutex.Unlock()
+
+	return r.countdownEnd, !r.countdownEnd.IsZero()
+}
+
+// Starting reports whether the countdown to the start of the game ended, the players can't change their mind anymore.
+func (r *Room) Starting() bool {
+	end, ok := r.CountdownEnd()
+	return ok && !time.Now().Before(end)
+}
+
 // String returns a string representation of the room.
 func (r *Room) String() string {
 	return fmt.Sprintf("id: %s", r.ID)
@@ -0,0 +1,101 @@
+package websocket_hub
+
+// ROOM_QUEUE_SIZE is the number of messages waiting to be broadcast in a room,
+// above which the new messages are dropped instead of blocking their senders.
+const ROOM_QUEUE_SIZE = 256
+
+// runBroadcaster sends the queued messages to the room members until the room is unregistered.
+// Every room has its own broadcaster, so the rooms don't wait for each other.
+// The messages still queued when the room is unregistered are reported as not reached.
+func (r *Room) runBroadcaster() {
+	for {
+		select {
+		case <-r.stopped:
+			r.discardQueue()
+			return
+		case message := <-r.broadcast:
+			// The room may be stopped while the message was waiting in the queue
+			if r.isStopped() {
+				message.sentTo <- r.notReached(message)
+				continue
+			}
+			message.sentTo <- r.broadcastMessage(message)
+		}
+	}
+}
+
+// discardQueue empties the queue of a stopped room, marking the recipients of its messages as not reached,
+// so nobody waits for their report forever. No message is queued once the room is stopped (see queueMessage).
+func (r *Room) discardQueue() {
+	for {
+		select {
+		case message := <-r.broadcast:
+			message.sentTo <- r.notReached(message)
+		default:
+			return
+		}
+	}
+}
+
+// broadcastMessage sends a message to its recipients in the room, all clients by default.
+// The slow clients are handled by the slow-consumer policy of Client.WriteMessage.
+// It returns the map of users who received the message.
+func (r *Room) broadcastMessage(message *message) map[string]bool {
+	usersSentTo := make(map[string]bool)
+	r.Clients.RRange(func(userName string, client *Client) {
+		if message.recipients == nil || message.recipients[userName] {
+			usersSentTo[userName] = client.WriteMessage(message.content)
+		}
+	})
+	return usersSentTo
+}
+
+// queueMessage adds a message to the broadcast queue of the room without blocking.
+// It returns false if the room is unregistered or its queue is full.
+func (r *Room) queueMessage(message *message) bool {
+	// The room can't be stopped while the message is queued, so the broadcaster finds it when discarding the queue
+	r.stopMutex.RLock()
+	defer r.stopMutex.RUnlock()
+
+	if r.isStopped() {
+		return false
+	}
+	select {
+	case r.broadcast <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopBroadcaster stops the broadcaster of the room; the queued messages are discarded
+// and their recipients are marked as not reached.
+func (r *Room) stopBroadcaster() {
+	r.stopMutex.Lock()
+	defer r.stopMutex.Unlock()
+
+	if !r.isStopped() {
+		close(r.stopped)
+	}
+}
+
+// isStopped reports whether the room is unregistered and its broadcaster is stopped.
+func (r *Room) isStopped() bool {
+	select {
+	case <-r.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// notReached returns the map of the recipients of a message in the room, all marked as not having received it.
+func (r *Room) notReached(message *message) map[string]bool {
+	usersSentTo := make(map[string]bool)
+	r.Clients.RRange(func(userName string, _ *Client) {
+		if message.recipients == nil || message.recipients[userName] {
+			usersSentTo[userName] = false
+		}
+	})
+	return usersSentTo
+}
@@ -3,24 +3,25 @@ package websocket_hub
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
-// UNIVERSAL_ROOM_ID is a default room identifier, potentially for a global chat room.
+// UNIVERSAL_ROOM_ID identifies the global chat channel, which reaches the clients of all rooms
+// (see BroadcastMessageToAllRooms). No room can be registered with this ID.
 const (
 	UNIVERSAL_ROOM_ID = "UniversalRoom"
 )
 
 // Hub is responsible for managing active WebSocket clients and rooms.
+// It only handles the membership; the messages are broadcast by the rooms themselves,
+// so a busy room doesn't slow down the others.
 type Hub struct {
 	// Rooms stores all registered chat rooms in a thread-safe map.
 	Rooms *SafeRoomsMap
 
-	// Channel for broadcasting messages to all clients in a room.
-	broadcast chan *message
-
 	// Channels for registering and unregistering clients dynamically.
 	clientRegister   chan *Client
-	clientUnregister chan *Client
+	clientUnregister chan *unregistration
 
 	// Channels for registering and unregistering rooms dynamically.
 	roomRegister   chan *Room
@@ -30,10 +31,9 @@ type Hub struct {
 // NewHub initializes a new Hub instance with required communication channels.
 func NewHub() *Hub {
 	return &Hub{
-		broadcast:        make(chan *message),
 		Rooms:            NewSafeRoomsMap(),
 		clientRegister:   make(chan *Client),
-		clientUnregister: make(chan *Client),
+		clientUnregister: make(chan *unregistration),
 		roomRegister:     make(chan *Room),
 		roomUnregister:   make(chan *Room),
 	}
@@ -41,9 +41,15 @@ func NewHub() *Hub {
 
 // message represents a WebSocket message that will be broadcasted.
 type message struct {
-	content json.RawMessage      // Raw JSON data of the message.
-	room    *Room                // The target room for the message.
-	sentTo  chan map[string]bool // Map of users who successfully received the message.
+	content    json.RawMessage      // Raw JSON data of the message.
+	recipients map[string]bool      // The users the message is for; nil for all the room members.
+	sentTo     chan map[string]bool // Map of users who successfully received the message, buffered so the broadcaster never waits.
+}
+
+// unregistration is a request to remove a client from its room.
+type unregistration struct {
+	client *Client
+	done   chan struct{} // Closed once the client is removed, so no broadcast reaches it anymore.
 }
 
 // Run starts the Hub event loop, continuously processing incoming requests.
@@ -51,9 +57,10 @@ func (h *Hub) Run() {
 	for {
 		select {
 		case room := <-h.roomRegister:
-			// If the room does not exist, register it.
-			if !h.isThereRoom(room) {
+			// If the room does not exist, register it and start its broadcaster.
+			if !h.isThereRoom(room) && room.ID != UNIVERSAL_ROOM_ID {
 				h.Rooms.Set(room.ID, room)
+				go room.runBroadcaster()
 				room.Registered <- true
 			} else {
 				fmt.Printf("Room ID %s is already registered\n", room.ID)
@@ -61,9 +68,10 @@ func (h *Hub) Run() {
 			}
 
 		case room := <-h.roomUnregister:
-			// If the room exists, remove it from the Hub.
+			// If the room exists, remove it from the Hub and stop its broadcaster.
 			if h.isThereRoom(room) {
 				h.Rooms.Delete(room.ID)
+				room.stopBroadcaster()
 			}
 
 		case client := <-h.clientRegister:
@@ -75,56 +83,34 @@ func (h *Hub) Run() {
 				client.Registered <- false
 			}
 
-		case client := <-h.clientUnregister:
+		case request := <-h.clientUnregister:
 			// Remove the client from their room and update player numbers.
-			if h.isThereRoom(client.Room) {
-				deletedNumber := client.ClientUser.PlayerNumber
-				if client.Room.isThereClient(client) {
-					client.Room.DeleteClient(client)
-					// TODO: Notify remaining clients that a user has left.
-				}
-
-				// Adjust player numbers after a client leaves.
-				for _, cl := range client.Room.Clients.items {
-					if cl.ClientUser.PlayerNumber > deletedNumber {
-						cl.ClientUser.PlayerNumber--
-					}
-				}
+			// The room may be unregistered already: the bots leave it after the last human.
+			client := request.client
+			deletedNumber := client.ClientUser.PlayerNumber
+			if client.Room.isThereClient(client) {
+				client.Room.DeleteClient(client)
+				// TODO: Notify remaining clients that a user has left.
 			}
 
-		case message := <-h.broadcast:
-			// Broadcast message to all clients in the specified room.
-			if h.isThereRoom(message.room) {
-				usersSentTo := make(map[string]bool)
-				for _, client := range message.room.Clients.items {
-					usersSentTo[client.UserName] = sendMessageToClient(message.content, client)
+			// Adjust player numbers after a client leaves.
+			client.Room.Clients.RRange(func(_ string, cl *Client) {
+				if cl.ClientUser.PlayerNumber > deletedNumber {
+					cl.ClientUser.PlayerNumber--
 				}
-				message.sentTo <- usersSentTo
-			}
+			})
+			close(request.done)
 		}
 	}
 }
 
-// sendMessageToClient attempts to send a message to a client and removes inactive ones.
-func sendMessageToClient(messageContent json.RawMessage, client *Client) bool {
-	select {
-	case client.ReceivedMessages <- messageContent:
-		// Successfully sent the message.
-		return true
-	default:
-		// Client’s message buffer is full; assume disconnection.
-		close(client.ReceivedMessages)
-		client.Room.DeleteClient(client)
-		return false
-	}
-}
-
 // RegisterRoomToHub registers a room in the Hub.
 func (h *Hub) RegisterRoomToHub(r *Room) {
 	h.roomRegister <- r
 }
 
-// UnRegisterRoomFromHub removes a room from the Hub.
+// UnRegisterRoomFromHub removes a room from the Hub and stops its broadcaster.
+// The messages sent to the room afterwards are dropped.
 func (h *Hub) UnRegisterRoomFromHub(r *Room) {
 	h.roomUnregister <- r
 }
@@ -135,8 +121,12 @@ func (h *Hub) RegisterClientToHub(c *Client) {
 }
 
 // UnRegisterClientFromHub removes a client from the Hub.
+// It returns once the client is removed from its room, so the room's broadcaster
+// doesn't send to the client anymore and its message channel can be closed.
 func (h *Hub) UnRegisterClientFromHub(c *Client) {
-	h.clientUnregister <- c
+	request := &unregistration{client: c, done: make(chan struct{})}
+	h.clientUnregister <- request
+	<-request.done
 }
 
 // isThereRoom checks if a room exists in the Hub.
@@ -153,14 +143,58 @@ func (h *Hub) GetRoom(id string) (*Room, bool) {
 	return room, ok
 }
 
-// BroadcastMessageInRoom sends a message to all clients in a specific room.
-func (h *Hub) BroadcastMessageInRoom(content json.RawMessage, room *Room) map[string]bool {
+// BroadcastMessageInRoom queues a message for all clients in a specific room and returns immediately.
+// The returned channel receives the map of users who received the message once it is broadcast;
+// the callers who don't need it can ignore it. If the room's queue is full, the message is dropped
+// and the map marks all users as not reached.
+func (h *Hub) BroadcastMessageInRoom(content json.RawMessage, room *Room) <-chan map[string]bool {
+	return h.SendMessageToUsersInRoom(content, room, nil)
+}
+
+// SendMessageToUsersInRoom queues a message for some clients of a room, in order with the broadcasts of the room,
+// and returns immediately. A nil `userNames` means all the room members.
+// The returned channel receives the map of the recipients, as for BroadcastMessageInRoom.
+func (h *Hub) SendMessageToUsersInRoom(content json.RawMessage, room *Room, userNames []string) <-chan map[string]bool {
 	message := &message{
 		content: content,
-		room:    room,
-		sentTo:  make(chan map[string]bool),
+		sentTo:  make(chan map[string]bool, 1),
+	}
+	if userNames != nil {
+		message.recipients = make(map[string]bool, len(userNames))
+		for _, userName := range userNames {
+			message.recipients[userName] = true
+		}
 	}
 
-	h.broadcast <- message
-	return <-message.sentTo
+	if !room.queueMessage(message) {
+		message.sentTo <- room.notReached(message)
+	}
+	return message.sentTo
+}
+
+// BroadcastMessageToAllRooms queues a message for the clients of all rooms: the global chat channel.
+// It doesn't wait for the rooms to broadcast it, and returns the number of rooms the message was queued in;
+// the message is dropped in the rooms whose queue is full.
+func (h *Hub) BroadcastMessageToAllRooms(content json.RawMessage) int {
+	queued := 0
+	h.Rooms.RRange(func(_ string, room *Room) {
+		if room.queueMessage(&message{content: content, sentTo: make(chan map[string]bool, 1)}) {
+			queued++
+		}
+	})
+	return queued
+}
+
+// WaitSentTo waits at most `timeout` for the map of the users who received a queued message,
+// e.g. the report of BroadcastMessageInRoom. It returns false if the message was not broadcast in time.
+func WaitSentTo(sentTo <-chan map[string]bool, timeout time.Duration) (map[string]bool, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case usersSentTo := <-sentTo:
+		return usersSentTo, true
+	case <-timer.C:
+		return nil, false
+	}
 }
@@ -0,0 +1,232 @@
+package websocket_hub
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Pomog/bomberman/backend/gamerules"
+	"github.com/Pomog/bomberman/backend/webmodel"
+)
+
+// REPORT_WAIT is the time a test waits for the report of a broadcast.
+const REPORT_WAIT = 5 * time.Second
+
+// newTestRoom registers a room with `clients` clients without a socket, named player-1, player-2...
+func newTestRoom(tb testing.TB, hub *Hub, id string, clients int) (*Room, []*Client) {
+	tb.Helper()
+	room, ok := NewRoom(hub, id)
+	if !ok {
+		tb.Fatalf("cannot register room '%s'", id)
+	}
+	var roomClients []*Client
+	for i := 1; i <= clients; i++ {
+		client, err := NewClient(hub, fmt.Sprintf("player-%d", i), room, nil, nil)
+		if err != nil {
+			tb.Fatalf("NewClient: %v", err)
+		}
+		roomClients = append(roomClients, client)
+	}
+	return room, roomClients
+}
+
+// drain reads the messages of the client like WritePump, taking `delay` per message, until the client is closed.
+// Every message read is counted in `read`, if not nil.
+func drain(client *Client, delay time.Duration, read *atomic.Int64) {
+	for range client.Ready() {
+		messages, closed := client.TakeMessages()
+		time.Sleep(delay * time.Duration(len(messages)))
+		if read != nil {
+			read.Add(int64(len(messages)))
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// chatMessage creates a chat message of the room channel.
+func chatMessage(tb testing.TB, content string) []byte {
+	tb.Helper()
+	message, err := webmodel.CreateJSONMessage(webmodel.InputChatMessage, webmodel.SUCCESS_RESULT, content)
+	if err != nil {
+		tb.Fatalf("CreateJSONMessage: %v", err)
+	}
+	return message
+}
+
+func TestBroadcastMessageInRoom(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	room, _ := newTestRoom(t, hub, "room", 3)
+
+	sentTo, ok := WaitSentTo(hub.BroadcastMessageInRoom(chatMessage(t, "hello"), room), REPORT_WAIT)
+	if !ok {
+		t.Fatal("the broadcast was not reported")
+	}
+	want := map[string]bool{"player-1": true, "player-2": true, "player-3": true}
+	if fmt.Sprint(sentTo) != fmt.Sprint(want) {
+		t.Errorf("got report %v, want %v", sentTo, want)
+	}
+}
+
+func TestUnregisteredRoomReportsQueuedMessages(t *testing.T) {
+	// The broadcaster of the room doesn't run yet, so the messages stay in the queue
+	hub := NewHub()
+	go hub.Run()
+	room := createRoom(hub, "room")
+	hub.Rooms.Set(room.ID, room)
+	client, err := NewClient(hub, "player-1", room, nil, nil)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	var reports []<-chan map[string]bool
+	for i := 0; i < 3; i++ {
+		reports = append(reports, hub.BroadcastMessageInRoom(chatMessage(t, "queued"), room))
+	}
+	hub.UnRegisterRoomFromHub(room)
+	go room.runBroadcaster()
+
+	for i, report := range reports {
+		sentTo, ok := WaitSentTo(report, REPORT_WAIT)
+		if !ok {
+			t.Fatalf("message %d queued before the room was unregistered was never reported", i)
+		}
+		if reached, listed := sentTo[client.UserName]; !listed || reached {
+			t.Errorf("message %d: got report %v, want the client not reached", i, sentTo)
+		}
+	}
+
+	// The messages sent afterwards are not queued
+	sentTo, ok := WaitSentTo(hub.BroadcastMessageInRoom(chatMessage(t, "late"), room), REPORT_WAIT)
+	if !ok || sentTo[client.UserName] {
+		t.Errorf("got report %v (%t) for a message sent to an unregistered room", sentTo, ok)
+	}
+	if messages, _ := client.TakeMessages(); len(messages) != 0 {
+		t.Errorf("the client got %d messages of an unregistered room", len(messages))
+	}
+}
+
+// benchmarkBroadcast broadcasts b.N messages of the given type, spread over `rooms` rooms of `clients` clients,
+// from concurrent senders which wait for the report of every message, as the chat of a player does.
+// The clients read their messages as fast as possible.
+func benchmarkBroadcast(b *testing.B, rooms, clients int, messageType string) {
+	hub := NewHub()
+	go hub.Run()
+
+	roomList := make([]*Room, rooms)
+	for i := range roomList {
+		var roomClients []*Client
+		roomList[i], roomClients = newTestRoom(b, hub, fmt.Sprintf("room-%d", i), clients)
+		for _, client := range roomClients {
+			go drain(client, 0, nil)
+			defer client.Close(CLOSE_SLOW_CONSUMER, "end of the benchmark")
+		}
+	}
+	content, err := webmodel.CreateJSONMessage(messageType, webmodel.SUCCESS_RESULT, "a typical chat message of a player")
+	if err != nil {
+		b.Fatalf("CreateJSONMessage: %v", err)
+	}
+
+	var next, dropped atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			room := roomList[int(next.Add(1))%rooms]
+			sentTo, ok := WaitSentTo(hub.BroadcastMessageInRoom(content, room), REPORT_WAIT)
+			if !ok {
+				b.Error("a broadcast was not reported")
+				return
+			}
+			for _, reached := range sentTo {
+				if !reached {
+					dropped.Add(1)
+				}
+			}
+			// Let the clients read, they would be disconnected as slow consumers on a single CPU otherwise
+			runtime.Gosched()
+		}
+	})
+	b.ReportMetric(float64(dropped.Load())/float64(b.N), "dropped/op")
+}
+
+func BenchmarkBroadcastManyRooms(b *testing.B) {
+	for _, rooms := range []int{1, 50, 500} {
+		b.Run(fmt.Sprintf("rooms=%d", rooms), func(b *testing.B) {
+			benchmarkBroadcast(b, rooms, 4, webmodel.InputChatMessage)
+		})
+	}
+}
+
+func BenchmarkBroadcastStateUpdates(b *testing.B) {
+	benchmarkBroadcast(b, 500, 4, webmodel.StateUpdate)
+}
+
+func BenchmarkBroadcastToAllRooms(b *testing.B) {
+	hub := NewHub()
+	go hub.Run()
+	for i := 0; i < 100; i++ {
+		_, roomClients := newTestRoom(b, hub, fmt.Sprintf("room-%d", i), 4)
+		for _, client := range roomClients {
+			go drain(client, 0, nil)
+			defer client.Close(CLOSE_SLOW_CONSUMER, "end of the benchmark")
+		}
+	}
+	content := chatMessage(b, "a message of the global chat")
+
+	var dropped int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dropped += hub.Rooms.Len() - hub.BroadcastMessageToAllRooms(content)
+	}
+	b.ReportMetric(float64(dropped)/float64(b.N), "dropped-rooms/op")
+}
+
+func TestHostIsElectedWhenTheHostLeaves(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	room, clients := newTestRoom(t, hub, "room", 2)
+	// The clients without a socket are bots, which are never hosts; these ones play humans
+	for _, client := range clients {
+		client.Bot = false
+	}
+
+	if host, changed := room.ElectHost(); host != clients[0] || !changed {
+		t.Fatalf("got host %v (changed %t), want the first player who joined", host, changed)
+	}
+
+	// Reading the host doesn't elect another one, the leave of the host does
+	hub.UnRegisterClientFromHub(clients[0])
+	if host := room.Host(); host != clients[0] {
+		t.Errorf("Host() changed the host to %v before the election", host)
+	}
+	if host, changed := room.ElectHost(); host != clients[1] || !changed {
+		t.Errorf("got host %v (changed %t) after the host left, want '%s' and a change", host, changed, clients[1].UserName)
+	}
+}
+
+func TestGameCantChangeOnceTheCountdownStarted(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	room, _ := newTestRoom(t, hub, "room", 1)
+
+	rules := gamerules.SUDDEN_DEATH
+	if !room.SetGame(rules, "map-1") {
+		t.Fatal("the game can't change before the countdown")
+	}
+	if room.Rules() != rules || room.GameMap() != "map-1" {
+		t.Errorf("got rules %+v and map %q, want %+v and %q", room.Rules(), room.GameMap(), rules, "map-1")
+	}
+
+	room.StartCountdown(time.Hour, func() {})
+	defer room.CancelCountdown()
+	if room.SetGame(gamerules.CLASSIC, "map-2") {
+		t.Error("the game changed once the countdown started")
+	}
+	if room.Rules() != rules || room.GameMap() != "map-1" {
+		t.Errorf("got rules %+v and map %q after the countdown started, want them unchanged", room.Rules(), room.GameMap())
+	}
+}
@@ -22,11 +22,25 @@ export function createChatMessageArea() {
 export function createNewMessageC(date, userName, content) {
   return new VElement({
     tag: "p",
-    content: date + ` ${userName}: ` + ` ${content}`
+    content: chatMessageLine(date, userName, content)
   });
 }
 
-export function createChatC(sendMessage) {
+// chatMessageLine returns the text of a message of the chat, to update a shown message
+export function chatMessageLine(date, userName, content) {
+  return date + ` ${userName}: ` + ` ${content}`;
+}
+
+// createChatTypingC creates the line telling which players are typing, its content is set by the chat model
+export function createChatTypingC() {
+  return new VElement({
+    tag: 'p',
+    attrs: { id: 'chattyping', class: 'chatmessage' },
+    content: "",
+  });
+}
+
+export function createChatC(sendMessage, typingC, onTyping) {
   return new VElement({
     tag: "div",
     attrs: { id: "chat" },
@@ -37,6 +51,7 @@ export function createChatC(sendMessage) {
         attrs: { id: 'chatheader' },
         content: 'Chat'
       }),
+      typingC,
       //ChatMessageArea(), will be added in chatModel.js
       // chat form
       new VElement({
@@ -46,6 +61,7 @@ export function createChatC(sendMessage) {
           new VElement({
             tag: "input",
             attrs: { type: "text", id: "chattextarea", name: CHAT_MESSAGE_FORM_INPUT_NAME, autocomplete: "off", placeholder: 'Type here...' },
+            '@input': () => onTyping(),
           }),
           new VElement({
             tag: "input",
@@ -1,13 +1,13 @@
 import { VElement } from "../../../../framework/VElement.js";
 import { createGameInfoPanelC } from "./gameBoxComponents/gameInfoPanelC.js";
 
-export function createGameBoxC(gameMapVElement, playerList) {
+export function createGameBoxC(gameMapVElement, playerList, matchTimerC) {
     return new VElement({
       // the whole div of all game stuff
       tag: "div",
       attrs: { id: "game" },
       children: [
-        createGameInfoPanelC(playerList), // the panel of game info
+        createGameInfoPanelC(playerList, matchTimerC), // the panel of game info, with the time left in the match
         gameMapVElement, // the game itself
       ],
     });
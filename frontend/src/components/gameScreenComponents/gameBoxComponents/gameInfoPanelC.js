@@ -58,6 +58,13 @@ function ShowFPS(playerList) {
   });
 }
 
+export function createMatchTimerC() { // The time left in the match
+  return new VElement({
+    tag: "div",
+    attrs: { id: "matchtimer" },
+  });
+}
+
 /*function ShowScore(playerList) {
   return new VElement({
     tag: "div",
@@ -87,11 +94,12 @@ export function createShowSpeedPUP(content) { // The amount of bomb powerups
 }
 
 // Powerups will be in player panel
-function createGameSpecs(player) {
+function createGameSpecs(player, matchTimerC) {
   return new VElement({ // The list of game details: Lives, Score, FPS, etc
     tag: 'div',
     attrs: { id: 'gamespecs' },
     children: [
+      matchTimerC,
       ShowFPS(),
       //ShowScore(),
       player.stats.vShowBombPUP,
@@ -124,14 +132,14 @@ function createGameInfoHeader() {
   });
 }
 
-export function createGameInfoPanelC(playerList) {
+export function createGameInfoPanelC(playerList, matchTimerC) {
   return new VElement({
     tag: "div",
     attrs: { id: "gameinfo" },
     children: [
       createGameInfoHeader(),
       createPlayersOnline(playerList),
-      createGameSpecs(mainView.currentPlayer),
+      createGameSpecs(mainView.currentPlayer, matchTimerC),
     ],
   });
 }
\ No newline at end of file
@@ -1,16 +1,31 @@
 import { VElement } from "../../../../framework/VElement.js";
 import { reactives } from "../../../../framework/functions.js";
+import { MAP_TEMPLATES, BOT_DIFFICULTIES } from "../../js_modules/consts/consts.js";
 
 const yes = () => { console.log("yeeee") }
 
 
 reactives.push(yes)
 
-export function createPlayerC(playerName, playerNumber) {
+export function createPlayerC(playerName, playerNumber, ready) {
   return new VElement({
     tag: 'p',
     attrs: { id: `pl${playerNumber}` },
-    content: `${playerNumber} -- ${playerName}`,
+    content: playerLine(playerName, playerNumber, ready),
+  });
+}
+
+// playerLine is the text of a player in the waiting list, with a mark if the player is ready
+export function playerLine(playerName, playerNumber, ready) {
+  return `${playerNumber} -- ${playerName}${ready ? " \u2714" : ""}`;
+}
+
+// createReadyButtonC creates the button telling the room the player is ready, or not ready anymore
+export function createReadyButtonC(toggleReady) {
+  return new VElement({
+    tag: 'input',
+    attrs: { type: 'button', id: "readybutton", class: "startgame", value: 'Ready' },
+    "@click": () => toggleReady(),
   });
 }
 export function createWaitingListC() {
@@ -60,13 +75,132 @@ export function createWaitingTimer10secC() {
 //   });
 // }
 
-export function createWaitingScreenC(waitingListC, waitingTimerC) {
+// createLobbyC creates the place of the lobby settings, its content is set by the waiting screen view
+export function createLobbyC() {
+  return new VElement({
+    tag: 'div',
+    attrs: { id: 'lobby', class: 'welcometext' },
+  });
+}
+
+// lobbyNumberInput creates a labelled number input of the lobby settings form
+function lobbyNumberInput(label, name, value, min, max) {
+  return new VElement({
+    tag: 'label',
+    content: label,
+    children: [
+      new VElement({
+        tag: 'input',
+        attrs: { type: 'number', name: name, value: `${value}`, min: `${min}`, max: `${max}`, required: "" },
+      }),
+    ],
+  });
+}
+
+/**
+ * creates the form of the game rules, which only the host of the room can change
+ * @param {{host: string, rules: object, presets: string[]}} lobby - the host and the game rules of the room, and the presets
+ * @param {boolean} isHost - true if the current player is the host
+ * @param {function} applySettings - called with the new settings when the host applies them
+ * @param {function} choosePreset - called with the name of the preset the host chose
+ */
+export function createLobbySettingsC(lobby, isHost, applySettings, choosePreset) {
+  const settings = lobby.rules;
+  const fieldsetAttrs = isHost ? {} : { disabled: "" };
+  return new VElement({
+    tag: 'form',
+    attrs: { id: 'lobbysettings' },
+    children: [
+      new VElement({
+        tag: 'p',
+        content: isHost ? 'You are the host, choose the game:' : `Host: ${lobby.host}`,
+      }),
+      new VElement({
+        tag: 'fieldset',
+        attrs: fieldsetAttrs,
+        children: [
+          new VElement({
+            tag: 'label',
+            content: 'Rules ',
+            children: [
+              new VElement({
+                tag: 'select',
+                attrs: { name: 'preset' },
+                children: lobby.presets.map((preset) => new VElement({
+                  tag: 'option',
+                  attrs: preset === settings.preset ? { value: preset, selected: "" } : { value: preset },
+                  content: preset,
+                })),
+                '@change': (velem, event) => {
+                  choosePreset(event.target.value);
+                },
+              }),
+            ],
+          }),
+          new VElement({
+            tag: 'label',
+            content: 'Map ',
+            children: [
+              new VElement({
+                tag: 'select',
+                attrs: { name: 'mapTemplate' },
+                children: MAP_TEMPLATES.map((template) => new VElement({
+                  tag: 'option',
+                  attrs: template === settings.mapTemplate ? { value: template, selected: "" } : { value: template },
+                  content: template,
+                })),
+              }),
+            ],
+          }),
+          lobbyNumberInput('Lives ', 'lives', settings.lives, 1, 9),
+          lobbyNumberInput('Match (seconds) ', 'matchDuration', settings.matchDuration, 60, 600),
+          lobbyNumberInput('Power-ups (%) ', 'powerUpDensity', settings.powerUpDensity, 0, 100),
+          lobbyNumberInput('Bots ', 'bots', settings.bots, 0, settings.maxPlayers - 1),
+          new VElement({
+            tag: 'label',
+            content: 'Bot level ',
+            children: [
+              new VElement({
+                tag: 'select',
+                attrs: { name: 'botDifficulty' },
+                children: BOT_DIFFICULTIES.map((difficulty) => new VElement({
+                  tag: 'option',
+                  attrs: difficulty === settings.botDifficulty ? { value: difficulty, selected: "" } : { value: difficulty },
+                  content: difficulty,
+                })),
+              }),
+            ],
+          }),
+        ],
+      }),
+      ...(isHost ? [new VElement({
+        tag: 'input',
+        attrs: { type: 'submit', class: "startgame", value: 'Apply' },
+      })] : []),
+    ],
+    '@submit.prevent': (velem, event) => {
+      const form = event.target;
+      applySettings({
+        mapTemplate: form.mapTemplate.value,
+        lives: parseInt(form.lives.value),
+        matchDuration: parseInt(form.matchDuration.value),
+        powerUpDensity: parseInt(form.powerUpDensity.value),
+        bots: parseInt(form.bots.value),
+        botDifficulty: form.botDifficulty.value,
+      });
+    },
+  });
+}
+
+export function createWaitingScreenC(waitingListC, waitingTimerC, readyButtonC, lobbyC) {
   return new VElement({
     tag: "div",
     attrs: { id: 'waiting', class: 'welcomescreens' },
     children: [
       waitingListC,
       waitingTimerC,
+      readyButtonC,
+      lobbyC,
     ]
   });
 }
@@ -12,9 +12,20 @@ export const PLAYER_NAME_FORM_INPUT = "playerName",
   CHAT_MESSAGE_FORM_INPUT_NAME = "chatMessage",
   WS_REQUEST_TYPE_PLAYER_ACTION = "playerAction",
   WS_REQUEST_TYPE_PLAYER_LOSE_LIFE = "loseLife",
+  // the version of the WebSocket protocol the frontend speaks, see webmodel/protocol.go in the backend
+  PROTOCOL_VERSION = 3,
+  CLOSE_UNSUPPORTED_PROTOCOL = 4003,
+  CLOSE_KICKED = 4004,
+  // the time in ms a request waits for its reply before it is given up
+  REQUEST_TIMEOUT = 10000,
+  // the typing indicator is sent at most every TYPING_REPORT_PERIOD ms, its end after TYPING_STOP_DELAY ms without input
+  TYPING_REPORT_PERIOD = 2000,
+  TYPING_STOP_DELAY = 3000,
   WAIT_FOR_PLAYERS = 20, 
-  START_IN = 10,
-  GAME_TIME = 3*60*1000,
+  // the map templates the room host can choose, as in the backend mapgen
+  MAP_TEMPLATES = ["classic", "open"],
+  // the difficulty levels of the bots the room host can choose, as in the backend gamerules
+  BOT_DIFFICULTIES = ["easy", "normal", "hard"],
   // map tiles
   MAP_TILE_SIZE = 32,
   SPRITESHEET_ROWS = 23,
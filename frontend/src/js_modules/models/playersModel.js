@@ -5,7 +5,7 @@ import { convertRowColumnToXY } from "../../utils/spriteSheetCalc.js";
 import { SPRITE_SHEET_URL, PLAYER_VIEW, MAP_TILE_SIZE, PLAYER_START_POSITIONS, PLAYER_Z_INDEX, PLAYER_MOVEMENT_SPEED, BOMB_EXPLOSION_TIMER, BOMBPUP, FIREPUP, SPEEDPUP, PLAYER_RESPAWN_TIME, GAME_OVER_VIEW } from "../consts/consts.js"
 import { PLAYER_DIE, PLAYER_MOVE_DOWN, PLAYER_MOVE_LEFT, PLAYER_MOVE_RIGHT, PLAYER_MOVE_UP, PLAYER_PLACE_BOMB, PLAYER_POSITION_CURRENT, PLAYER_RESPAWN, POWER_IS_PICKED } from "../consts/playerActionTypes.js";
 import { ActiveEvent, currentEvent, endEvent } from "../player_actions/eventModel.js";
-import { currentAction, stopListenPlayerActions } from "../player_actions/keypresses.js";
+import { currentAction, listenPlayerActions, stopListenPlayerActions } from "../player_actions/keypresses.js";
 
 const OFFSET_IGNORED = 12;
 
@@ -202,7 +202,8 @@ export class Player { // add all player properties here, for example image, move
     console.log("die() set event:", currentEvent);
     if (this.stats.lives == 0) {
       stopListenPlayerActions();
-      setTimeout(() => {
+      this.gameOverTimeoutID = setTimeout(() => {
+        this.gameOverTimeoutID = null;
         mainView.showScreen[GAME_OVER_VIEW]();
         endEvent(currentEvent);
       }
@@ -217,6 +218,20 @@ export class Player { // add all player properties here, for example image, move
       , PLAYER_RESPAWN_TIME);
 
   }
+  // the server rejected the death of the player: the player gets back the lives it has on the server
+  restoreLives(lives) {
+    this.setLives(lives);
+    if (lives > 0 && this.gameOverTimeoutID) {
+      clearTimeout(this.gameOverTimeoutID);
+      this.gameOverTimeoutID = null;
+      listenPlayerActions();
+      const { row, column } = this._number ? PLAYER_START_POSITIONS[this._number - 1] : PLAYER_START_POSITIONS[0];
+      setTimeout(() => {
+        this.respawn(row, column);
+      }
+        , PLAYER_RESPAWN_TIME);
+    }
+  }
   respawn(row, column) {
     this.model = new PlayerModel(row, column);
     const [x, y] = convertRowColumnToXY(row, column)
@@ -1,32 +1,99 @@
-import { createChatC, createChatMessageArea } from "../../../components/chatC.js"
+import { createChatC, createChatMessageArea, createChatTypingC } from "../../../components/chatC.js"
 import Socket from "./webSocketModel.js";
+import { PROTOCOL_VERSION, TYPING_REPORT_PERIOD, TYPING_STOP_DELAY } from "../../consts/consts.js";
 
 export class ChatModel {
     constructor() {
-        this.chatC = createChatC(this.sendChatMessage);
+        this.typingC = createChatTypingC();
+        // the players typing in the chat, by name, with the timer hiding them if their end of typing is lost
+        this.typingPlayers = new Map();
+        this.lastTypingSent = 0;
+        this.chatC = createChatC(this.sendChatMessage, this.typingC, this.sendTyping);
         this.chatMessageArea = createChatMessageArea();
         this.chatC.addChild(this.chatMessageArea);
+        // the shown messages by "<channel>:<messageId>", to apply their edits and deletions
+        this.shownMessages = new Map();
     }
     get vElement() { return this.chatC; }
 
     launch(playerName) {
-        this.socket = new Socket(`joinGame?name=${playerName}`);
+        this.socket = new Socket(`joinGame?name=${playerName}&version=${PROTOCOL_VERSION}`);
+        // the player is idle while the page is hidden
+        document.addEventListener("visibilitychange", this.sendPresence);
     }
 
     stop(code) {
+        document.removeEventListener("visibilitychange", this.sendPresence);
         this.socket.closeWebsocket(code);
     }
 
+    sendPresence = () => {
+        this.socket.request("setPresence", { presence: document.hidden ? "idle" : "online" });
+    }
+
+    // sendTyping tells the room the player is typing, at most once per TYPING_REPORT_PERIOD,
+    // and that the player stopped typing after TYPING_STOP_DELAY without input
+    sendTyping = () => {
+        const now = Date.now();
+        if (now - this.lastTypingSent >= TYPING_REPORT_PERIOD) {
+            this.lastTypingSent = now;
+            this.socket.request("typing", { typing: true });
+        }
+        clearTimeout(this.typingStopTimer);
+        this.typingStopTimer = setTimeout(this.stopTyping, TYPING_STOP_DELAY);
+    }
+
+    stopTyping = () => {
+        clearTimeout(this.typingStopTimer);
+        if (this.lastTypingSent !== 0) {
+            this.lastTypingSent = 0;
+            this.socket.request("typing", { typing: false });
+        }
+    }
+
+    // showTyping updates the line of the players typing in the chat
+    showTyping(playerName, typing) {
+        clearTimeout(this.typingPlayers.get(playerName));
+        this.typingPlayers.delete(playerName);
+        if (typing) {
+            this.typingPlayers.set(playerName, setTimeout(() => this.showTyping(playerName, false), TYPING_STOP_DELAY + TYPING_REPORT_PERIOD));
+        }
+        const names = [...this.typingPlayers.keys()];
+        this.typingC.content = names.length === 0 ? "" : `${names.join(", ")} ${names.length === 1 ? "is" : "are"} typing...`;
+    }
+
     requestServer(type, payload) {
         this.socket.request(type, payload);
     }
 
     sendChatMessage = (text) => {
-        this.socket.request("sendMessageToChat", { content: text, dateCreate: new Date() })
+        this.stopTyping();
+        this.socket.request("sendMessageToChat", { ...chatChannelOf(text), clientDate: new Date() }, (payload) => {
+            // the reply is "sent", or tells why the message was rejected
+            if (payload.result !== "success") {
+                console.error(`chat message "${text}" was not sent: ${payload.data}`);
+            }
+        })
     }
 
     clearChatArea = () => {
         this.chatC.delChild(this.chatMessageArea.vId)
         this.chatMessageArea = createChatMessageArea();
-        this.chatC.addChild(this.chatMessageArea);}
-}
\ No newline at end of file
+        this.chatC.addChild(this.chatMessageArea);
+        this.shownMessages.clear();}
+}
+/* chatChannelOf reads the channel of a chat message from the prefix of its text:
+ * "@bob hi" is private, "@bob,alice hi" goes to a group of players, "#global hi" to the players of all rooms,
+ * any other text to the room. */
+function chatChannelOf(text) {
+    const [prefix, ...rest] = text.trim().split(" ");
+    const content = rest.join(" ");
+    if (prefix.length > 1 && prefix.startsWith("@")) {
+        const to = prefix.slice(1).split(",").filter(Boolean);
+        return { content, channel: to.length === 1 ? "private" : "group", to };
+    }
+    if (prefix === "#global") {
+        return { content, channel: "global" };
+    }
+    return { content: text };
+}
@@ -1,6 +1,7 @@
 export class payloadModel {
-    constructor(type, payload) {
+    constructor(type, payload, id) {
         this.type = type,
         this.payload = payload
+        this.id = id // optional, echoed by the server in the reply
     }
 }
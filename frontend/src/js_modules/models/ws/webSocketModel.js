@@ -1,10 +1,14 @@
 
 import { payloadModel } from "./payloadModel.js"
-import { wsResponseRouter } from "../../../router/ws_response_router.js";
+import { wsReplyRouter, wsResponseRouter } from "../../../router/ws_response_router.js";
 import { mainView } from "../../../app.js";
+import { CLOSE_KICKED, CLOSE_UNSUPPORTED_PROTOCOL, REQUEST_TIMEOUT } from "../../consts/consts.js";
 
 export default class Socket {
   constructor(url) {
+    // the requests waiting for their reply, by request id: their type, callback and timeout
+    this.pendingRequests = new Map();
+    this.lastRequestId = 0;
     this.connection = new WebSocket(`ws://localhost:8000/${url}`);
 
     this.connection.onopen = function (event) {
@@ -14,8 +18,17 @@ export default class Socket {
 
     this.connection.onmessage = this.handleMessages;
 
-    this.connection.onclose = function (event) {
+    this.connection.onclose = (event) => {
       console.log("WebSocket connection closed:", event);
+      // no reply comes anymore
+      [...this.pendingRequests.keys()].forEach((id) => this.rejectRequest(id, "the connection is closed"));
+      if (event.code === CLOSE_UNSUPPORTED_PROTOCOL) {
+        // the page is older than the server, the reason lists the versions the server supports
+        mainView.showError("the game was updated, please reload the page");
+      } else if (event.code === CLOSE_KICKED) {
+        // the reason holds the reason given by the room host
+        mainView.showError(event.reason);
+      }
     };
     this.connection.onerror = function (event) {
       console.log("WebSocket error:", event);
@@ -28,6 +41,17 @@ export default class Socket {
     rawMessages.forEach((rawMessage) => {
       try {
         const message = JSON.parse(rawMessage);
+        // a reply goes to the callback of its request, even an error, or to the reply router;
+        // messages without `reply` are pushed by the server
+        if (message.reply) {
+          const request = this.takeRequest(message.id);
+          if (!request) {
+            console.warn(`reply to the request ${message.id} which timed out:`, message.payload);
+            return;
+          }
+          request.onReply(message.payload, request.type);
+          return;
+        }
         if (message.type === "ERROR") {
           throw new Error(`${message.payload.result}:  ${message.payload.data}`);
         }
@@ -44,11 +68,42 @@ export default class Socket {
   closeWebsocket(code) {
     this.connection.close(code);
   }
-  request(type, payload) {
+  request(type, payload, onReply = this.routeReply) {
     // handles the websocket request message and converts to json as well
-    const init = JSON.stringify(new payloadModel(type, payload));
+    // `onReply(payload, type)` is called with the reply of the server, matched by the request id,
+    // or with an error payload if no reply comes within REQUEST_TIMEOUT;
+    // the requests without a callback go to the reply router.
+    const id = String(++this.lastRequestId);
+    const timeoutID = setTimeout(() => this.rejectRequest(id, "no reply from the server"), REQUEST_TIMEOUT);
+    this.pendingRequests.set(id, { type, onReply, timeoutID });
+    const init = JSON.stringify(new payloadModel(type, payload, id));
     this.connection.send(init);
   }
+  // takeRequest removes the pending request with the id and returns it, undefined if there is none
+  takeRequest(id) {
+    const request = this.pendingRequests.get(id);
+    if (request) {
+      clearTimeout(request.timeoutID);
+      this.pendingRequests.delete(id);
+    }
+    return request;
+  }
+  // rejectRequest removes the pending request and calls its callback with an error;
+  // the requests without a callback are given up quietly, most of them are replied to only when they fail
+  rejectRequest(id, reason) {
+    const request = this.takeRequest(id);
+    if (request && request.onReply !== this.routeReply) {
+      request.onReply({ result: "error", data: reason }, request.type);
+    }
+  }
+  // routeReply handles the reply of a request sent without a callback
+  routeReply = (payload, type) => {
+    if (payload.result !== "success") {
+      console.error(`request "${type}" failed:`, payload.data);
+      return;
+    }
+    wsReplyRouter[type]?.(payload);
+  }
   loadPageAfterWsOpen(loadPage) {
     if (this.connection.readyState == 1) {
       loadPage();
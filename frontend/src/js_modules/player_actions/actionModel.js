@@ -6,9 +6,22 @@ import { dyingHandler, playerDieSender, playerRespawnHandler, playerRespawnSende
 import { movePlayer, movementHandler } from "./playerMovement.js"
 import { powerPickupHandler, powerPickupSender } from "./powerPickup.js"
 
+// sequence number of the last action sent, the server drops duplicate and out-of-order actions
+let lastActionSeq = 0;
+// the last server tick received, the server validates bombs and deaths against the state of this tick
+let lastServerTick = 0;
+
+export function setServerTick(tick) {
+    if (tick > lastServerTick) {
+        lastServerTick = tick
+    }
+}
+
 class PlayerAction {
     constructor(type) {
         this.type = type
+        this.seq = ++lastActionSeq
+        this.tick = lastServerTick
     }
 }
 
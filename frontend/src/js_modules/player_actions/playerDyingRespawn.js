@@ -29,7 +29,10 @@ export function playerRespawnHandler(playerName, position) {
 }
 export function dyingHandler(playerName, lives) {
   const player =  mainView.PlayerList.players[playerName];
-  player?.setLives(lives); // in draw, it will render the newly set x and y position into the VElement
+  if (!player) {
+    return; // the player already left the game with the state updates
+  }
+  player.setLives(lives); // in draw, it will render the newly set x and y position into the VElement
   if (lives < 1) {
     mainView.gameMap.vElement.delChild(
       player?.vElement.vId
@@ -16,6 +16,8 @@ export class MainView {
         this.currentViewModel = new RegisterScreenView;
         this.currentViewChildIndex = 1;
         this.solo = false;
+        this.protocol = null; // the `hello` of the server: negotiated protocol version and features
+        this.rules = null; // the game rules of the room, sent by the server when the game starts
         this.vElement = new VElement({
             tag: 'div',
             attrs: { id: "main" },
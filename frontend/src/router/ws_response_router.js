@@ -1,10 +1,12 @@
 import { mainView } from "../app.js";
 import { Player } from "../js_modules/models/playersModel.js";
-import { playerActioner } from "../js_modules/player_actions/actionModel.js";
-import { GAME_VIEW, WAITING_VIEW } from "../js_modules/consts/consts.js";
-import { createNewMessageC } from "../components/chatC.js";
+import { playerActioner, setServerTick } from "../js_modules/player_actions/actionModel.js";
+import { GAME_OVER_VIEW, GAME_VIEW, WAITING_VIEW, YOU_WIN_VIEW } from "../js_modules/consts/consts.js";
+import { stopListenPlayerActions } from "../js_modules/player_actions/keypresses.js";
+import { chatMessageLine, createNewMessageC } from "../components/chatC.js";
 import { RegisterScreenView } from "../views/registerScreenView.js";
 import { gameBoxModel } from "../views/gameBoxView.js";
+import { WaitingScreenView } from "../views/waitingScreenView.js";
 
 function oneMessage(message) {
   return new VElement({
@@ -13,7 +15,17 @@ function oneMessage(message) {
       content: message,
   });
 }
+// wsResponseRouter handles the messages pushed by the server, by type
 export const wsResponseRouter = {
+  hello(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("the server doesn't support the protocol version of the page:", payload.data);
+      return
+    }
+    // the negotiated version and the features of the server, e.g. binary encoding
+    mainView.protocol = payload.data;
+  },
+
   usersInRoom(payload) {
     if (!mainView.isInRegisterState()) {
       console.error("illegal attempt to register, main view is not in register state");
@@ -26,6 +38,11 @@ export const wsResponseRouter = {
         mainView.chatModel.stop();
         mainView.delCurrentPlayer();
       }
+      if (payload.data === 'kicked from the room') {
+        mainView.showError('you were kicked from this room');
+        mainView.chatModel.stop();
+        mainView.delCurrentPlayer();
+      }
       return
     }
 
@@ -33,9 +50,12 @@ export const wsResponseRouter = {
     payload.data.forEach(user => {
       if (user.playerName === mainView.currentPlayer.name) {
         mainView.currentPlayer.number = user.playerNumber;
+        mainView.currentPlayer.ready = user.ready;
         players.push(mainView.currentPlayer);
       } else {
-        players.push(new Player(user.playerName, user.playerNumber));
+        const player = new Player(user.playerName, user.playerNumber);
+        player.ready = user.ready;
+        players.push(player);
       }
     });
     if(mainView.solo){
@@ -54,18 +74,77 @@ export const wsResponseRouter = {
 
     let user = payload.data;
     if (user.playerName !== mainView.currentPlayer.name) {
-      mainView.addPlayers(new Player(user.playerName, user.playerNumber))
+      const player = new Player(user.playerName, user.playerNumber);
+      player.ready = user.ready;
+      mainView.addPlayers(player)
     }
   },
 
-  startGame(payload) {
+  readyState(payload) {
     if (!isSuccessPayload(payload)) {
-      console.error("Could not get random Game map from server:", payload.data);
-      return;
+      console.error("Error in readyState handler:", payload.data);
+      return
+    }
+    const player = mainView.PlayerList.players[payload.data.playerName];
+    if (!player) {
+      return
+    }
+    player.ready = payload.data.ready;
+    if (mainView.currentViewModel instanceof WaitingScreenView) {
+      mainView.currentViewModel.setPlayerReady(player);
+    }
+  },
+
+  lobby(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in lobby handler:", payload.data);
+      return
+    }
+    // the host of the room and its game rules, the map and the rules come with startGame
+    mainView.lobby = payload.data;
+    if (mainView.currentViewModel instanceof WaitingScreenView) {
+      mainView.currentViewModel.setLobby(payload.data);
+    }
+  },
+
+  readyCheck(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in readyCheck handler:", payload.data);
+      return
+    }
+    // the countdown to the start of the game runs while `startsAt` is set
+    if (mainView.currentViewModel instanceof WaitingScreenView) {
+      mainView.currentViewModel.setReadyCheck(payload.data);
+    }
+  },
+
+  gameStarted(payload) {
+    // the server starts the game when the countdown of the waiting room ends, with the map and the game rules of the room
+    if (mainView.currentViewModel instanceof WaitingScreenView) {
+      mainView.currentViewModel.stopCountdowns();
+      wsReplyRouter.startGame(payload);
+    }
+  },
+
+  matchOver(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in matchOver handler:", payload.data);
+      return
+    }
+    // the match duration is over, the player wins if nobody else survived
+    if (!mainView.gameMap) {
+      return
+    }
+    if (mainView.currentViewModel instanceof gameBoxModel) {
+      mainView.currentViewModel.stopCountdowns();
+    }
+    stopListenPlayerActions();
+    const survivors = payload.data.survivors;
+    if (survivors.length === 1 && survivors[0] === mainView.currentPlayer.name) {
+      mainView.showScreen[YOU_WIN_VIEW]();
+    } else {
+      mainView.showScreen[GAME_OVER_VIEW]();
     }
-    let gameMapString = payload.data;
-    console.log("Game map--", gameMapString);
-    mainView.showScreen[GAME_VIEW](gameMapString);
   },
 
   userQuitChat(payload) {
@@ -89,17 +168,96 @@ export const wsResponseRouter = {
       console.error("Error in inputChatMessage handler:", payload.data);
       return
     }
+    mainView.chatModel.showTyping(payload.data.userName, false);
+    showChatMessage(payload.data);
+  },
+
+  chatHistory(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in chatHistory handler:", payload.data);
+      return
+    }
+    // the last messages of the room or global channel, sent on join, the oldest first
+    payload.data.messages.forEach(showChatMessage);
+  },
+
+  chatMessageEdited(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in chatMessageEdited handler:", payload.data);
+      return
+    }
     const mess = payload.data;
+    const shown = mainView.chatModel.shownMessages.get(`${mess.channel}:${mess.messageId}`);
+    if (shown) {
+      shown.content = chatMessageLine(...chatMessageParts(mess));
+    }
+  },
 
-    let formatedDate = mess.dateCreate.slice(11, 19)
+  chatMessageDeleted(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in chatMessageDeleted handler:", payload.data);
+      return
+    }
+    const key = `${payload.data.channel}:${payload.data.messageId}`;
+    const shown = mainView.chatModel.shownMessages.get(key);
+    if (shown) {
+      mainView.chatModel.chatMessageArea.delChild(shown.vId);
+      mainView.chatModel.shownMessages.delete(key);
+    }
+  },
+
+  presence(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in presence handler:", payload.data);
+      return
+    }
+    // online, idle, inGame or spectating
+    const player = mainView.PlayerList.players[payload.data.playerName];
+    if (player) {
+      player.presence = payload.data.presence;
+    }
+  },
 
-    const newMessage = createNewMessageC(formatedDate, mess.userName, mess.content);
+  typing(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in typing handler:", payload.data);
+      return
+    }
+    if (payload.data.playerName !== mainView.currentPlayer.name) {
+      mainView.chatModel.showTyping(payload.data.playerName, payload.data.typing);
+    }
+  },
+
+  systemMessage(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in systemMessage handler:", payload.data);
+      return
+    }
+    // the reply of a chat command, e.g. "/roll 2d6"; the lines of "/help" are kept
+    const mess = payload.data;
+    const content = escapeHTML(mess.content).replaceAll("\n", "<br>");
+    const newMessage = createNewMessageC(mess.dateCreate.slice(11, 19), "server", content);
     mainView.chatModel.chatMessageArea.addChild(newMessage);
     newMessage.$elem.scrollIntoView();
   },
 
-  sendMessageToChat(payload) {
-    //
+  moderation(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in moderation handler:", payload.data);
+      return
+    }
+    // the room host muted, unmuted or kicked a player, shown as a line of the chat
+    const event = payload.data;
+    let text = `${event.by} ${event.action === "kick" ? "kicked" : event.action + "d"} ${event.userName}`;
+    if (event.until) {
+      text += ` until ${event.until.slice(11, 19)}`;
+    }
+    if (event.reason) {
+      text += `: ${event.reason}`;
+    }
+    const newMessage = createNewMessageC(new Date().toISOString().slice(11, 19), "moderation", text);
+    mainView.chatModel.chatMessageArea.addChild(newMessage);
+    newMessage.$elem.scrollIntoView();
   },
 
   playerAction(payload) {
@@ -109,8 +267,119 @@ export const wsResponseRouter = {
     }
     playerActioner[payload.data.action.type].handle(payload.data)
   },
+
+  stateUpdate(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in stateUpdate handler:", payload.data);
+      return
+    }
+    const update = payload.data;
+    update.players?.forEach((state) => {
+      // the position of the current player is already moved locally
+      if (state.playerName === mainView.currentPlayer.name) return;
+      const player = mainView.PlayerList.players[state.playerName];
+      if (!player) return;
+      player.position = state.coords;
+      if (state.spriteInfo) {
+        player.spriteInfo = state.spriteInfo;
+      }
+    });
+    // the players who left the game since the acknowledged tick
+    update.removed?.forEach((playerName) => {
+      const player = mainView.PlayerList.players[playerName];
+      if (player && playerName !== mainView.currentPlayer.name) {
+        mainView.delPlayers(player);
+      }
+    });
+    setServerTick(update.tick);
+    // acknowledge the tick, so the next updates contain only the changes since it
+    mainView.chatModel.requestServer("stateAck", update.tick);
+  },
+
+  playerCorrection(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in playerCorrection handler:", payload.data);
+      return
+    }
+    // the server rejected an action of the player, its state on the server is the right one
+    const state = payload.data;
+    if (state.playerName === mainView.currentPlayer.name) {
+      mainView.currentPlayer.restoreLives(state.lives);
+    }
+  },
+
+  ping(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in ping handler:", payload.data);
+      return
+    }
+    // the ping is sent back, so the server can measure the round-trip time
+    mainView.chatModel.requestServer("pong", payload.data);
+  },
+
+  roomLatency(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Error in roomLatency handler:", payload.data);
+      return
+    }
+    payload.data.forEach((user) => {
+      const player = mainView.PlayerList.players[user.playerName];
+      if (player) {
+        player.rtt = user.rtt;
+        player.jitter = user.jitter;
+      }
+    });
+  },
+};
+
+// wsReplyRouter handles the successful replies to the requests sent without a callback, by request type;
+// the replies of the other requests are ignored (see Socket.request)
+export const wsReplyRouter = {
+  startGame(payload) {
+    if (!isSuccessPayload(payload)) {
+      console.error("Could not get random Game map from server:", payload.data);
+      return;
+    }
+    // the map and the game rules of the room
+    const { gameMap, rules } = payload.data;
+    console.log("Game map--", gameMap);
+    mainView.rules = rules;
+    mainView.showScreen[GAME_VIEW](gameMap);
+    // every player starts with the lives of the game rules
+    Object.values(mainView.PlayerList.players).forEach((player) => player.setLives(rules.lives));
+  },
 };
 
+function showChatMessage(mess) {
+  const newMessage = createNewMessageC(...chatMessageParts(mess));
+  mainView.chatModel.chatMessageArea.addChild(newMessage);
+  newMessage.$elem.scrollIntoView();
+  // the messages with an id can be edited and deleted later
+  if (mess.messageId) {
+    mainView.chatModel.shownMessages.set(`${mess.channel}:${mess.messageId}`, newMessage);
+  }
+}
+
+// chatMessageParts returns the time, the sender and the content of a chat message line; the time is the server's time of the message
+function chatMessageParts(mess) {
+  let formatedDate = mess.dateCreate.slice(11, 19)
+
+  // the messages of the other channels than the room are marked with their channel
+  let sender = mess.userName;
+  if (mess.channel === "private" || mess.channel === "group") {
+    sender += ` (to ${mess.to.join(", ")})`;
+  } else if (mess.channel === "global") {
+    sender += " (global)";
+  }
+  const content = mess.editedAt ? `${mess.content} (edited)` : mess.content;
+  return [formatedDate, sender, content];
+}
+
+// escapeHTML makes a text written by the server safe to show as the content of an element
+function escapeHTML(text) {
+  return text.replaceAll("&", "&amp;").replaceAll("<", "&lt;").replaceAll(">", "&gt;");
+}
+
 function isSuccessPayload(payload) {
   if (payload.result !== "success") {
     return false
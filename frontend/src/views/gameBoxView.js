@@ -1,37 +1,37 @@
 import { animate } from "../animation/animate.js";
 import { mainView } from "../app.js";
 import { createGameBoxC } from "../components/gameScreenComponents/gameBoxC.js";
-import { GAME_TIME } from "../js_modules/consts/consts.js";
+import { createMatchTimerC } from "../components/gameScreenComponents/gameBoxComponents/gameInfoPanelC.js";
 import { listenPlayerActions } from "../js_modules/player_actions/keypresses.js";
 
 //this object contains components that could be used in other components
 export class gameBoxModel {
     constructor(gameMap, playerList) {
-
-        this.gameBoxC = createGameBoxC(gameMap.vElement, playerList);
+        this.matchTimerC = createMatchTimerC();
+        this.gameBoxC = createGameBoxC(gameMap.vElement, playerList, this.matchTimerC);
 
         requestAnimationFrame(animate);
         listenPlayerActions();
-        // this.startTimer(GAME_TIME);
+        // the match lasts the match duration of the game rules, the server ends it with `matchOver`;
+        // the older servers don't send the game rules
+        if (mainView.rules) {
+            this.startTimer(mainView.rules.matchDuration);
+        }
     }
 
     get vElement() {
         return this.gameBoxC;
     }
 
-    startTimer(timer) {
-        if (timer > 0) {
-            timer--;
-            this.waitingTimer10secC.content = timer;
-            if (timer === 0) {
-                mainView.chatModel.requestServer("startGame", "");
-            } else {
-                this.timeoutID = setTimeout(this.countdown10sec, 1000, timer);
-            }
+    startTimer = (seconds) => {
+        const minutes = Math.floor(seconds / 60);
+        this.matchTimerC.content = `Time: ${minutes}:${String(seconds % 60).padStart(2, "0")}`;
+        if (seconds > 0) {
+            this.timeoutID = setTimeout(this.startTimer, 1000, seconds - 1);
         }
     }
 
     stopCountdowns() {
         clearTimeout(this.timeoutID)
     }
-}
\ No newline at end of file
+}
@@ -1,7 +1,7 @@
-import { createWaitingScreenC, createPlayerC, createWaitingListC } from "../components/welcomeScreenComponents/waitingScreenC.js"
+import { createWaitingScreenC, createPlayerC, createWaitingListC, createReadyButtonC, playerLine, createLobbyC, createLobbySettingsC } from "../components/welcomeScreenComponents/waitingScreenC.js"
 import { createWaitingTimerC, createWaitingTimer10secC, createWaitingTimer20secC } from "../components/welcomeScreenComponents/waitingScreenC.js";
 import { mainView } from "../app.js";
-import { START_IN, WAIT_FOR_PLAYERS } from "../js_modules/consts/consts.js";
+import { WAIT_FOR_PLAYERS } from "../js_modules/consts/consts.js";
 
 //this object contains components that could be used in other components
 export class WaitingScreenView {
@@ -10,18 +10,25 @@ export class WaitingScreenView {
         this.waitingTimer20secC = createWaitingTimer20secC();
         this.waitingTimer10secC = createWaitingTimer10secC();
         this.WaitingTimerC = createWaitingTimerC(this.waitingTimer20secC);
-        this.waitingScreenC = createWaitingScreenC(this.waitingListC, this.WaitingTimerC);
+        this.readyButtonC = createReadyButtonC(this.toggleReady);
+        this.lobbyC = createLobbyC();
+        this.waitingScreenC = createWaitingScreenC(this.waitingListC, this.WaitingTimerC, this.readyButtonC, this.lobbyC);
+        // the player is made ready when the waiting time ends, unless the player used the ready button
+        this.autoReady = true;
+        // true while the countdown to the start of the game, sent by the server, is running
+        this.starting = false;
 
         for (const player of players) {
-            this.waitingListC.addChild(createPlayerC(player.name, player.number));
+            this.waitingListC.addChild(createPlayerC(player.name, player.number, player.ready));
+        }
+        this.showReadyButton(mainView.currentPlayer.ready);
+        if (mainView.lobby) {
+            this.setLobby(mainView.lobby);
         }
         //TODO >=1 for test, should be >1
-        if (players.length > 1 && players.length < 4) {
+        if (players.length > 1) {
             this.countdown20sec(WAIT_FOR_PLAYERS);
         }
-        if (players.length === 4) {
-            this.startTimer10sec();
-        }
     }
 
     get vElement() {
@@ -35,27 +42,20 @@ export class WaitingScreenView {
     }
 
     /**
-     * 
-     * @param {Player} player 
+     *
+     * @param {Player} player
      */
     addPlayers(...players) {
         for (const player of players) {
-            this.waitingListC.addChild(createPlayerC(player.name, player.number));
+            this.waitingListC.addChild(createPlayerC(player.name, player.number, player.ready));
         }
-        if (mainView.PlayerList.length > 1 && mainView.PlayerList.length < 4) {
+        // the countdown to the start, if it was running, is cancelled by the server: the new player is not ready
+        if (mainView.PlayerList.length > 1 && !this.starting) {
             if (this.timeoutID) {
                 clearTimeout(this.timeoutID);
             }
             setTimeout(this.countdown20sec, 0, WAIT_FOR_PLAYERS);
-
-        }
-        if (mainView.PlayerList.length === 4) {
-            if (this.timeoutID) {
-                clearTimeout(this.timeoutID);
-            }
-            setTimeout(this.startTimer10sec(), 0);
         }
-
     }
 
     delPlayers(...players) {
@@ -79,13 +79,81 @@ export class WaitingScreenView {
         this.waitingListC.children = newChildren;
     }
 
+    /**
+     * shows that a player is ready or not ready anymore
+     * @param {Player} player
+     */
+    setPlayerReady(player) {
+        for (const child of this.waitingListC.children) {
+            if (child.attrs.id === `pl${player.number}`) {
+                child.content = playerLine(player.name, player.number, player.ready);
+            }
+        }
+        if (player === mainView.currentPlayer) {
+            this.showReadyButton(player.ready);
+        }
+    }
+
+    /**
+     * shows the number of ready players and starts or cancels the countdown to the start of the game
+     * @param {{ready: number, players: number, startsAt?: string, seconds?: number}} check - the ready check of the room
+     */
+    setReadyCheck(check) {
+        this.waitingListC.content = `People ready: ${check.ready}/${check.players}`;
+        if (check.startsAt && !this.starting) {
+            this.startTimer10sec(check.seconds);
+        }
+        if (!check.startsAt && this.starting) {
+            // a player is not ready anymore, or a new player joined
+            this.starting = false;
+            clearTimeout(this.timeoutID);
+            this.WaitingTimerC.content = "Waiting...";
+            this.WaitingTimerC.delChild(0);
+            this.WaitingTimerC.addChild(this.waitingTimer20secC);
+            this.countdown20sec(WAIT_FOR_PLAYERS);
+        }
+    }
+
+    /**
+     * shows the host and the game rules of the room, the host can change them
+     * @param {{host: string, rules: object, presets: string[]}} lobby
+     */
+    setLobby(lobby) {
+        const isHost = lobby.host === mainView.currentPlayer.name;
+        this.lobbyC.children = [createLobbySettingsC(lobby, isHost, this.applySettings, this.choosePreset)];
+    }
+
+    choosePreset = (preset) => {
+        mainView.chatModel.socket.request("setGamePreset", { preset: preset }, (payload) => {
+            if (payload.result !== "success") {
+                console.error("the preset was not chosen:", payload.data);
+            }
+        });
+    }
+
+    applySettings = (settings) => {
+        mainView.chatModel.socket.request("setLobbySettings", settings, (payload) => {
+            if (payload.result !== "success") {
+                console.error("the lobby settings were not changed:", payload.data);
+            }
+        });
+    }
+
+    toggleReady = () => {
+        this.autoReady = false;
+        mainView.chatModel.requestServer("setReady", { ready: !mainView.currentPlayer.ready });
+    }
+
+    showReadyButton(ready) {
+        this.readyButtonC.setAttr({ value: ready ? 'Not ready' : 'Ready' });
+    }
+
     countdown10sec = (waiting10sec) => {
         if (waiting10sec > 0) {
             waiting10sec--;
             this.waitingTimer10secC.content = waiting10sec;
-            if (waiting10sec === 0) {
-                mainView.chatModel.requestServer("startGame", "");
-            } else {
+            // the game starts with the `gameStarted` message of the server, when its countdown ends
+            if (waiting10sec > 0) {
                 this.timeoutID = setTimeout(this.countdown10sec, 1000, waiting10sec);
             }
         }
@@ -97,21 +165,26 @@ export class WaitingScreenView {
             waiting20sec--;
             this.waitingTimer20secC.content = waiting20sec;
             if (waiting20sec === 0) {
-                this.startTimer10sec();
+                // the game starts when all the players are ready, the server starts the countdown
+                if (this.autoReady && !mainView.currentPlayer.ready) {
+                    mainView.chatModel.requestServer("setReady", { ready: true });
+                }
                 return;
             }
             this.timeoutID = setTimeout(this.countdown20sec, 1000, waiting20sec); // Schedule the next iteration after 1 second
         }
     }
 
-    startTimer10sec() {
-        mainView.chatModel.socket.request("readyToStart")
+    startTimer10sec(seconds) {
+        clearTimeout(this.timeoutID);
+        this.starting = true;
         this.WaitingTimerC.content = "Game starts in...";
         this.WaitingTimerC.delChild(0);
         this.WaitingTimerC.addChild(this.waitingTimer10secC);
-        this.countdown10sec(START_IN);
+        this.waitingTimer10secC.content = seconds;
+        this.timeoutID = setTimeout(this.countdown10sec, 1000, seconds);
     }
     stopCountdowns() {
         clearTimeout(this.timeoutID)
     }
-}
\ No newline at end of file
+}